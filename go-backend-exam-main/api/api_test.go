@@ -0,0 +1,410 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"city2city/api/handler"
+	"city2city/api/models"
+	"city2city/auth"
+	"city2city/config"
+	"city2city/metrics"
+	"city2city/storage"
+	"city2city/storage/memory"
+)
+
+// client calls a test server running the API on the memory store, as the
+// admin it logged in.
+type client struct {
+	t     *testing.T
+	srv   *httptest.Server
+	store storage.IStorage
+	cfg   config.Config
+	token string
+}
+
+func newClient(t *testing.T) client {
+	t.Helper()
+
+	cfg, err := config.Load([]string{"-storage=memory", "-env=development"})
+	if err != nil {
+		t.Fatalf("loading config: %v", err)
+	}
+
+	store := memory.New()
+	hash, err := auth.HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Admin().Create(context.Background(), models.CreateAdmin{Login: "root", Role: auth.RoleAdmin, PasswordHash: hash}); err != nil {
+		t.Fatal(err)
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := httptest.NewServer(New(handler.New(store, cfg, log), cfg, log, metrics.NewRegistry()))
+	t.Cleanup(srv.Close)
+
+	c := client{t: t, srv: srv, store: store, cfg: cfg}
+	tokens := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	c.expect(http.MethodPost, "/v1/auth/login", models.AdminLoginRequest{Login: "root", Password: "secret"}, http.StatusOK, &tokens)
+	c.token = tokens.AccessToken
+
+	return c
+}
+
+// do sends body as JSON and returns the status and the Data of the
+// response, or its whole body when it is not JSON.
+func (c client) do(method, path string, body interface{}) (int, json.RawMessage) {
+	c.t.Helper()
+
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.srv.URL+path, reqBody)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.srv.Client().Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	// errors the router answers itself, such as 405, are plain text
+	envelope := struct {
+		Data json.RawMessage
+	}{}
+	if !json.Valid(data) || json.Unmarshal(data, &envelope) != nil {
+		return resp.StatusCode, data
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/json" {
+		c.t.Errorf("%s %s: got Content-Type %q, want application/json", method, path, contentType)
+	}
+
+	return resp.StatusCode, envelope.Data
+}
+
+// expect fails the test unless the request answers status, and decodes the
+// Data of the response into out when given.
+func (c client) expect(method, path string, body interface{}, status int, out interface{}) {
+	c.t.Helper()
+
+	got, data := c.do(method, path, body)
+	if got != status {
+		c.t.Fatalf("%s %s: got status %d, want %d: %s", method, path, got, status, data)
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			c.t.Fatalf("%s %s: decoding data: %v", method, path, err)
+		}
+	}
+}
+
+// create posts body and returns the ID of the created record.
+func (c client) create(path string, body interface{}) string {
+	c.t.Helper()
+
+	created := struct {
+		ID string `json:"id"`
+	}{}
+	c.expect(http.MethodPost, path, body, http.StatusCreated, &created)
+	return created.ID
+}
+
+// expectError fails the test unless the request answers status with an
+// error of the given code.
+func (c client) expectError(method, path string, body interface{}, status int, code string) {
+	c.t.Helper()
+
+	e := models.Error{}
+	c.expect(method, path, body, status, &e)
+	if e.Code != code {
+		c.t.Fatalf("%s %s: got error code %q, want %q", method, path, e.Code, code)
+	}
+}
+
+// sendOTP stores code as the pending login code of the customer or driver
+// with phone, standing in for the one POST /v1/auth/otp texts them.
+func (c client) sendOTP(role, phone, code string) {
+	c.t.Helper()
+
+	if err := c.store.OTP().Save(context.Background(), models.OTP{
+		Role:      role,
+		Phone:     phone,
+		CodeHash:  auth.HashOTP(code),
+		ExpiresAt: time.Now().UTC().Add(c.cfg.OTPTTL),
+	}); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// login returns a client calling as the customer or driver with phone.
+func (c client) login(role, phone string) client {
+	c.t.Helper()
+
+	c.sendOTP(role, phone, "123456")
+
+	tokens := auth.TokenPair{}
+	c.expect(http.MethodPost, "/v1/auth/otp/verify", models.VerifyOTPRequest{Role: role, Phone: phone, Code: "123456"}, http.StatusOK, &tokens)
+	c.token = tokens.AccessToken
+
+	return c
+}
+
+func TestAuthentication(t *testing.T) {
+	c := newClient(t)
+	c.token = ""
+	c.expectError(http.MethodGet, "/v1/cities", nil, http.StatusUnauthorized, "unauthorized")
+
+	c.token = "not-a-token"
+	c.expectError(http.MethodGet, "/v1/cities", nil, http.StatusUnauthorized, "unauthorized")
+}
+
+func TestAdminLogin(t *testing.T) {
+	c := newClient(t)
+	c.token = ""
+
+	c.expect(http.MethodPost, "/v1/auth/login", models.AdminLoginRequest{Login: "root", Password: "Secret"}, http.StatusUnauthorized, nil)
+	c.expect(http.MethodPost, "/v1/auth/login", models.AdminLoginRequest{Login: "nobody", Password: "secret"}, http.StatusUnauthorized, nil)
+	c.expect(http.MethodPost, "/v1/auth/login", models.AdminLoginRequest{Login: "root", Password: "secret"}, http.StatusOK, nil)
+}
+
+func TestOTPLogin(t *testing.T) {
+	c := newClient(t)
+	c.create("/v1/customers", models.CreateCustomer{FullName: "Bob Smith", Phone: "+998901112233", Email: "bob@example.com"})
+	c.token = ""
+
+	verify := func(code string, status int) {
+		t.Helper()
+		c.expect(http.MethodPost, "/v1/auth/otp/verify", models.VerifyOTPRequest{Role: auth.RoleCustomer, Phone: "+998901112233", Code: code}, status, nil)
+	}
+
+	// a code is good for one login
+	c.sendOTP(auth.RoleCustomer, "+998901112233", "123456")
+	verify("123456", http.StatusOK)
+	verify("123456", http.StatusUnauthorized)
+
+	// and for a wrong guess short of the limit
+	c.sendOTP(auth.RoleCustomer, "+998901112233", "123456")
+	for i := 1; i < c.cfg.OTPMaxAttempts; i++ {
+		verify("654321", http.StatusUnauthorized)
+	}
+	verify("123456", http.StatusOK)
+
+	// the guess that reaches the limit kills the code
+	c.sendOTP(auth.RoleCustomer, "+998901112233", "123456")
+	for i := 0; i < c.cfg.OTPMaxAttempts; i++ {
+		verify("654321", http.StatusUnauthorized)
+	}
+	verify("123456", http.StatusUnauthorized)
+
+	// codes are per role
+	c.sendOTP(auth.RoleCustomer, "+998901112233", "123456")
+	c.expect(http.MethodPost, "/v1/auth/otp/verify", models.VerifyOTPRequest{Role: auth.RoleDriver, Phone: "+998901112233", Code: "123456"}, http.StatusUnauthorized, nil)
+}
+
+func TestCities(t *testing.T) {
+	c := newClient(t)
+
+	id := c.create("/v1/cities", models.CreateCity{Name: "Tashkent"})
+
+	city := models.City{}
+	c.expect(http.MethodGet, "/v1/cities/"+id, nil, http.StatusOK, &city)
+	if city.Name != "Tashkent" {
+		t.Errorf("got city %q, want Tashkent", city.Name)
+	}
+
+	c.expectError(http.MethodPost, "/v1/cities", models.CreateCity{}, http.StatusUnprocessableEntity, "validation_failed")
+	c.expectError(http.MethodGet, "/v1/cities/3f1f7b8e-52b4-4b7c-9d61-0d1c5c1f5e11", nil, http.StatusNotFound, "not_found")
+
+	if status, _ := c.do(http.MethodPatch, "/v1/cities/"+id, nil); status != http.StatusMethodNotAllowed {
+		t.Errorf("PATCH: got status %d, want %d", status, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestValidationReportsEveryField(t *testing.T) {
+	c := newClient(t)
+
+	e := models.Error{}
+	c.expect(http.MethodPost, "/v1/customers", models.CreateCustomer{Phone: "998901112233", Email: "bob"}, http.StatusUnprocessableEntity, &e)
+
+	got := map[string]string{}
+	for _, fieldErr := range e.Fields {
+		got[fieldErr.Field] = fieldErr.Message
+	}
+	for _, field := range []string{"full_name", "phone", "email"} {
+		if got[field] == "" {
+			t.Errorf("got fields %+v, want an error for %s", e.Fields, field)
+		}
+	}
+	if e.Code != "validation_failed" || len(e.Fields) != 3 {
+		t.Errorf("got %+v, want validation_failed with three fields", e)
+	}
+}
+
+func TestBooking(t *testing.T) {
+	c := newClient(t)
+
+	from := c.create("/v1/cities", models.CreateCity{Name: "Tashkent"})
+	to := c.create("/v1/cities", models.CreateCity{Name: "Samarkand"})
+	driver := c.create("/v1/drivers", models.CreateDriver{FullName: "Ali Valiyev", Phone: "+998901234567", FromCityID: from, ToCityID: to})
+	c.create("/v1/cars", models.CreateCar{Model: "Cobalt", Brand: "Chevrolet", Number: "01A123BC", Seats: 1, DriverID: driver})
+	trip := c.create("/v1/trips", models.CreateTrip{FromCityID: from, ToCityID: to, DriverID: driver, Price: 1000})
+	first := c.create("/v1/customers", models.CreateCustomer{FullName: "Bob Smith", Phone: "+998901112233", Email: "bob@example.com"})
+	second := c.create("/v1/customers", models.CreateCustomer{FullName: "Eve Adams", Phone: "+998901112244", Email: "eve@example.com"})
+
+	booking := c.create("/v1/trips/"+trip+"/customers", models.CreateTripCustomer{CustomerID: first})
+	c.expectError(http.MethodPost, "/v1/trips/"+trip+"/customers", models.CreateTripCustomer{CustomerID: first}, http.StatusConflict, "conflict")
+	c.expectError(http.MethodPost, "/v1/trips/"+trip+"/customers", models.CreateTripCustomer{CustomerID: second}, http.StatusConflict, "conflict")
+
+	// cancelling frees the seat
+	cancelled := models.TripCustomer{}
+	c.expect(http.MethodPost, "/v1/trip-customers/"+booking+"/cancel", models.CancelTripCustomerRequest{Reason: "plans changed"}, http.StatusOK, &cancelled)
+	if cancelled.Cancellation == nil || cancelled.Cancellation.Refund != 1000 {
+		t.Errorf("got cancellation %+v, want a full refund", cancelled.Cancellation)
+	}
+	c.create("/v1/trips/"+trip+"/customers", models.CreateTripCustomer{CustomerID: second})
+
+	list := models.TripCustomersResponse{}
+	c.expect(http.MethodGet, "/v1/trips/"+trip+"/customers?cancelled=false", nil, http.StatusOK, &list)
+	if len(list.TripCustomers) != 1 || list.TripCustomers[0].CustomerID != second {
+		t.Errorf("got bookings %+v, want only the second customer's", list.TripCustomers)
+	}
+}
+
+func TestCarNumberIsNormalized(t *testing.T) {
+	c := newClient(t)
+
+	id := c.create("/v1/cars", models.CreateCar{Model: "Cobalt", Brand: "Chevrolet", Number: "01 a 123 bc"})
+
+	car := models.Car{}
+	c.expect(http.MethodGet, "/v1/cars/"+id, nil, http.StatusOK, &car)
+	if car.Number != "01A123BC" {
+		t.Errorf("got number %q, want 01A123BC", car.Number)
+	}
+
+	c.expectError(http.MethodPost, "/v1/cars", models.CreateCar{Model: "Nexia", Brand: "Chevrolet", Number: "01A123BC"}, http.StatusConflict, "conflict")
+}
+
+func TestLegacyCarListByOrigin(t *testing.T) {
+	c := newClient(t)
+
+	tashkent := c.create("/v1/cities", models.CreateCity{Name: "Tashkent"})
+	samarkand := c.create("/v1/cities", models.CreateCity{Name: "Samarkand"})
+	bukhara := c.create("/v1/cities", models.CreateCity{Name: "Bukhara"})
+
+	// within the hour the availability search looks at by default
+	departure := time.Now().Add(30 * time.Minute).UTC().Truncate(time.Second)
+	route := func(number, from, to string) string {
+		id := c.create("/v1/cars", models.CreateCar{Model: "Cobalt", Brand: "Chevrolet", Number: number})
+		c.expect(http.MethodPut, "/v1/cars/"+id+"/route", models.UpdateCarRoute{FromCityID: from, ToCityID: to, DepartureTime: departure}, http.StatusOK, nil)
+		return id
+	}
+	fromTashkent := route("01A123BC", tashkent, samarkand)
+	route("01A124BC", bukhara, tashkent)
+
+	cars := models.CarsResponse{}
+	c.expect(http.MethodGet, "/car?from_city_id="+tashkent, nil, http.StatusOK, &cars)
+	if len(cars.Cars) != 1 || cars.Cars[0].ID != fromTashkent {
+		t.Errorf("filtering by origin: got %+v, want only %s", cars.Cars, fromTashkent)
+	}
+
+	cars = models.CarsResponse{}
+	c.expect(http.MethodGet, "/car?from_city_id="+tashkent+"&to_city_id="+samarkand, nil, http.StatusOK, &cars)
+	if len(cars.Cars) != 1 || cars.Cars[0].ID != fromTashkent {
+		t.Errorf("searching the route: got %+v, want only %s", cars.Cars, fromTashkent)
+	}
+
+	c.expect(http.MethodGet, "/car?from_city_id="+tashkent+"&available=true", nil, http.StatusBadRequest, nil)
+}
+
+func TestOwnRecordsOnly(t *testing.T) {
+	c := newClient(t)
+
+	from := c.create("/v1/cities", models.CreateCity{Name: "Tashkent"})
+	to := c.create("/v1/cities", models.CreateCity{Name: "Samarkand"})
+	ali := c.create("/v1/drivers", models.CreateDriver{FullName: "Ali Valiyev", Phone: "+998901234567", FromCityID: from, ToCityID: to})
+	vali := c.create("/v1/drivers", models.CreateDriver{FullName: "Vali Aliyev", Phone: "+998901234568", FromCityID: from, ToCityID: to})
+	aliCar := c.create("/v1/cars", models.CreateCar{Model: "Cobalt", Brand: "Chevrolet", Number: "01A123BC", DriverID: ali})
+	valiCar := c.create("/v1/cars", models.CreateCar{Model: "Nexia", Brand: "Chevrolet", Number: "01A124BC", DriverID: vali})
+	aliTrip := c.create("/v1/trips", models.CreateTrip{FromCityID: from, ToCityID: to, DriverID: ali, Price: 1000})
+	valiTrip := c.create("/v1/trips", models.CreateTrip{FromCityID: from, ToCityID: to, DriverID: vali, Price: 1000})
+	bob := c.create("/v1/customers", models.CreateCustomer{FullName: "Bob Smith", Phone: "+998901112233", Email: "bob@example.com"})
+	eve := c.create("/v1/customers", models.CreateCustomer{FullName: "Eve Adams", Phone: "+998901112244", Email: "eve@example.com"})
+	bobBooking := c.create("/v1/trips/"+aliTrip+"/customers", models.CreateTripCustomer{CustomerID: bob})
+	eveBooking := c.create("/v1/trips/"+aliTrip+"/customers", models.CreateTripCustomer{CustomerID: eve})
+
+	t.Run("customer", func(t *testing.T) {
+		customer := c.login(auth.RoleCustomer, "+998901112233")
+		customer.t = t
+
+		customer.expect(http.MethodGet, "/v1/trip-customers/"+bobBooking, nil, http.StatusOK, nil)
+		customer.expectError(http.MethodGet, "/v1/trip-customers/"+eveBooking, nil, http.StatusForbidden, "forbidden")
+		customer.expectError(http.MethodPost, "/v1/trip-customers/"+eveBooking+"/cancel", models.CancelTripCustomerRequest{Reason: "not mine"}, http.StatusForbidden, "forbidden")
+
+		booking := models.TripCustomer{}
+		c.expect(http.MethodGet, "/v1/trip-customers/"+eveBooking, nil, http.StatusOK, &booking)
+		if booking.Cancellation != nil {
+			t.Errorf("got cancellation %+v, want the booking left alone", booking.Cancellation)
+		}
+	})
+
+	t.Run("driver", func(t *testing.T) {
+		driver := c.login(auth.RoleDriver, "+998901234567")
+		driver.t = t
+
+		route := models.UpdateCarRoute{FromCityID: from, ToCityID: to, DepartureTime: time.Now().Add(time.Hour).UTC().Truncate(time.Second)}
+		driver.expect(http.MethodPut, "/v1/cars/"+aliCar+"/route", route, http.StatusOK, nil)
+		driver.expectError(http.MethodPut, "/v1/cars/"+valiCar+"/route", route, http.StatusForbidden, "forbidden")
+
+		driver.expect(http.MethodPost, "/v1/trips/"+aliTrip+"/board", nil, http.StatusOK, nil)
+		driver.expectError(http.MethodPost, "/v1/trips/"+valiTrip+"/board", nil, http.StatusForbidden, "forbidden")
+		driver.expectError(http.MethodPost, "/v1/trips/"+valiTrip+"/cancel", nil, http.StatusForbidden, "forbidden")
+
+		trip := models.Trip{}
+		c.expect(http.MethodGet, "/v1/trips/"+valiTrip, nil, http.StatusOK, &trip)
+		if trip.Status != models.TripScheduled {
+			t.Errorf("got status %q, want %q", trip.Status, models.TripScheduled)
+		}
+	})
+
+	t.Run("dispatcher", func(t *testing.T) {
+		c.create("/v1/admins", models.CreateAdmin{Login: "dispatch", Password: "password1", Role: auth.RoleDispatcher})
+
+		dispatcher := c
+		dispatcher.t = t
+		tokens := auth.TokenPair{}
+		dispatcher.expect(http.MethodPost, "/v1/auth/login", models.AdminLoginRequest{Login: "dispatch", Password: "password1"}, http.StatusOK, &tokens)
+		dispatcher.token = tokens.AccessToken
+
+		dispatcher.expect(http.MethodGet, "/v1/trip-customers/"+eveBooking, nil, http.StatusOK, nil)
+		dispatcher.expectError(http.MethodDelete, "/v1/trip-customers/"+eveBooking, nil, http.StatusForbidden, "forbidden")
+		dispatcher.expectError(http.MethodPost, "/v1/drivers", models.CreateDriver{FullName: "Sardor Karimov", Phone: "+998901234569", FromCityID: from, ToCityID: to}, http.StatusForbidden, "forbidden")
+
+		c.expect(http.MethodGet, "/v1/trip-customers/"+eveBooking, nil, http.StatusOK, nil)
+	})
+}
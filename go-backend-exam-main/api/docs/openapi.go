@@ -0,0 +1,321 @@
+// Package docs builds the OpenAPI 3 description of the API and serves it,
+// together with a self-contained docs page.
+//
+// The served openapi.json is generated from the operation table in package
+// api and committed; "go run ./cmd openapi check" fails when it is stale.
+package docs
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem maps lower case methods to their operations.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	Tags        []string              `json:"tags,omitempty"`
+	Summary     string                `json:"summary"`
+	OperationID string                `json:"operationId"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security"`
+}
+
+type Parameter struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Schema      Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema Schema `json:"schema"`
+}
+
+type Response struct {
+	Ref         string               `json:"$ref,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// Schema is a JSON schema object.
+type Schema map[string]interface{}
+
+type Components struct {
+	Schemas         map[string]Schema         `json:"schemas"`
+	Responses       map[string]Response       `json:"responses"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// Op describes one endpoint. Body and Data are zero values of the request
+// model and of the response Data; a nil Data means a plain message.
+// Produces is set for the few endpoints answering outside the envelope.
+type Op struct {
+	Method     string
+	Path       string
+	Tag        string
+	Summary    string
+	Public     bool
+	Deprecated bool
+	Status     int
+	Produces   string
+	Query      []Param
+	Body       interface{}
+	Data       interface{}
+}
+
+// Param is a query parameter. Type is a JSON schema type, with format after
+// a colon as in "string:date".
+type Param struct {
+	Name        string
+	Type        string
+	Description string
+	Required    bool
+}
+
+// errorStatuses are the error responses every operation may give.
+var errorStatuses = []int{
+	http.StatusBadRequest,
+	http.StatusUnauthorized,
+	http.StatusForbidden,
+	http.StatusNotFound,
+	http.StatusConflict,
+	http.StatusUnprocessableEntity,
+	http.StatusInternalServerError,
+}
+
+// Build describes ops. Schemas of the models they use, and of the models
+// those nest, go to components.
+func Build(info Info, errorModel interface{}, ops []Op) Document {
+	doc := Document{
+		OpenAPI: "3.0.3",
+		Info:    info,
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas:   map[string]Schema{},
+			Responses: map[string]Response{},
+			SecuritySchemes: map[string]SecurityScheme{
+				"bearer": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			},
+		},
+	}
+
+	doc.Components.Responses["Error"] = Response{
+		Description: "Error. Data carries a machine-readable code, a message and, for 422, the invalid fields.",
+		Content:     jsonContent(envelope(doc.schema(reflect.TypeOf(errorModel)))),
+	}
+
+	for _, op := range ops {
+		if doc.Paths[op.Path] == nil {
+			doc.Paths[op.Path] = PathItem{}
+		}
+		doc.Paths[op.Path][strings.ToLower(op.Method)] = doc.operation(op)
+	}
+
+	return doc
+}
+
+func (doc Document) operation(op Op) *Operation {
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	data := Schema{"type": "string"}
+	if op.Data != nil {
+		data = doc.schema(reflect.TypeOf(op.Data))
+	}
+
+	content := jsonContent(envelope(data))
+	if op.Produces != "" {
+		content = map[string]MediaType{op.Produces: {Schema: Schema{"type": "string"}}}
+	}
+
+	operation := &Operation{
+		Tags:        []string{op.Tag},
+		Summary:     op.Summary,
+		OperationID: operationID(op),
+		Deprecated:  op.Deprecated,
+		Responses: map[string]Response{
+			fmt.Sprint(status): {Description: http.StatusText(status), Content: content},
+		},
+		Security: []map[string][]string{{"bearer": {}}},
+	}
+	if op.Public {
+		operation.Security = []map[string][]string{}
+	}
+
+	for _, segment := range strings.Split(op.Path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			operation.Parameters = append(operation.Parameters, Parameter{
+				Name: segment[1 : len(segment)-1], In: "path", Required: true, Schema: Schema{"type": "string"},
+			})
+		}
+	}
+
+	for _, param := range op.Query {
+		operation.Parameters = append(operation.Parameters, Parameter{
+			Name: param.Name, In: "query", Description: param.Description, Required: param.Required, Schema: typeSchema(param.Type),
+		})
+	}
+
+	if op.Body != nil {
+		operation.RequestBody = &RequestBody{Required: true, Content: jsonContent(doc.schema(reflect.TypeOf(op.Body)))}
+	}
+
+	for _, status := range errorStatuses {
+		if op.Produces != "" {
+			break
+		}
+		operation.Responses[fmt.Sprint(status)] = Response{Ref: "#/components/responses/Error"}
+	}
+
+	return operation
+}
+
+// schema describes t the way encoding/json writes it. Named structs become
+// components referred to by name.
+func (doc Document) schema(t reflect.Type) Schema {
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return Schema{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Pointer:
+		schema := doc.schema(t.Elem())
+		if _, isRef := schema["$ref"]; isRef {
+			return Schema{"allOf": []Schema{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return Schema{"type": "array", "items": doc.schema(t.Elem())}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": doc.schema(t.Elem())}
+	case reflect.Struct:
+		if _, ok := doc.Components.Schemas[t.Name()]; !ok {
+			// registered before its fields so that recursive types end
+			doc.Components.Schemas[t.Name()] = Schema{}
+			doc.Components.Schemas[t.Name()] = doc.object(t)
+		}
+		return Schema{"$ref": "#/components/schemas/" + t.Name()}
+	default:
+		return Schema{}
+	}
+}
+
+// object lists the JSON properties of struct t, flattening embedded structs
+// like encoding/json does.
+func (doc Document) object(t reflect.Type) Schema {
+	properties := Schema{}
+
+	var fields func(t reflect.Type)
+	fields = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+				fields(field.Type)
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+
+			properties[name] = doc.schema(field.Type)
+		}
+	}
+	fields(t)
+
+	return Schema{"type": "object", "properties": properties}
+}
+
+// envelope is models.Response around data.
+func envelope(data Schema) Schema {
+	return Schema{
+		"type": "object",
+		"properties": Schema{
+			"StatusCode":  Schema{"type": "integer"},
+			"Description": Schema{"type": "string"},
+			"Data":        data,
+		},
+	}
+}
+
+func jsonContent(schema Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: schema}}
+}
+
+func typeSchema(t string) Schema {
+	typ, format, ok := strings.Cut(t, ":")
+	if !ok {
+		return Schema{"type": typ}
+	}
+	return Schema{"type": typ, "format": format}
+}
+
+// operationID is the method followed by the literal path segments, such
+// as getV1CitiesById.
+func operationID(op Op) string {
+	id := strings.ToLower(op.Method)
+	for _, segment := range strings.Split(op.Path, "/") {
+		if segment == "" {
+			continue
+		}
+		if strings.HasPrefix(segment, "{") {
+			segment = "by_" + strings.Trim(segment, "{}")
+		}
+		for _, word := range strings.FieldsFunc(segment, func(r rune) bool { return r == '-' || r == '_' || r == '.' }) {
+			id += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return id
+}
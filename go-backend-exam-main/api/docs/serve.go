@@ -0,0 +1,27 @@
+package docs
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// OpenAPI is the generated document, api/docs/openapi.json.
+//
+//go:embed openapi.json
+var OpenAPI []byte
+
+//go:embed docs.html
+var page []byte
+
+// ServeOpenAPI writes the OpenAPI document.
+func ServeOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(OpenAPI)
+}
+
+// ServeDocs writes a page rendering the OpenAPI document, with a form to
+// try each operation.
+func ServeDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"city2city/api/models"
+	"city2city/auth"
+	"city2city/policy"
+	"city2city/validation"
+)
+
+// Admin handles POST /v1/admins, which creates staff accounts. Only admins may
+// call it.
+func (h Handler) Admin(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorize(w, r, policy.Create, policy.Admin); !ok {
+		return
+	}
+
+	createAdmin := models.CreateAdmin{}
+	if err := json.NewDecoder(r.Body).Decode(&createAdmin); err != nil {
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := validation.CreateAdmin(createAdmin); err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	hash, err := auth.HashPassword(createAdmin.Password)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+	createAdmin.PasswordHash = hash
+
+	id, err := h.storage.Admin().Create(r.Context(), createAdmin)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	admin, err := h.storage.Admin().Get(r.Context(), id)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	h.handleResponse(w, r, http.StatusCreated, admin)
+}
@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"city2city/api/models"
+	"city2city/auth"
+	"city2city/storage"
+)
+
+// SendOTP handles POST /v1/auth/otp. It answers the same way whether or not
+// the phone belongs to someone, so it cannot be used to probe for users.
+func (h Handler) SendOTP(w http.ResponseWriter, r *http.Request) {
+	req := models.SendOTPRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.Role != auth.RoleCustomer && req.Role != auth.RoleDriver {
+		h.handleResponse(w, r, http.StatusBadRequest, "role must be customer or driver")
+		return
+	}
+
+	_, err := h.subjectByPhone(r.Context(), req.Role, req.Phone)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		h.handleResponse(w, r, http.StatusOK, "code sent")
+		return
+	case err != nil:
+		h.handleError(w, r, err)
+		return
+	}
+
+	code, err := auth.NewOTP()
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	if err = h.storage.OTP().Save(r.Context(), models.OTP{
+		Role:      req.Role,
+		Phone:     req.Phone,
+		CodeHash:  auth.HashOTP(code),
+		ExpiresAt: time.Now().UTC().Add(h.cfg.OTPTTL),
+	}); err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	if err = h.otp.SendOTP(r.Context(), req.Phone, code); err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	h.log.InfoContext(r.Context(), "otp code issued",
+		slog.String("role", req.Role),
+		slog.String("phone", req.Phone),
+	)
+
+	h.handleResponse(w, r, http.StatusOK, "code sent")
+}
+
+// VerifyOTP handles POST /v1/auth/otp/verify and exchanges a valid code for
+// tokens. A code is used once and dies after h.cfg.OTPMaxAttempts wrong
+// guesses.
+func (h Handler) VerifyOTP(w http.ResponseWriter, r *http.Request) {
+	req := models.VerifyOTPRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// the attempt is counted before the code is checked, so parallel
+	// guesses cannot get past h.cfg.OTPMaxAttempts
+	otp, err := h.storage.OTP().Attempt(r.Context(), req.Role, req.Phone)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		h.handleResponse(w, r, http.StatusUnauthorized, "invalid code")
+		return
+	case err != nil:
+		h.handleError(w, r, err)
+		return
+	}
+
+	if time.Now().After(otp.ExpiresAt) {
+		h.storage.OTP().Delete(r.Context(), req.Role, req.Phone)
+		h.handleResponse(w, r, http.StatusUnauthorized, "code has expired")
+		return
+	}
+
+	if otp.Attempts > h.cfg.OTPMaxAttempts || !auth.CheckOTP(otp.CodeHash, req.Code) {
+		if otp.Attempts >= h.cfg.OTPMaxAttempts {
+			err = h.storage.OTP().Delete(r.Context(), req.Role, req.Phone)
+		}
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			h.handleError(w, r, err)
+			return
+		}
+		h.handleResponse(w, r, http.StatusUnauthorized, "invalid code")
+		return
+	}
+
+	// a parallel request may have used the code first
+	err = h.storage.OTP().Delete(r.Context(), req.Role, req.Phone)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		h.handleResponse(w, r, http.StatusUnauthorized, "invalid code")
+		return
+	case err != nil:
+		h.handleError(w, r, err)
+		return
+	}
+
+	subject, err := h.subjectByPhone(r.Context(), req.Role, req.Phone)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		h.handleResponse(w, r, http.StatusUnauthorized, "invalid code")
+		return
+	case err != nil:
+		h.handleError(w, r, err)
+		return
+	}
+
+	h.issueTokens(w, r, auth.Identity{Subject: subject, Role: req.Role})
+}
+
+// AdminLogin handles POST /v1/auth/login for staff: admins and dispatchers.
+func (h Handler) AdminLogin(w http.ResponseWriter, r *http.Request) {
+	req := models.AdminLoginRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	admin, err := h.storage.Admin().GetByLogin(r.Context(), req.Login)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		h.handleResponse(w, r, http.StatusUnauthorized, "invalid login or password")
+		return
+	case err != nil:
+		h.handleError(w, r, err)
+		return
+	}
+
+	if !auth.CheckPassword(admin.PasswordHash, req.Password) {
+		h.handleResponse(w, r, http.StatusUnauthorized, "invalid login or password")
+		return
+	}
+
+	h.issueTokens(w, r, auth.Identity{Subject: admin.ID, Role: admin.Role})
+}
+
+// Refresh handles POST /v1/auth/refresh, trading a refresh token for a new
+// pair as long as its subject still exists.
+func (h Handler) Refresh(w http.ResponseWriter, r *http.Request) {
+	req := models.RefreshRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	claims, err := h.tokens.Verify(req.RefreshToken, auth.TypeRefresh)
+	if err != nil {
+		h.handleResponse(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	switch claims.Role {
+	case auth.RoleAdmin, auth.RoleDispatcher:
+		var admin models.Admin
+		admin, err = h.storage.Admin().Get(r.Context(), claims.Subject)
+		if err == nil && admin.Role != claims.Role {
+			err = storage.ErrNotFound
+		}
+	case auth.RoleCustomer:
+		_, err = h.storage.Customer().Get(r.Context(), claims.Subject)
+	case auth.RoleDriver:
+		_, err = h.storage.Driver().Get(r.Context(), claims.Subject, models.Expand{})
+	default:
+		err = storage.ErrNotFound
+	}
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		h.handleResponse(w, r, http.StatusUnauthorized, auth.ErrInvalidToken.Error())
+		return
+	case err != nil:
+		h.handleError(w, r, err)
+		return
+	}
+
+	h.issueTokens(w, r, auth.Identity{Subject: claims.Subject, Role: claims.Role})
+}
+
+// Authenticate lets a request through to next only with a valid bearer
+// access token, and puts the caller's identity into its context.
+func (h Handler) Authenticate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer`)
+			h.handleResponse(w, r, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+
+		claims, err := h.tokens.Verify(token, auth.TypeAccess)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			h.handleResponse(w, r, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		identity := auth.Identity{Subject: claims.Subject, Role: claims.Role}
+		next(w, r.WithContext(auth.WithIdentity(r.Context(), identity)))
+	}
+}
+
+func (h Handler) issueTokens(w http.ResponseWriter, r *http.Request, identity auth.Identity) {
+	tokens, err := h.tokens.Issue(identity)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	h.handleResponse(w, r, http.StatusOK, tokens)
+}
+
+// subjectByPhone finds the id of the customer or driver with phone.
+func (h Handler) subjectByPhone(ctx context.Context, role, phone string) (string, error) {
+	if role == auth.RoleDriver {
+		driver, err := h.storage.Driver().GetByPhone(ctx, phone)
+		return driver.ID, err
+	}
+
+	customer, err := h.storage.Customer().GetByPhone(ctx, phone)
+	return customer.ID, err
+}
@@ -3,10 +3,13 @@ package handler
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
+	"time"
 
 	"city2city/api/models"
+	"city2city/api/router"
+	"city2city/policy"
+	"city2city/validation"
 )
 
 func (h Handler) Car(w http.ResponseWriter, r *http.Request) {
@@ -15,10 +18,14 @@ func (h Handler) Car(w http.ResponseWriter, r *http.Request) {
 		h.CreateCar(w, r)
 	case http.MethodGet:
 		values := r.URL.Query()
-		if _, ok := values["id"]; !ok {
-			h.GetCarList(w, r)
-		} else {
+		if _, ok := values["id"]; ok {
 			h.GetCarByID(w, r)
+		} else if values.Has("from_city_id") && values.Has("to_city_id") || values.Get("available") == "true" {
+			// a route, or an explicit ask, is the availability search; a
+			// single city is a filter of the plain list
+			h.GetAvailableCarList(w, r)
+		} else {
+			h.GetCarList(w, r)
 		}
 	case http.MethodPut:
 		values := r.URL.Query()
@@ -32,157 +39,308 @@ func (h Handler) Car(w http.ResponseWriter, r *http.Request) {
 	case http.MethodDelete:
 		h.DeleteCar(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		methodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete)
 	}
 }
 
 func (h Handler) CreateCar(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorize(w, r, policy.Create, policy.Car); !ok {
+		return
+	}
+
 	createCar := models.CreateCar{}
 
 	if err := json.NewDecoder(r.Body).Decode(&createCar); err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleResponse(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	createCar.Number = models.CarNumber(createCar.Number)
+	if err := validation.CreateCar(createCar); err != nil {
+		h.handleError(w, r, err)
 		return
 	}
 
-	id, err := h.storage.Car().Create(createCar)
+	id, err := h.storage.Car().Create(r.Context(), createCar)
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
 		return
 	}
 
-	car, err := h.storage.Car().Get(id)
+	car, err := h.storage.Car().Get(r.Context(), id, parseExpand(r))
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusCreated, car)
+	h.handleResponse(w, r, http.StatusCreated, car)
 }
 
 func (h Handler) GetCarByID(w http.ResponseWriter, r *http.Request) {
-	values := r.URL.Query()
-	if len(values["id"]) <= 0 {
-		handleResponse(w, http.StatusBadRequest, errors.New("id is required"))
+	if _, ok := h.authorize(w, r, policy.Read, policy.Car); !ok {
+		return
+	}
+
+	id := param(r, "id")
+	if id == "" {
+		h.handleResponse(w, r, http.StatusBadRequest, errors.New("id is required"))
 		return
 	}
-	id := values["id"][0]
 
-	car, err := h.storage.Car().Get(id)
+	car, err := h.storage.Car().Get(r.Context(), id, parseExpand(r))
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
+		return
+	}
+
+	if !h.authorizeRecord(w, r, policy.Read, policy.Car, policy.Record{DriverID: car.DriverID}) {
 		return
 	}
 
-	handleResponse(w, http.StatusOK, car)
+	h.handleResponse(w, r, http.StatusOK, car)
 }
 
+// GetCarList filters by status, brand, driver_id, from_city_id, to_city_id
+// and the departure_from/departure_to window (RFC 3339).
 func (h Handler) GetCarList(w http.ResponseWriter, r *http.Request) {
+	decision, ok := h.authorize(w, r, policy.List, policy.Car)
+	if !ok {
+		return
+	}
+
+	listReq, err := h.parseListRequest(r, models.CarSortFields)
+	if err != nil {
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	values := r.URL.Query()
+	req := models.GetCarListRequest{
+		GetListRequest: listReq,
+		Brand:          values.Get("brand"),
+		DriverID:       values.Get("driver_id"),
+		FromCityID:     values.Get("from_city_id"),
+		ToCityID:       values.Get("to_city_id"),
+	}
+
+	if decision.OwnOnly {
+		req.DriverID = caller(r).Subject
+	}
+
+	if req.Status, err = queryBool(values, "status"); err != nil {
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.DepartureFrom, err = queryTime(values, "departure_from"); err != nil {
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.DepartureTo, err = queryTime(values, "departure_to"); err != nil {
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := h.storage.Car().GetList(r.Context(), req)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	h.handleResponse(w, r, http.StatusOK, resp)
+}
+
+// GetAvailableCarList returns online cars on the from_city_id -> to_city_id
+// route departing between departure_from and departure_to (RFC 3339). The
+// window defaults to the next hour; the other list parameters apply as usual.
+func (h Handler) GetAvailableCarList(w http.ResponseWriter, r *http.Request) {
+	decision, ok := h.authorize(w, r, policy.List, policy.Car)
+	if !ok {
+		return
+	}
+
+	listReq, err := h.parseListRequest(r, models.CarSortFields)
+	if err != nil {
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(listReq.Sort) == 0 {
+		listReq.Sort = []models.SortField{{Field: "departure_time"}}
+	}
+
 	var (
-		cars  = []models.Car{}
-		count int
+		values = r.URL.Query()
+		online = true
+		req    = models.GetCarListRequest{
+			GetListRequest: listReq,
+			Status:         &online,
+			Brand:          values.Get("brand"),
+			FromCityID:     values.Get("from_city_id"),
+			ToCityID:       values.Get("to_city_id"),
+		}
 	)
 
-	// Data query
-	req := models.GetListRequest{
-		Page:  1,
-		Limit: 10,
+	if req.FromCityID == "" || req.ToCityID == "" {
+		h.handleResponse(w, r, http.StatusBadRequest, "from_city_id and to_city_id are required")
+		return
+	}
+
+	if decision.OwnOnly {
+		req.DriverID = caller(r).Subject
 	}
 
-	resp, err := h.storage.Car().GetList(req)
-	if err != nil {
-		fmt.Println("Error in GetList:", err) // Hatanın ayrıntılarını yazdır
-		handleResponse(w, http.StatusInternalServerError, err)
+	if req.DepartureFrom, err = queryTime(values, "departure_from"); err != nil {
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
+	if req.DepartureFrom.IsZero() {
+		req.DepartureFrom = time.Now()
+	}
 
-	cars = resp.Cars
-	count = resp.Count
+	if req.DepartureTo, err = queryTime(values, "departure_to"); err != nil {
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.DepartureTo.IsZero() {
+		req.DepartureTo = req.DepartureFrom.Add(time.Hour)
+	}
+
+	resp, err := h.storage.Car().GetList(r.Context(), req)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
 
-	handleResponse(w, http.StatusOK, models.CarsResponse{
-		Cars:  cars,
-		Count: count,
-	})
+	h.handleResponse(w, r, http.StatusOK, resp)
 }
 
 func (h Handler) UpdateCar(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorize(w, r, policy.Update, policy.Car); !ok {
+		return
+	}
+
 	updateCar := models.Car{}
 
 	if err := json.NewDecoder(r.Body).Decode(&updateCar); err != nil {
-		handleResponse(w, http.StatusBadRequest, err.Error())
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if id := router.Param(r, "id"); id != "" {
+		updateCar.ID = id
+	}
+
+	updateCar.Number = models.CarNumber(updateCar.Number)
+	if err := validation.UpdateCar(updateCar); err != nil {
+		h.handleError(w, r, err)
 		return
 	}
 
-	id, err := h.storage.Car().Update(updateCar)
+	id, err := h.storage.Car().Update(r.Context(), updateCar)
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err.Error())
+		h.handleError(w, r, err)
 		return
 	}
 
-	car, err := h.storage.Car().Get(id)
+	car, err := h.storage.Car().Get(r.Context(), id, parseExpand(r))
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err.Error())
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusOK, car)
+	h.handleResponse(w, r, http.StatusOK, car)
 }
 
 func (h Handler) DeleteCar(w http.ResponseWriter, r *http.Request) {
-	values := r.URL.Query()
-	if len(values["id"]) <= 0 {
-		handleResponse(w, http.StatusBadRequest, errors.New("id is required"))
+	if _, ok := h.authorize(w, r, policy.Delete, policy.Car); !ok {
+		return
+	}
+
+	id := param(r, "id")
+	if id == "" {
+		h.handleResponse(w, r, http.StatusBadRequest, errors.New("id is required"))
 		return
 	}
-	id := values["id"][0]
 
-	if err := h.storage.Car().Delete(id); err != nil {
-		handleResponse(w, http.StatusNotFound, err)
+	if err := h.storage.Car().Delete(r.Context(), id); err != nil {
+		h.handleError(w, r, err)
 		return
-	} else {
-		handleResponse(w, http.StatusInternalServerError, err)
 	}
 
-	handleResponse(w, http.StatusOK, "data succesfully deleted")
+	h.handleResponse(w, r, http.StatusOK, "data succesfully deleted")
 }
 
 func (h Handler) UpdateCarRoute(w http.ResponseWriter, r *http.Request) {
 	updateCarRoute := models.UpdateCarRoute{}
 
 	if err := json.NewDecoder(r.Body).Decode(&updateCarRoute); err != nil {
-		handleResponse(w, http.StatusBadRequest, err.Error())
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	if len(updateCarRoute.CarID) == 0 {
-		handleResponse(w, http.StatusBadRequest, errors.New("CarID is required"))
+	if id := router.Param(r, "id"); id != "" {
+		updateCarRoute.CarID = id
+	}
+
+	if err := validation.UpdateCarRoute(updateCarRoute); err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	if !h.authorizeCar(w, r, policy.UpdateRoute, updateCarRoute.CarID) {
 		return
 	}
 
-	if err := h.storage.Car().UpdateCarRoute(updateCarRoute); err != nil {
-		handleResponse(w, http.StatusInternalServerError, err.Error())
+	if err := h.storage.Car().UpdateCarRoute(r.Context(), updateCarRoute); err != nil {
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusOK, "Car route successfully updated")
+	h.handleResponse(w, r, http.StatusOK, "Car route successfully updated")
 }
 
 func (h Handler) UpdateCarStatus(w http.ResponseWriter, r *http.Request) {
 	updateCarStatus := models.UpdateCarStatus{}
 
 	if err := json.NewDecoder(r.Body).Decode(&updateCarStatus); err != nil {
-		handleResponse(w, http.StatusBadRequest, err.Error())
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	if len(updateCarStatus.ID) == 0 {
-		handleResponse(w, http.StatusBadRequest, errors.New("ID is required"))
+	if id := router.Param(r, "id"); id != "" {
+		updateCarStatus.ID = id
+	}
+
+	if err := validation.UpdateCarStatus(updateCarStatus); err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	if !h.authorizeCar(w, r, policy.UpdateStatus, updateCarStatus.ID) {
 		return
 	}
 
-	if err := h.storage.Car().UpdateCarStatus(updateCarStatus); err != nil {
-		handleResponse(w, http.StatusInternalServerError, err.Error())
+	if err := h.storage.Car().UpdateCarStatus(r.Context(), updateCarStatus); err != nil {
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusOK, "Car status updated successfully")
+	h.handleResponse(w, r, http.StatusOK, "Car status updated successfully")
+}
+
+// authorizeCar checks action on the car with id, loading the car only when
+// the caller is limited to their own.
+func (h Handler) authorizeCar(w http.ResponseWriter, r *http.Request, action policy.Action, id string) bool {
+	decision, ok := h.authorize(w, r, action, policy.Car)
+	if !ok || !decision.OwnOnly {
+		return ok
+	}
+
+	car, err := h.storage.Car().Get(r.Context(), id, models.Expand{})
+	if err != nil {
+		h.handleError(w, r, err)
+		return false
+	}
+
+	return h.authorizeRecord(w, r, action, policy.Car, policy.Record{DriverID: car.DriverID})
 }
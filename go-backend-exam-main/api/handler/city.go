@@ -6,6 +6,9 @@ import (
 	"net/http"
 
 	"city2city/api/models"
+	"city2city/api/router"
+	"city2city/policy"
+	"city2city/validation"
 )
 
 func (h Handler) City(w http.ResponseWriter, r *http.Request) {
@@ -15,7 +18,7 @@ func (h Handler) City(w http.ResponseWriter, r *http.Request) {
 	case http.MethodGet:
 		values := r.URL.Query()
 		if _, ok := values["id"]; !ok {
-			h.GetCityList(w)
+			h.GetCityList(w, r)
 		} else {
 			h.GetCityByID(w, r)
 		}
@@ -23,105 +26,137 @@ func (h Handler) City(w http.ResponseWriter, r *http.Request) {
 		h.UpdateCity(w, r)
 	case http.MethodDelete:
 		h.DeleteCity(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete)
 	}
 }
 
 func (h Handler) CreateCity(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorize(w, r, policy.Create, policy.City); !ok {
+		return
+	}
+
 	createCity := models.CreateCity{}
 
 	if err := json.NewDecoder(r.Body).Decode(&createCity); err != nil {
-		handleResponse(w, http.StatusBadRequest, err)
+		h.handleResponse(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validation.CreateCity(createCity); err != nil {
+		h.handleError(w, r, err)
 		return
 	}
 
-	pKey, err := h.storage.City().Create(createCity)
+	pKey, err := h.storage.City().Create(r.Context(), createCity)
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
 		return
 	}
 
-	user, err := h.storage.City().Get(pKey)
+	user, err := h.storage.City().Get(r.Context(), pKey)
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusCreated, user)
+	h.handleResponse(w, r, http.StatusCreated, user)
 }
 
 func (h Handler) GetCityByID(w http.ResponseWriter, r *http.Request) {
-	values := r.URL.Query()
-	if len(values["id"]) <= 0 {
-		handleResponse(w, http.StatusBadRequest, errors.New("id is required"))
+	if _, ok := h.authorize(w, r, policy.Read, policy.City); !ok {
 		return
 	}
 
-	id := values["id"][0]
+	id := param(r, "id")
+	if id == "" {
+		h.handleResponse(w, r, http.StatusBadRequest, errors.New("id is required"))
+		return
+	}
 	var err error
 
-	city, err := h.storage.City().Get(id)
+	city, err := h.storage.City().Get(r.Context(), id)
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusOK, city)
+	h.handleResponse(w, r, http.StatusOK, city)
 }
 
-func (h Handler) GetCityList(w http.ResponseWriter) {
-	var (
-		page, limit = 1, 10
-		err         error
-	)
+func (h Handler) GetCityList(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorize(w, r, policy.List, policy.City); !ok {
+		return
+	}
+
+	listReq, err := h.parseListRequest(r, models.CitySortFields)
+	if err != nil {
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	resp, err := h.storage.City().GetList(models.GetListRequest{
-		Page:  page,
-		Limit: limit,
+	resp, err := h.storage.City().GetList(r.Context(), models.GetCityListRequest{
+		GetListRequest: listReq,
 	})
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusOK, resp)
+	h.handleResponse(w, r, http.StatusOK, resp)
 }
 
 func (h Handler) UpdateCity(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorize(w, r, policy.Update, policy.City); !ok {
+		return
+	}
+
 	city := models.City{}
 
 	if err := json.NewDecoder(r.Body).Decode(&city); err != nil {
-		handleResponse(w, http.StatusBadRequest, err.Error())
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if id := router.Param(r, "id"); id != "" {
+		city.ID = id
+	}
+
+	if err := validation.UpdateCity(city); err != nil {
+		h.handleError(w, r, err)
 		return
 	}
 
-	pKey, err := h.storage.City().Update(city)
+	pKey, err := h.storage.City().Update(r.Context(), city)
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err.Error())
+		h.handleError(w, r, err)
 		return
 	}
 
-	user, err := h.storage.City().Get(pKey)
+	user, err := h.storage.City().Get(r.Context(), pKey)
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusOK, user)
+	h.handleResponse(w, r, http.StatusOK, user)
 }
 
 func (h Handler) DeleteCity(w http.ResponseWriter, r *http.Request) {
-	values := r.URL.Query()
-	if len(values["id"]) <= 0 {
-		handleResponse(w, http.StatusBadRequest, errors.New("id is required"))
+	if _, ok := h.authorize(w, r, policy.Delete, policy.City); !ok {
 		return
 	}
 
-	id := values["id"][0]
+	id := param(r, "id")
+	if id == "" {
+		h.handleResponse(w, r, http.StatusBadRequest, errors.New("id is required"))
+		return
+	}
 
-	if err := h.storage.City().Delete(id); err != nil {
-		handleResponse(w, http.StatusInternalServerError, err.Error())
+	if err := h.storage.City().Delete(r.Context(), id); err != nil {
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusOK, "data successfully deleted")
+	h.handleResponse(w, r, http.StatusOK, "data successfully deleted")
 }
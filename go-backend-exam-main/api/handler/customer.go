@@ -3,11 +3,12 @@ package handler
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
-	"strconv"
 
 	"city2city/api/models"
+	"city2city/api/router"
+	"city2city/policy"
+	"city2city/validation"
 )
 
 func (h Handler) Customer(w http.ResponseWriter, r *http.Request) {
@@ -26,121 +27,137 @@ func (h Handler) Customer(w http.ResponseWriter, r *http.Request) {
 		h.UpdateCustomer(w, r)
 	case http.MethodDelete:
 		h.DeleteCustomer(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete)
 	}
 }
 
 func (h Handler) CreateCustomer(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorize(w, r, policy.Create, policy.Customer); !ok {
+		return
+	}
+
 	createCustomer := models.CreateCustomer{}
 
 	if err := json.NewDecoder(r.Body).Decode(&createCustomer); err != nil {
-		handleResponse(w, http.StatusBadRequest, err)
+		h.handleResponse(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validation.CreateCustomer(createCustomer); err != nil {
+		h.handleError(w, r, err)
 		return
 	}
 
-	pKey, err := h.storage.Customer().Create(createCustomer)
+	pKey, err := h.storage.Customer().Create(r.Context(), createCustomer)
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
 		return
 	}
 
-	customer, err := h.storage.Customer().Get(pKey)
+	customer, err := h.storage.Customer().Get(r.Context(), pKey)
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusCreated, customer)
+	h.handleResponse(w, r, http.StatusCreated, customer)
 }
 
 func (h Handler) GetCustomerByID(w http.ResponseWriter, r *http.Request) {
-	values := r.URL.Query()
-	if len(values["id"]) <= 0 {
-		handleResponse(w, http.StatusBadRequest, errors.New("id is required"))
+	id := param(r, "id")
+	if id == "" {
+		h.handleResponse(w, r, http.StatusBadRequest, errors.New("id is required"))
+		return
+	}
+	if !h.authorizeRecord(w, r, policy.Read, policy.Customer, policy.Record{CustomerID: id}) {
 		return
 	}
 
-	id := values["id"][0]
 	var err error
 
-	customer, err := h.storage.Customer().Get(id)
+	customer, err := h.storage.Customer().Get(r.Context(), id)
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusOK, customer)
+	h.handleResponse(w, r, http.StatusOK, customer)
 }
 
 func (h Handler) GetCustomerList(w http.ResponseWriter, r *http.Request) {
-	var (
-		page, limit = 1, 10
-		err         error
-	)
-	values := r.URL.Query()
-
-	if len(values["page"]) > 0 {
-		page, err = strconv.Atoi(values["page"][0])
-		if err != nil {
-			page = 1
-		}
+	if _, ok := h.authorize(w, r, policy.List, policy.Customer); !ok {
+		return
 	}
 
-	if len(values["limit"]) > 0 {
-		limit, err = strconv.Atoi(values["limit"][0])
-		if err != nil {
-			fmt.Println("limit", values["limit"])
-			limit = 10
-		}
+	listReq, err := h.parseListRequest(r, models.CustomerSortFields)
+	if err != nil {
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	resp, err := h.storage.Customer().GetList(models.GetListRequest{
-		Page:  page,
-		Limit: limit,
+	resp, err := h.storage.Customer().GetList(r.Context(), models.GetCustomerListRequest{
+		GetListRequest: listReq,
 	})
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusOK, resp)
+	h.handleResponse(w, r, http.StatusOK, resp)
 }
 
 func (h Handler) UpdateCustomer(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorize(w, r, policy.Update, policy.Customer); !ok {
+		return
+	}
+
 	customer := models.Customer{}
 
 	if err := json.NewDecoder(r.Body).Decode(&customer); err != nil {
-		handleResponse(w, http.StatusBadRequest, err.Error())
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	pKey, err := h.storage.Customer().Update(customer)
+	if id := router.Param(r, "id"); id != "" {
+		customer.ID = id
+	}
+
+	if err := validation.UpdateCustomer(customer); err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	pKey, err := h.storage.Customer().Update(r.Context(), customer)
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err.Error())
+		h.handleError(w, r, err)
 		return
 	}
 
-	c, err := h.storage.Customer().Get(pKey)
+	c, err := h.storage.Customer().Get(r.Context(), pKey)
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusOK, c)
+	h.handleResponse(w, r, http.StatusOK, c)
 }
 
 func (h Handler) DeleteCustomer(w http.ResponseWriter, r *http.Request) {
-	values := r.URL.Query()
-	if len(values["id"]) <= 0 {
-		handleResponse(w, http.StatusBadRequest, errors.New("id is required"))
+	if _, ok := h.authorize(w, r, policy.Delete, policy.Customer); !ok {
 		return
 	}
 
-	id := values["id"][0]
+	id := param(r, "id")
+	if id == "" {
+		h.handleResponse(w, r, http.StatusBadRequest, errors.New("id is required"))
+		return
+	}
 
-	if err := h.storage.Customer().Delete(id); err != nil {
-		handleResponse(w, http.StatusInternalServerError, err.Error())
+	if err := h.storage.Customer().Delete(r.Context(), id); err != nil {
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusOK, "data successfully deleted")
+	h.handleResponse(w, r, http.StatusOK, "data successfully deleted")
 }
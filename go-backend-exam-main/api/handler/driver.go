@@ -3,11 +3,13 @@ package handler
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
-	"strconv"
+	"time"
 
 	"city2city/api/models"
+	"city2city/api/router"
+	"city2city/policy"
+	"city2city/validation"
 )
 
 func (h Handler) Driver(w http.ResponseWriter, r *http.Request) {
@@ -26,121 +28,183 @@ func (h Handler) Driver(w http.ResponseWriter, r *http.Request) {
 		h.UpdateDriver(w, r)
 	case http.MethodDelete:
 		h.DeleteDriver(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete)
 	}
 }
 
 func (h Handler) CreateDriver(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorize(w, r, policy.Create, policy.Driver); !ok {
+		return
+	}
+
 	createDriver := models.CreateDriver{}
 
 	if err := json.NewDecoder(r.Body).Decode(&createDriver); err != nil {
-		handleResponse(w, http.StatusBadRequest, err)
+		h.handleResponse(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validation.CreateDriver(createDriver); err != nil {
+		h.handleError(w, r, err)
 		return
 	}
 
-	pKey, err := h.storage.Driver().Create(createDriver)
+	pKey, err := h.storage.Driver().Create(r.Context(), createDriver)
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
 		return
 	}
 
-	customer, err := h.storage.Driver().Get(pKey)
+	customer, err := h.storage.Driver().Get(r.Context(), pKey, parseExpand(r))
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusCreated, customer)
+	h.handleResponse(w, r, http.StatusCreated, customer)
 }
 
 func (h Handler) GetDriverByID(w http.ResponseWriter, r *http.Request) {
-	values := r.URL.Query()
-	if len(values["id"]) <= 0 {
-		handleResponse(w, http.StatusBadRequest, errors.New("id is required"))
+	id := param(r, "id")
+	if id == "" {
+		h.handleResponse(w, r, http.StatusBadRequest, errors.New("id is required"))
+		return
+	}
+	if !h.authorizeRecord(w, r, policy.Read, policy.Driver, policy.Record{DriverID: id}) {
 		return
 	}
 
-	id := values["id"][0]
 	var err error
 
-	customer, err := h.storage.Driver().Get(id)
+	customer, err := h.storage.Driver().Get(r.Context(), id, parseExpand(r))
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusOK, customer)
+	h.handleResponse(w, r, http.StatusOK, customer)
 }
 
 func (h Handler) GetDriverList(w http.ResponseWriter, r *http.Request) {
-	var (
-		page, limit = 1, 10
-		err         error
-	)
+	if _, ok := h.authorize(w, r, policy.List, policy.Driver); !ok {
+		return
+	}
+
+	listReq, err := h.parseListRequest(r, models.DriverSortFields)
+	if err != nil {
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	values := r.URL.Query()
+	resp, err := h.storage.Driver().GetList(r.Context(), models.GetDriverListRequest{
+		GetListRequest: listReq,
+		FromCityID:     values.Get("from_city_id"),
+		ToCityID:       values.Get("to_city_id"),
+	})
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
 
-	if len(values["page"]) > 0 {
-		page, err = strconv.Atoi(values["page"][0])
+	h.handleResponse(w, r, http.StatusOK, resp)
+}
+
+// DriverFull serves GET /v1/drivers/{id}/full?from=&to=. from and to are dates
+// (2006-01-02) and both ends are inclusive, so from=2024-01-01&to=2024-01-07
+// returns the trips departing that whole week; trips without a schedule go
+// by when they were entered.
+func (h Handler) DriverFull(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	req := models.GetDriverFullRequest{ID: param(r, "id")}
+	if req.ID == "" {
+		h.handleResponse(w, r, http.StatusBadRequest, errors.New("id is required"))
+		return
+	}
+
+	if !h.authorizeRecord(w, r, policy.Read, policy.Driver, policy.Record{DriverID: req.ID}) {
+		return
+	}
+
+	if v := values.Get("from"); v != "" {
+		from, err := time.Parse(time.DateOnly, v)
 		if err != nil {
-			page = 1
+			h.handleResponse(w, r, http.StatusBadRequest, "from must be a date like 2006-01-02")
+			return
 		}
+		req.From = from
 	}
 
-	if len(values["limit"]) > 0 {
-		limit, err = strconv.Atoi(values["limit"][0])
+	if v := values.Get("to"); v != "" {
+		to, err := time.Parse(time.DateOnly, v)
 		if err != nil {
-			fmt.Println("limit", values["limit"])
-			limit = 10
+			h.handleResponse(w, r, http.StatusBadRequest, "to must be a date like 2006-01-02")
+			return
 		}
+		req.To = to.AddDate(0, 0, 1)
 	}
 
-	resp, err := h.storage.Driver().GetList(models.GetListRequest{
-		Page:  page,
-		Limit: limit,
-	})
+	full, err := h.storage.Driver().GetFull(r.Context(), req)
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusOK, resp)
+	h.handleResponse(w, r, http.StatusOK, full)
 }
 
 func (h Handler) UpdateDriver(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorize(w, r, policy.Update, policy.Driver); !ok {
+		return
+	}
+
 	driver := models.Driver{}
 
 	if err := json.NewDecoder(r.Body).Decode(&driver); err != nil {
-		handleResponse(w, http.StatusBadRequest, err.Error())
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if id := router.Param(r, "id"); id != "" {
+		driver.ID = id
+	}
+
+	if err := validation.UpdateDriver(driver); err != nil {
+		h.handleError(w, r, err)
 		return
 	}
 
-	pKey, err := h.storage.Driver().Update(driver)
+	pKey, err := h.storage.Driver().Update(r.Context(), driver)
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err.Error())
+		h.handleError(w, r, err)
 		return
 	}
 
-	d, err := h.storage.Driver().Get(pKey)
+	d, err := h.storage.Driver().Get(r.Context(), pKey, parseExpand(r))
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusOK, d)
+	h.handleResponse(w, r, http.StatusOK, d)
 }
 
 func (h Handler) DeleteDriver(w http.ResponseWriter, r *http.Request) {
-	values := r.URL.Query()
-	if len(values["id"]) <= 0 {
-		handleResponse(w, http.StatusBadRequest, errors.New("id is required"))
+	if _, ok := h.authorize(w, r, policy.Delete, policy.Driver); !ok {
 		return
 	}
 
-	id := values["id"][0]
+	id := param(r, "id")
+	if id == "" {
+		h.handleResponse(w, r, http.StatusBadRequest, errors.New("id is required"))
+		return
+	}
 
-	if err := h.storage.Driver().Delete(id); err != nil {
-		handleResponse(w, http.StatusInternalServerError, err.Error())
+	if err := h.storage.Driver().Delete(r.Context(), id); err != nil {
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusOK, "data successfully deleted")
+	h.handleResponse(w, r, http.StatusOK, "data successfully deleted")
 }
@@ -1,27 +1,98 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"log/slog"
 	"net/http"
+	"os"
+	"strings"
 
 	"city2city/api/models"
+	"city2city/api/router"
+	"city2city/auth"
+	"city2city/config"
 	"city2city/storage"
+	"city2city/validation"
 )
 
+// StatusClientClosedRequest is the nginx convention for a request the client
+// abandoned before a response was written.
+const StatusClientClosedRequest = 499
+
 type Handler struct {
 	storage storage.IStorage
+	cfg     config.Config
+	tokens  auth.Tokens
+	log     *slog.Logger
+	otp     auth.OTPSender
 }
 
-func New(store storage.IStorage) Handler {
+func New(store storage.IStorage, cfg config.Config, log *slog.Logger) Handler {
+	secret := []byte(cfg.JWTSecret)
+	if len(secret) == 0 {
+		log.Warn("JWT_SECRET is not set, using a random secret: tokens will not survive a restart")
+		secret = auth.RandomSecret(32)
+	}
+
+	// there is no SMS gateway yet: development prints codes to stderr,
+	// production drops them
+	var otp auth.OTPSender = auth.DiscardOTPSender{}
+	if cfg.Env == "development" {
+		otp = auth.ConsoleOTPSender{W: os.Stderr}
+	}
+
 	return Handler{
 		storage: store,
+		cfg:     cfg,
+		tokens:  auth.NewTokens(secret, cfg.AccessTokenTTL, cfg.RefreshTokenTTL),
+		log:     log,
+		otp:     otp,
+	}
+}
+
+// QueryTimeout bounds the request context, and with it every storage call
+// made for the request, by the configured query timeout.
+func (h Handler) QueryTimeout(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), h.cfg.QueryTimeout)
+		defer cancel()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// param reads a request parameter from the path of a /v1 route or, for the
+// old routes, from the query string.
+func param(r *http.Request, name string) string {
+	if value := router.Param(r, name); value != "" {
+		return value
 	}
+	return r.URL.Query().Get(name)
 }
 
-func handleResponse(w http.ResponseWriter, statuscode int, data interface{}) {
+// methodNotAllowed answers a method an old query-string route does not
+// serve.
+func methodNotAllowed(w http.ResponseWriter, allow ...string) {
+	w.Header().Set("Allow", strings.Join(allow, ", "))
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+}
+
+func (h Handler) handleResponse(w http.ResponseWriter, r *http.Request, statuscode int, data interface{}) {
 	resp := models.Response{}
 
+	// a failure caused by the request context ending is reported as such,
+	// whatever the storage driver turned it into
+	if statuscode >= http.StatusInternalServerError {
+		switch r.Context().Err() {
+		case context.DeadlineExceeded:
+			statuscode, data = http.StatusGatewayTimeout, "request timed out"
+		case context.Canceled:
+			statuscode, data = StatusClientClosedRequest, "request canceled by client"
+		}
+	}
+
 	switch code := statuscode; {
 	case code < 400:
 		resp.Description = "succes"
@@ -31,15 +102,132 @@ func handleResponse(w http.ResponseWriter, statuscode int, data interface{}) {
 		resp.Description = "internal server error"
 	}
 
+	if statuscode >= 400 {
+		data = errorBody(statuscode, data)
+	}
+
 	resp.StatusCode = statuscode
 	resp.Data = data
 
 	js, err := json.Marshal(resp)
 	if err != nil {
-		fmt.Println("error is while marshalling json", err.Error())
+		h.log.ErrorContext(r.Context(), "marshalling response", slog.Any("error", err))
+		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statuscode)
 	w.Write(js)
 }
+
+// errorCodes are the codes of error responses by status. An error from
+// storage brings its own code.
+var errorCodes = map[int]string{
+	http.StatusBadRequest:          "bad_request",
+	http.StatusUnauthorized:        "unauthorized",
+	http.StatusForbidden:           "forbidden",
+	http.StatusNotFound:            "not_found",
+	http.StatusMethodNotAllowed:    "method_not_allowed",
+	http.StatusConflict:            "conflict",
+	http.StatusUnprocessableEntity: "validation_failed",
+	StatusClientClosedRequest:      "canceled",
+	http.StatusInternalServerError: "internal",
+	http.StatusServiceUnavailable:  "unavailable",
+	http.StatusGatewayTimeout:      "timeout",
+}
+
+var kindCodes = map[error]string{
+	storage.ErrNotFound:            "not_found",
+	storage.ErrConflict:            "conflict",
+	storage.ErrForeignKeyViolation: "foreign_key_violation",
+	storage.ErrValidation:          "validation_failed",
+}
+
+// handleError answers with the status that matches the kind of err: 404,
+// 409 or 422 for storage errors, 422 for validation errors and 500 for
+// anything else. Only the last are logged, as their details stay out of the
+// response.
+func (h Handler) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	statuscode := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		statuscode = http.StatusNotFound
+	case errors.Is(err, storage.ErrConflict):
+		statuscode = http.StatusConflict
+	case errors.Is(err, storage.ErrForeignKeyViolation), errors.Is(err, storage.ErrValidation):
+		statuscode = http.StatusUnprocessableEntity
+	case errors.As(err, new(validation.Errors)):
+		statuscode = http.StatusUnprocessableEntity
+	}
+
+	if statuscode == http.StatusInternalServerError && r.Context().Err() == nil {
+		h.log.ErrorContext(r.Context(), "request failed",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Any("error", err),
+		)
+	}
+
+	h.handleResponse(w, r, statuscode, err)
+}
+
+// errorBody turns the data of an error response, usually a string or an
+// error, into a models.Error. The details of internal errors stay out of
+// the response.
+func errorBody(statuscode int, data interface{}) models.Error {
+	if body, ok := data.(models.Error); ok {
+		return body
+	}
+
+	body := models.Error{Code: errorCodes[statuscode], Message: http.StatusText(statuscode)}
+	if body.Code == "" {
+		body.Code = "error"
+	}
+
+	var (
+		storageErr *storage.Error
+		fieldErrs  validation.Errors
+	)
+	if err, ok := data.(error); ok && errors.As(err, &storageErr) {
+		body.Code, body.Message = kindCodes[storageErr.Kind], storageErr.Message
+		return body
+	}
+	if err, ok := data.(error); ok && errors.As(err, &fieldErrs) {
+		body.Code, body.Message, body.Fields = "validation_failed", "request body is invalid", fieldErrs
+		return body
+	}
+
+	if statuscode == http.StatusInternalServerError {
+		return body
+	}
+
+	switch v := data.(type) {
+	case string:
+		body.Message = v
+	case error:
+		body.Message = v.Error()
+	}
+
+	return body
+}
+
+// parseExpand reads the comma separated expand query parameter. Without the
+// parameter every nested object is joined; expand= with no names joins none.
+func parseExpand(r *http.Request) models.Expand {
+	values, ok := r.URL.Query()["expand"]
+	if !ok {
+		return nil
+	}
+
+	expand := models.Expand{}
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				expand[name] = true
+			}
+		}
+	}
+
+	return expand
+}
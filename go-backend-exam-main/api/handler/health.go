@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"city2city/api/models"
+	"city2city/storage"
+)
+
+// Healthz tells the orchestrator the process is alive. It checks nothing
+// else, so that a database outage does not get healthy instances restarted.
+func (h Handler) Healthz(w http.ResponseWriter, r *http.Request) {
+	h.handleResponse(w, r, http.StatusOK, "ok")
+}
+
+// Readyz tells the orchestrator whether to send traffic: the database must
+// answer and, for a migrated store, be at least at the schema version the
+// code expects. Failed checks are listed as the fields of a 503.
+func (h Handler) Readyz(w http.ResponseWriter, r *http.Request) {
+	var failed []models.FieldError
+
+	if err := h.storage.Ping(r.Context()); err != nil {
+		// driver errors name hosts and users, they go to the log only
+		h.log.ErrorContext(r.Context(), "readiness: database unreachable", slog.Any("error", err))
+		failed = append(failed, models.FieldError{Field: "database", Message: "unreachable"})
+	} else if versioner, ok := h.storage.(storage.ISchemaVersioner); ok {
+		if err := schemaCurrent(r, versioner); err != nil {
+			h.log.ErrorContext(r.Context(), "readiness: schema not current", slog.Any("error", err))
+			failed = append(failed, models.FieldError{Field: "schema", Message: err.Error()})
+		}
+	}
+
+	if len(failed) > 0 {
+		h.handleResponse(w, r, http.StatusServiceUnavailable, models.Error{
+			Code:    errorCodes[http.StatusServiceUnavailable],
+			Message: "not ready",
+			Fields:  failed,
+		})
+		return
+	}
+
+	h.handleResponse(w, r, http.StatusOK, "ready")
+}
+
+func schemaCurrent(r *http.Request, versioner storage.ISchemaVersioner) error {
+	current, latest, err := versioner.SchemaVersion(r.Context())
+	if err != nil {
+		return errors.New("cannot read schema version")
+	}
+	// a database ahead of the code is the usual state while a deploy
+	// rolls back
+	if current < latest {
+		return fmt.Errorf("schema is at version %d, code expects %d", current, latest)
+	}
+	return nil
+}
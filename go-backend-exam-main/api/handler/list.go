@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"city2city/api/models"
+)
+
+// parseListRequest reads the query parameters shared by every list endpoint:
+// page, limit (up to the configured maximum), sort=field,-field (restricted
+// to sortable), search and expand.
+//
+// A cursor parameter switches to keyset paging: cursor= (empty) asks for the
+// first page, and every page answers with the next_cursor to pass back. The
+// total count is then only computed for count=true.
+func (h Handler) parseListRequest(r *http.Request, sortable []string) (models.GetListRequest, error) {
+	values := r.URL.Query()
+	req := models.GetListRequest{
+		Page:   1,
+		Limit:  h.cfg.ListDefaultLimit,
+		Search: strings.TrimSpace(values.Get("search")),
+		Expand: parseExpand(r),
+	}
+
+	if v := values.Get("page"); v != "" {
+		page, err := strconv.Atoi(v)
+		if err != nil || page < 1 {
+			return models.GetListRequest{}, fmt.Errorf("page must be a positive integer")
+		}
+		req.Page = page
+	}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > h.cfg.ListMaxLimit {
+			return models.GetListRequest{}, fmt.Errorf("limit must be between 1 and %d", h.cfg.ListMaxLimit)
+		}
+		req.Limit = limit
+	}
+
+	for _, v := range values["sort"] {
+		for _, field := range strings.Split(v, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+
+			sortField := models.SortField{Field: strings.TrimPrefix(field, "-"), Desc: strings.HasPrefix(field, "-")}
+			if !contains(sortable, sortField.Field) {
+				return models.GetListRequest{}, fmt.Errorf("cannot sort by %q, use one of %s", sortField.Field, strings.Join(sortable, ", "))
+			}
+			req.Sort = append(req.Sort, sortField)
+		}
+	}
+
+	if cursor, ok := values["cursor"]; ok {
+		if len(req.Sort) > 0 {
+			return models.GetListRequest{}, fmt.Errorf("sort cannot be combined with cursor")
+		}
+
+		req.CursorMode = true
+		if cursor[0] != "" {
+			after, err := models.ParseCursor(cursor[0])
+			if err != nil {
+				return models.GetListRequest{}, err
+			}
+			req.After = &after
+		}
+
+		withCount, err := queryBool(values, "count")
+		if err != nil {
+			return models.GetListRequest{}, err
+		}
+		req.WithCount = withCount != nil && *withCount
+	}
+
+	return req, nil
+}
+
+func queryInt(values url.Values, key string) (*int, error) {
+	v := values.Get(key)
+	if v == "" {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an integer", key)
+	}
+	return &n, nil
+}
+
+func queryBool(values url.Values, key string) (*bool, error) {
+	v := values.Get(key)
+	if v == "" {
+		return nil, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be true or false", key)
+	}
+	return &b, nil
+}
+
+// queryDate parses a 2006-01-02 date; the zero time means it was not given.
+func queryDate(values url.Values, key string) (time.Time, error) {
+	v := values.Get(key)
+	if v == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be a date like 2006-01-02", key)
+	}
+	return t, nil
+}
+
+// queryTime parses an RFC 3339 time; the zero time means it was not given.
+func queryTime(values url.Values, key string) (time.Time, error) {
+	v := values.Get(key)
+	if v == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 time", key)
+	}
+	return t, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
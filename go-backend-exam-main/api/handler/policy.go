@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"net/http"
+
+	"city2city/auth"
+	"city2city/policy"
+)
+
+// authorize asks the policy whether the caller may perform action on
+// resource and answers 403 with the reason when not.
+func (h Handler) authorize(w http.ResponseWriter, r *http.Request, action policy.Action, resource policy.Resource) (policy.Decision, bool) {
+	decision := policy.Authorize(caller(r), action, resource)
+	if !decision.Allowed {
+		h.handleResponse(w, r, http.StatusForbidden, decision.Reason)
+	}
+	return decision, decision.Allowed
+}
+
+// authorizeRecord is authorize for a single record owned as record says.
+func (h Handler) authorizeRecord(w http.ResponseWriter, r *http.Request, action policy.Action, resource policy.Resource, record policy.Record) bool {
+	decision := policy.AuthorizeRecord(caller(r), action, resource, record)
+	if !decision.Allowed {
+		h.handleResponse(w, r, http.StatusForbidden, decision.Reason)
+	}
+	return decision.Allowed
+}
+
+// caller is the identity Authenticate stored for the request.
+func caller(r *http.Request) auth.Identity {
+	identity, _ := auth.FromContext(r.Context())
+	return identity
+}
@@ -4,8 +4,14 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 
 	"city2city/api/models"
+	"city2city/api/router"
+	"city2city/policy"
+	"city2city/validation"
 )
 
 func (h Handler) Trip(w http.ResponseWriter, r *http.Request) {
@@ -14,114 +20,326 @@ func (h Handler) Trip(w http.ResponseWriter, r *http.Request) {
 		h.CreateTrip(w, r)
 	case http.MethodGet:
 		values := r.URL.Query()
-		if _, ok := values["id"]; !ok {
-			h.GetTripList(w)
-		} else {
+		if _, ok := values["id"]; ok {
 			h.GetTripByID(w, r)
+		} else if _, ok := values["number"]; ok {
+			h.GetTripByNumber(w, r)
+		} else {
+			h.GetTripList(w, r)
 		}
 	case http.MethodPut:
 		h.UpdateTrip(w, r)
 	case http.MethodDelete:
 		h.DeleteTrip(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete)
 	}
 }
 
 func (h Handler) CreateTrip(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorize(w, r, policy.Create, policy.Trip); !ok {
+		return
+	}
+
 	createTrip := models.CreateTrip{}
 
 	if err := json.NewDecoder(r.Body).Decode(&createTrip); err != nil {
-		handleResponse(w, http.StatusBadRequest, err)
+		h.handleResponse(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validation.CreateTrip(createTrip); err != nil {
+		h.handleError(w, r, err)
 		return
 	}
 
-	pKey, err := h.storage.Trip().Create(createTrip)
+	pKey, err := h.storage.Trip().Create(r.Context(), createTrip)
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
 		return
 	}
 
-	trip, err := h.storage.Trip().Get(pKey)
+	trip, err := h.storage.Trip().Get(r.Context(), pKey, parseExpand(r))
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusCreated, trip)
+	h.handleResponse(w, r, http.StatusCreated, trip)
 }
 
 func (h Handler) GetTripByID(w http.ResponseWriter, r *http.Request) {
-	values := r.URL.Query()
-	if len(values["id"]) <= 0 {
-		handleResponse(w, http.StatusBadRequest, errors.New("id is required"))
+	if _, ok := h.authorize(w, r, policy.Read, policy.Trip); !ok {
 		return
 	}
 
-	id := values["id"][0]
+	id := param(r, "id")
+	if id == "" {
+		h.handleResponse(w, r, http.StatusBadRequest, errors.New("id is required"))
+		return
+	}
 	var err error
 
-	trip, err := h.storage.Trip().Get(id)
+	trip, err := h.storage.Trip().Get(r.Context(), id, parseExpand(r))
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusOK, trip)
+	if !h.authorizeRecord(w, r, policy.Read, policy.Trip, policy.Record{DriverID: trip.DriverID}) {
+		return
+	}
+
+	h.handleResponse(w, r, http.StatusOK, trip)
 }
 
-func (h Handler) GetTripList(w http.ResponseWriter) {
-	var (
-		page, limit = 1, 10 // Adjust defaults as needed
-		err         error
-	)
+func (h Handler) GetTripByNumber(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorize(w, r, policy.Read, policy.Trip); !ok {
+		return
+	}
+
+	number := param(r, "number")
+	if number == "" {
+		h.handleResponse(w, r, http.StatusBadRequest, errors.New("number is required"))
+		return
+	}
 
-	resp, err := h.storage.Trip().GetList(models.GetListRequest{
-		Page:  page,
-		Limit: limit,
-	})
+	trip, err := h.storage.Trip().GetByNumber(r.Context(), number, parseExpand(r))
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	if !h.authorizeRecord(w, r, policy.Read, policy.Trip, policy.Record{DriverID: trip.DriverID}) {
+		return
+	}
+
+	h.handleResponse(w, r, http.StatusOK, trip)
+}
+
+// GetTripList filters by from_city_id, to_city_id, driver_id, status,
+// min_price, max_price, the inclusive date_from/date_to range of creation
+// (2006-01-02) and the inclusive departure_from/departure_to range of the
+// scheduled departure (RFC 3339).
+func (h Handler) GetTripList(w http.ResponseWriter, r *http.Request) {
+	decision, ok := h.authorize(w, r, policy.List, policy.Trip)
+	if !ok {
+		return
+	}
+
+	listReq, err := h.parseListRequest(r, models.TripSortFields)
+	if err != nil {
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	values := r.URL.Query()
+	req := models.GetTripListRequest{
+		GetListRequest: listReq,
+		FromCityID:     values.Get("from_city_id"),
+		ToCityID:       values.Get("to_city_id"),
+		DriverID:       values.Get("driver_id"),
+		Status:         values.Get("status"),
+	}
+
+	if req.Status != "" && !slices.Contains(models.TripStatuses, req.Status) {
+		h.handleResponse(w, r, http.StatusBadRequest, "status must be one of "+strings.Join(models.TripStatuses, ", "))
+		return
+	}
+
+	if decision.OwnOnly {
+		req.DriverID = caller(r).Subject
+	}
+
+	if req.MinPrice, err = queryInt(values, "min_price"); err != nil {
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.MaxPrice, err = queryInt(values, "max_price"); err != nil {
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.CreatedFrom, err = queryDate(values, "date_from"); err != nil {
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.CreatedTo, err = queryDate(values, "date_to"); err != nil {
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !req.CreatedTo.IsZero() {
+		req.CreatedTo = req.CreatedTo.AddDate(0, 0, 1)
+	}
+	if req.DepartureFrom, err = queryTime(values, "departure_from"); err != nil {
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.DepartureTo, err = queryTime(values, "departure_to"); err != nil {
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := h.storage.Trip().GetList(r.Context(), req)
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusOK, resp)
+	h.handleResponse(w, r, http.StatusOK, resp)
 }
 
 func (h Handler) UpdateTrip(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorize(w, r, policy.Update, policy.Trip); !ok {
+		return
+	}
+
 	trip := models.Trip{}
 
 	if err := json.NewDecoder(r.Body).Decode(&trip); err != nil {
-		handleResponse(w, http.StatusBadRequest, err.Error())
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if id := router.Param(r, "id"); id != "" {
+		trip.ID = id
+	}
+
+	if err := validation.UpdateTrip(trip); err != nil {
+		h.handleError(w, r, err)
 		return
 	}
 
-	pKey, err := h.storage.Trip().Update(trip)
+	pKey, err := h.storage.Trip().Update(r.Context(), trip)
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err.Error())
+		h.handleError(w, r, err)
 		return
 	}
 
-	t, err := h.storage.Trip().Get(pKey)
+	t, err := h.storage.Trip().Get(r.Context(), pKey, parseExpand(r))
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusOK, t)
+	h.handleResponse(w, r, http.StatusOK, t)
 }
 
 func (h Handler) DeleteTrip(w http.ResponseWriter, r *http.Request) {
-	values := r.URL.Query()
-	if len(values["id"]) <= 0 {
-		handleResponse(w, http.StatusBadRequest, errors.New("id is required"))
+	if _, ok := h.authorize(w, r, policy.Delete, policy.Trip); !ok {
+		return
+	}
+
+	id := param(r, "id")
+	if id == "" {
+		h.handleResponse(w, r, http.StatusBadRequest, errors.New("id is required"))
+		return
+	}
+
+	if err := h.storage.Trip().Delete(r.Context(), id); err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	h.handleResponse(w, r, http.StatusOK, "data successfully deleted")
+}
+
+// BoardTrip, StartTrip, CompleteTrip and CancelTrip move a trip along its
+// lifecycle, as models.CanTransitionTrip allows.
+func (h Handler) BoardTrip(w http.ResponseWriter, r *http.Request) {
+	h.transitionTrip(w, r, policy.UpdateStatus, models.TripBoarding)
+}
+
+func (h Handler) StartTrip(w http.ResponseWriter, r *http.Request) {
+	h.transitionTrip(w, r, policy.UpdateStatus, models.TripInProgress)
+}
+
+func (h Handler) CompleteTrip(w http.ResponseWriter, r *http.Request) {
+	h.transitionTrip(w, r, policy.UpdateStatus, models.TripCompleted)
+}
+
+func (h Handler) CancelTrip(w http.ResponseWriter, r *http.Request) {
+	h.transitionTrip(w, r, policy.Cancel, models.TripCancelled)
+}
+
+// transitionTrip moves the trip to status on behalf of the caller, who must
+// be allowed action on it, and responds with the trip as it now is.
+func (h Handler) transitionTrip(w http.ResponseWriter, r *http.Request, action policy.Action, status string) {
+	id := param(r, "id")
+	if id == "" {
+		h.handleResponse(w, r, http.StatusBadRequest, errors.New("id is required"))
+		return
+	}
+
+	if !h.authorizeTrip(w, r, action, id) {
+		return
+	}
+
+	identity := caller(r)
+	err := h.storage.Trip().Transition(r.Context(), models.TripTransition{
+		TripID:    id,
+		Status:    status,
+		ActorID:   identity.Subject,
+		ActorRole: identity.Role,
+		At:        time.Now(),
+	})
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	trip, err := h.storage.Trip().Get(r.Context(), id, parseExpand(r))
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	h.handleResponse(w, r, http.StatusOK, trip)
+}
+
+// GetTripEvents lists the status changes of a trip, oldest first.
+func (h Handler) GetTripEvents(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorize(w, r, policy.List, policy.TripEvent); !ok {
+		return
+	}
+
+	id := param(r, "id")
+	if id == "" {
+		h.handleResponse(w, r, http.StatusBadRequest, errors.New("id is required"))
+		return
+	}
+
+	trip, err := h.storage.Trip().Get(r.Context(), id, models.Expand{})
+	if err != nil {
+		h.handleError(w, r, err)
 		return
 	}
 
-	id := values["id"][0]
+	if !h.authorizeRecord(w, r, policy.List, policy.TripEvent, policy.Record{DriverID: trip.DriverID}) {
+		return
+	}
 
-	if err := h.storage.Trip().Delete(id); err != nil {
-		handleResponse(w, http.StatusInternalServerError, err.Error())
+	events, err := h.storage.Trip().GetEvents(r.Context(), id)
+	if err != nil {
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusOK, "data successfully deleted")
+	h.handleResponse(w, r, http.StatusOK, models.TripEventsResponse{Events: events})
+}
+
+// authorizeTrip checks action on the trip with id, loading the trip only
+// when the caller is limited to their own.
+func (h Handler) authorizeTrip(w http.ResponseWriter, r *http.Request, action policy.Action, id string) bool {
+	decision, ok := h.authorize(w, r, action, policy.Trip)
+	if !ok || !decision.OwnOnly {
+		return ok
+	}
+
+	trip, err := h.storage.Trip().Get(r.Context(), id, models.Expand{})
+	if err != nil {
+		h.handleError(w, r, err)
+		return false
+	}
+
+	return h.authorizeRecord(w, r, action, policy.Trip, policy.Record{DriverID: trip.DriverID})
 }
@@ -3,9 +3,16 @@ package handler
 import (
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
+	"time"
 
 	"city2city/api/models"
+	"city2city/api/router"
+	"city2city/auth"
+	"city2city/policy"
+	"city2city/storage"
+	"city2city/validation"
 )
 
 func (h Handler) TripCustomer(w http.ResponseWriter, r *http.Request) {
@@ -15,7 +22,7 @@ func (h Handler) TripCustomer(w http.ResponseWriter, r *http.Request) {
 	case http.MethodGet:
 		values := r.URL.Query()
 		if _, ok := values["id"]; !ok {
-			h.GetTripCustomerList(w)
+			h.GetTripCustomerList(w, r)
 		} else {
 			h.GetTripCustomerByID(w, r)
 		}
@@ -23,6 +30,8 @@ func (h Handler) TripCustomer(w http.ResponseWriter, r *http.Request) {
 		h.UpdateTripCustomer(w, r)
 	case http.MethodDelete:
 		h.DeleteTripCustomer(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete)
 	}
 }
 
@@ -30,98 +39,248 @@ func (h Handler) CreateTripCustomer(w http.ResponseWriter, r *http.Request) {
 	createTrip := models.CreateTripCustomer{}
 
 	if err := json.NewDecoder(r.Body).Decode(&createTrip); err != nil {
-		handleResponse(w, http.StatusBadRequest, err)
+		h.handleResponse(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	pKey, err := h.storage.TripCustomer().Create(createTrip)
+	if tripID := router.Param(r, "trip_id"); tripID != "" {
+		createTrip.TripID = tripID
+	}
+
+	// a customer always books for themselves, whatever the body says
+	if identity := caller(r); identity.Role == auth.RoleCustomer {
+		createTrip.CustomerID = identity.Subject
+	}
+
+	if !h.authorizeRecord(w, r, policy.Create, policy.TripCustomer, policy.Record{CustomerID: createTrip.CustomerID}) {
+		return
+	}
+
+	if err := validation.CreateTripCustomer(createTrip); err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	pKey, err := h.storage.TripCustomer().Create(r.Context(), createTrip)
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
 		return
 	}
 
-	trip, err := h.storage.TripCustomer().Get(pKey)
+	trip, err := h.storage.TripCustomer().Get(r.Context(), pKey, parseExpand(r))
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusCreated, trip)
+	h.handleResponse(w, r, http.StatusCreated, trip)
 }
 
 func (h Handler) GetTripCustomerByID(w http.ResponseWriter, r *http.Request) {
-	values := r.URL.Query()
-	if len(values["id"]) <= 0 {
-		handleResponse(w, http.StatusBadRequest, errors.New("id is required"))
+	if _, ok := h.authorize(w, r, policy.Read, policy.TripCustomer); !ok {
 		return
 	}
 
-	id := values["id"][0]
+	id := param(r, "id")
+	if id == "" {
+		h.handleResponse(w, r, http.StatusBadRequest, errors.New("id is required"))
+		return
+	}
 	var err error
 
-	tripCustumer, err := h.storage.TripCustomer().Get(id)
+	tripCustumer, err := h.storage.TripCustomer().Get(r.Context(), id, parseExpand(r))
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
+		return
+	}
+
+	if !h.authorizeRecord(w, r, policy.Read, policy.TripCustomer, policy.Record{CustomerID: tripCustumer.CustomerID}) {
 		return
 	}
 
-	handleResponse(w, http.StatusOK, tripCustumer)
+	h.handleResponse(w, r, http.StatusOK, tripCustumer)
 }
 
-func (h Handler) GetTripCustomerList(w http.ResponseWriter) {
-	var (
-		page, limit = 1, 10
-		err         error
-	)
+func (h Handler) GetTripCustomerList(w http.ResponseWriter, r *http.Request) {
+	decision, ok := h.authorize(w, r, policy.List, policy.TripCustomer)
+	if !ok {
+		return
+	}
 
-	resp, err := h.storage.TripCustomer().GetList(models.GetListRequest{
-		Page:  page,
-		Limit: limit,
-	})
+	listReq, err := h.parseListRequest(r, models.TripCustomerSortFields)
+	if err != nil {
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	values := r.URL.Query()
+	req := models.GetTripCustomerListRequest{
+		GetListRequest: listReq,
+		TripID:         param(r, "trip_id"),
+		CustomerID:     values.Get("customer_id"),
+	}
+
+	if decision.OwnOnly {
+		req.CustomerID = caller(r).Subject
+	}
+
+	if req.Cancelled, err = queryBool(values, "cancelled"); err != nil {
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := h.storage.TripCustomer().GetList(r.Context(), req)
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusOK, resp)
+	h.handleResponse(w, r, http.StatusOK, resp)
 }
 
 func (h Handler) UpdateTripCustomer(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorize(w, r, policy.Update, policy.TripCustomer); !ok {
+		return
+	}
+
 	tripCustomer := models.TripCustomer{}
 
 	if err := json.NewDecoder(r.Body).Decode(&tripCustomer); err != nil {
-		handleResponse(w, http.StatusBadRequest, err.Error())
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if id := router.Param(r, "id"); id != "" {
+		tripCustomer.ID = id
+	}
+
+	if err := validation.UpdateTripCustomer(tripCustomer); err != nil {
+		h.handleError(w, r, err)
 		return
 	}
 
-	pKey, err := h.storage.TripCustomer().Update(tripCustomer)
+	pKey, err := h.storage.TripCustomer().Update(r.Context(), tripCustomer)
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err.Error())
+		h.handleError(w, r, err)
 		return
 	}
 
-	t, err := h.storage.TripCustomer().Get(pKey)
+	t, err := h.storage.TripCustomer().Get(r.Context(), pKey, parseExpand(r))
 	if err != nil {
-		handleResponse(w, http.StatusInternalServerError, err)
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusOK, t)
+	h.handleResponse(w, r, http.StatusOK, t)
 }
 
+// DeleteTripCustomer erases a booking, cancellation and all. Only admins
+// may; everyone else cancels it.
 func (h Handler) DeleteTripCustomer(w http.ResponseWriter, r *http.Request) {
-	values := r.URL.Query()
-	if len(values["id"]) <= 0 {
-		handleResponse(w, http.StatusBadRequest, errors.New("id is required"))
+	id := param(r, "id")
+	if id == "" {
+		h.handleResponse(w, r, http.StatusBadRequest, errors.New("id is required"))
 		return
 	}
 
-	id := values["id"][0]
+	if _, ok := h.authorize(w, r, policy.Delete, policy.TripCustomer); !ok {
+		return
+	}
+
+	if err := h.storage.TripCustomer().Delete(r.Context(), id); err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	h.handleResponse(w, r, http.StatusOK, "data successfully deleted")
+}
+
+// CancelTripCustomer cancels a booking, keeping it for history and freeing
+// its seat. The body may give a reason.
+func (h Handler) CancelTripCustomer(w http.ResponseWriter, r *http.Request) {
+	id := param(r, "id")
+	if id == "" {
+		h.handleResponse(w, r, http.StatusBadRequest, errors.New("id is required"))
+		return
+	}
+
+	decision, ok := h.authorize(w, r, policy.Cancel, policy.TripCustomer)
+	if !ok {
+		return
+	}
+
+	req := models.CancelTripCustomerRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.handleResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := validation.CancelTripCustomer(req); err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	if decision.OwnOnly {
+		booking, err := h.storage.TripCustomer().Get(r.Context(), id, models.Expand{})
+		if err != nil {
+			h.handleError(w, r, err)
+			return
+		}
+
+		if !h.authorizeRecord(w, r, policy.Cancel, policy.TripCustomer, policy.Record{CustomerID: booking.CustomerID}) {
+			return
+		}
+	}
+
+	identity := caller(r)
+	err := h.storage.WithTx(r.Context(), func(tx storage.IStorage) error {
+		booking, err := tx.TripCustomer().Get(r.Context(), id, models.Expand{})
+		if err != nil {
+			return err
+		}
+
+		trip := models.Trip{}
+		if booking.TripID != "" {
+			if trip, err = tx.Trip().Get(r.Context(), booking.TripID, models.Expand{}); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		refund := h.refund(trip, now)
+
+		return tx.TripCustomer().Cancel(r.Context(), models.CancelTripCustomer{
+			ID:        id,
+			ActorID:   identity.Subject,
+			ActorRole: identity.Role,
+			Reason:    req.Reason,
+			Refund:    refund,
+			Penalty:   trip.Price - refund,
+			At:        now,
+		})
+	})
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
 
-	if err := h.storage.TripCustomer().Delete(id); err != nil {
-		handleResponse(w, http.StatusInternalServerError, err.Error())
+	booking, err := h.storage.TripCustomer().Get(r.Context(), id, parseExpand(r))
+	if err != nil {
+		h.handleError(w, r, err)
 		return
 	}
 
-	handleResponse(w, http.StatusOK, "data successfully deleted")
+	h.handleResponse(w, r, http.StatusOK, booking)
+}
+
+// refund is the part of the price of trip given back for a booking
+// cancelled at now, by the configured refund rules. A trip without a
+// scheduled departure leaves no notice to measure and is refunded in full.
+func (h Handler) refund(trip models.Trip, now time.Time) int {
+	departure, err := time.Parse(time.RFC3339Nano, trip.ScheduledDeparture)
+	if err != nil {
+		return trip.Price
+	}
+
+	return trip.Price * h.cfg.RefundRules.Percent(departure.Sub(now)) / 100
 }
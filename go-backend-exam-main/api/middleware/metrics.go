@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"city2city/api/router"
+	"city2city/metrics"
+)
+
+var knownMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+// Metrics counts requests and observes their latency by method, route
+// pattern and status. Requests no route matched share the route
+// "unmatched", and unusual methods the method "other", so that scanners
+// cannot grow the series without bound.
+func Metrics(reg *metrics.Registry) Middleware {
+	var (
+		requests = reg.Counter("http_requests_total", "HTTP requests served.", "method", "route", "status")
+		latency  = reg.Histogram("http_request_duration_seconds", "Time to serve HTTP requests.", metrics.DefBuckets, "method", "route", "status")
+	)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := record(w)
+			r, pattern := router.RecordPattern(r)
+
+			next.ServeHTTP(rec, r)
+
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			route := *pattern
+			if route == "" {
+				route = "unmatched"
+			}
+
+			method := r.Method
+			if !knownMethods[method] {
+				method = "other"
+			}
+
+			requests.Inc(method, route, strconv.Itoa(status))
+			latency.Observe(time.Since(start).Seconds(), method, route, strconv.Itoa(status))
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"city2city/api/models"
+)
+
+// Recover turns a panic in a handler into a logged stack trace and, if the
+// handler had not started its response yet, a 500 envelope.
+func Recover(logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := record(w)
+
+			defer func() {
+				err := recover()
+				if err == nil {
+					return
+				}
+				// the server's own way to abort a response quietly
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+
+				logger.ErrorContext(r.Context(), "panic while serving request",
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.Any("panic", err),
+					slog.String("stack", string(debug.Stack())),
+				)
+
+				if rec.written() {
+					return
+				}
+
+				js, _ := json.Marshal(models.Response{
+					StatusCode:  http.StatusInternalServerError,
+					Description: "internal server error",
+					Data:        models.Error{Code: "internal", Message: http.StatusText(http.StatusInternalServerError)},
+				})
+				rec.Header().Set("Content-Type", "application/json")
+				rec.WriteHeader(http.StatusInternalServerError)
+				rec.Write(js)
+			}()
+
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// Admin is a staff account: an admin or a dispatcher, as Role says.
+type Admin struct {
+	ID           string `json:"id"`
+	Login        string `json:"login"`
+	Role         string `json:"role"`
+	PasswordHash string `json:"-"`
+	CreatedAt    string `json:"created_at"`
+}
+
+type CreateAdmin struct {
+	Login        string `json:"login"`
+	Password     string `json:"password"`
+	Role         string `json:"role"`
+	PasswordHash string `json:"-"`
+}
+
+// OTP is a one-time login code sent to the phone of a customer or driver.
+// Only its hash is stored.
+type OTP struct {
+	Role      string
+	Phone     string
+	CodeHash  string
+	Attempts  int
+	ExpiresAt time.Time
+}
+
+type SendOTPRequest struct {
+	Role  string `json:"role"`
+	Phone string `json:"phone"`
+}
+
+type VerifyOTPRequest struct {
+	Role  string `json:"role"`
+	Phone string `json:"phone"`
+	Code  string `json:"code"`
+}
+
+type AdminLoginRequest struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
@@ -1,27 +1,47 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
+
+// DefaultCarSeats is the passenger capacity of a car created without seats,
+// a Chevrolet Cobalt being the usual city-to-city car.
+const DefaultCarSeats = 4
+
+// CarNumber is the form licence plates are stored and compared in: upper
+// case and without spaces, so that 01 a 123 bc and 01A123BC are one car.
+func CarNumber(number string) string {
+	return strings.ToUpper(strings.ReplaceAll(number, " ", ""))
+}
 
 type Car struct {
-	ID         string `json:"id"`
-	Model      string `json:"model"`
-	Brand      string `json:"brand"`
-	Number     string `json:"number"`
-	DriverID   string `json:"driver_id"`
-	DriverData Driver `json:"driver_data"`
-	CreatedAt  string `json:"created_at"`
+	ID            string `json:"id"`
+	Model         string `json:"model"`
+	Brand         string `json:"brand"`
+	Number        string `json:"number"`
+	Status        bool   `json:"status"`
+	Seats         int    `json:"seats"`
+	DriverID      string `json:"driver_id"`
+	DriverData    Driver `json:"driver_data"`
+	FromCityID    string `json:"from_city_id"`
+	ToCityID      string `json:"to_city_id"`
+	DepartureTime string `json:"departure_time"`
+	CreatedAt     string `json:"created_at"`
 }
 
 type CreateCar struct {
 	Model    string `json:"model"`
 	Brand    string `json:"brand"`
 	Number   string `json:"number"`
+	Seats    int    `json:"seats"`
 	DriverID string `json:"driver_id"`
 }
 
 type CarsResponse struct {
-	Cars  []Car `json:"cars"`
-	Count int   `json:"count"`
+	Cars       []Car  `json:"cars"`
+	Count      int    `json:"count"`
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 type UpdateCarStatus struct {
@@ -35,3 +55,18 @@ type UpdateCarRoute struct {
 	FromCityID    string    `json:"from_city_id"`
 	ToCityID      string    `json:"to_city_id"`
 }
+
+var CarSortFields = []string{"brand", "model", "departure_time", "created_at"}
+
+// GetCarListRequest filters cars by status, brand, driver and current route.
+// A zero departure bound leaves that side of the window open.
+type GetCarListRequest struct {
+	GetListRequest
+	Status        *bool     `json:"status"`
+	Brand         string    `json:"brand"`
+	DriverID      string    `json:"driver_id"`
+	FromCityID    string    `json:"from_city_id"`
+	ToCityID      string    `json:"to_city_id"`
+	DepartureFrom time.Time `json:"departure_from"`
+	DepartureTo   time.Time `json:"departure_to"`
+}
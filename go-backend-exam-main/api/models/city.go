@@ -11,6 +11,14 @@ type CreateCity struct {
 }
 
 type CitiesResponse struct {
-	Cities []City `json:"cities"`
-	Count  int    `json:"count"`
+	Cities     []City `json:"cities"`
+	Count      int    `json:"count"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+var CitySortFields = []string{"name", "created_at"}
+
+// GetCityListRequest searches cities by name.
+type GetCityListRequest struct {
+	GetListRequest
 }
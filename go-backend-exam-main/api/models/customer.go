@@ -15,6 +15,14 @@ type CreateCustomer struct {
 }
 
 type CustomersResponse struct {
-	Customers []Customer `json:"customers"`
-	Count     int        `json:"count"`
+	Customers  []Customer `json:"customers"`
+	Count      int        `json:"count"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+var CustomerSortFields = []string{"full_name", "created_at"}
+
+// GetCustomerListRequest searches customers by a full_name or phone substring.
+type GetCustomerListRequest struct {
+	GetListRequest
 }
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type Driver struct {
 	ID           string `json:"id"`
 	FullName     string `json:"full_name"`
@@ -19,6 +21,38 @@ type CreateDriver struct {
 }
 
 type DriversResponse struct {
-	Drivers []Driver `json:"drivers"`
-	Count   int      `json:"count"`
+	Drivers    []Driver `json:"drivers"`
+	Count      int      `json:"count"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+var DriverSortFields = []string{"full_name", "created_at"}
+
+// GetDriverListRequest searches drivers by a full_name or phone substring and
+// filters them by their usual route.
+type GetDriverListRequest struct {
+	GetListRequest
+	FromCityID string `json:"from_city_id"`
+	ToCityID   string `json:"to_city_id"`
+}
+
+// GetDriverFullRequest asks for a driver's profile with the trips created in
+// [From, To). A zero bound leaves that side of the range open.
+type GetDriverFullRequest struct {
+	ID   string    `json:"id"`
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+type DriverFull struct {
+	Driver
+	Car   *Car         `json:"car"`
+	Trips []DriverTrip `json:"trips"`
+}
+
+// DriverTrip is a trip of the driver's schedule. Date is Trip.Date.
+type DriverTrip struct {
+	Trip
+	Date      string     `json:"date"`
+	Customers []Customer `json:"customers"`
 }
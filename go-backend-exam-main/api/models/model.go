@@ -1,8 +1,100 @@
 package models
 
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Nested objects a read can join into its result.
+const (
+	ExpandFromCity = "from_city"
+	ExpandToCity   = "to_city"
+	ExpandDriver   = "driver"
+	ExpandCustomer = "customer"
+)
+
+// Expand is the set of nested objects a caller wants hydrated. A nil Expand
+// means everything; an empty, non-nil one means nothing but IDs.
+type Expand map[string]bool
+
+func (e Expand) Has(name string) bool {
+	return e == nil || e[name]
+}
+
+// SortField orders a list by one whitelisted field, descending when Desc.
+type SortField struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc"`
+}
+
+// GetListRequest holds the query every list endpoint understands: paging,
+// sort=field,-field ordering, a free text search and the expand set. The
+// entity specific list requests embed it and add their own filters.
+//
+// In cursor mode Page and Sort are ignored: rows come newest first by
+// (created_at, id), starting after After, and Count is only filled in when
+// WithCount is set.
 type GetListRequest struct {
-	Page  int `json:"page"`
-	Limit int `json:"limit"`
+	Page       int         `json:"page"`
+	Limit      int         `json:"limit"`
+	Sort       []SortField `json:"sort"`
+	Search     string      `json:"search"`
+	Expand     Expand      `json:"-"`
+	CursorMode bool        `json:"-"`
+	After      *Cursor     `json:"-"`
+	WithCount  bool        `json:"-"`
+}
+
+// NeedsCount reports whether the list query has to count all matching rows.
+func (r GetListRequest) NeedsCount() bool {
+	return !r.CursorMode || r.WithCount
+}
+
+// Cursor is a keyset position: the (created_at, id) of the last row of a
+// page. Clients only ever see it encoded, as next_cursor.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+func (c Cursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.CreatedAt.Format(time.RFC3339Nano) + "|" + c.ID))
+}
+
+func ParseCursor(s string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, errors.New("malformed cursor")
+	}
+
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return Cursor{}, errors.New("malformed cursor")
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return Cursor{}, errors.New("malformed cursor")
+	}
+
+	return Cursor{CreatedAt: t, ID: id}, nil
+}
+
+// NextCursor trims a cursor mode page fetched with one extra row back to
+// limit rows and returns the encoded cursor of its last row, or "" when
+// there is no further page. key gives a row's created_at and id.
+func NextCursor[T any](rows []T, limit int, key func(T) (string, string)) ([]T, string) {
+	if len(rows) <= limit {
+		return rows, ""
+	}
+
+	rows = rows[:limit]
+	createdAt, id := key(rows[limit-1])
+	t, _ := time.Parse(time.RFC3339Nano, createdAt)
+
+	return rows, Cursor{CreatedAt: t, ID: id}.Encode()
 }
 
 type PrimaryKey struct {
@@ -5,3 +5,17 @@ type Response struct {
 	Description string
 	Data        interface{}
 }
+
+// Error is the Data of every error response: a machine-readable code and a
+// message for people.
+type Error struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError says what is wrong with one field of a request body.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
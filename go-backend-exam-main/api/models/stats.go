@@ -0,0 +1,16 @@
+package models
+
+// Stats are the business figures exported as metrics.
+type Stats struct {
+	Trips    int
+	Bookings int
+	// OnlineCars counts the online cars by the city their route leaves
+	// from; cars without a route are left out.
+	OnlineCars []CityCount
+}
+
+type CityCount struct {
+	CityID string
+	City   string
+	Count  int
+}
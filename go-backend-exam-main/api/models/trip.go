@@ -1,28 +1,148 @@
 package models
 
+import "time"
+
+// The statuses of a trip. A trip starts out scheduled; see
+// CanTransitionTrip for where it may go from there.
+const (
+	TripScheduled  = "scheduled"
+	TripBoarding   = "boarding"
+	TripInProgress = "in_progress"
+	TripCompleted  = "completed"
+	TripCancelled  = "cancelled"
+)
+
+var TripStatuses = []string{TripScheduled, TripBoarding, TripInProgress, TripCompleted, TripCancelled}
+
+// tripTransitions lists, by status, the statuses a trip may move to.
+// Completed and cancelled trips are final.
+var tripTransitions = map[string][]string{
+	TripScheduled:  {TripBoarding, TripInProgress, TripCancelled},
+	TripBoarding:   {TripInProgress, TripCancelled},
+	TripInProgress: {TripCompleted},
+}
+
+// CanTransitionTrip reports whether a trip may move from status from to
+// status to.
+func CanTransitionTrip(from, to string) bool {
+	for _, next := range tripTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TripOpenForBooking reports whether a trip in status takes new bookings:
+// only until it leaves.
+func TripOpenForBooking(status string) bool {
+	return status == TripScheduled || status == TripBoarding
+}
+
+// TripEditable reports whether a trip in status may be updated, and
+// whether its schedule may too: a scheduled trip entirely, a boarding one
+// all but its schedule, and none once it has departed or been cancelled.
+func TripEditable(status string) (fields, schedule bool) {
+	switch status {
+	case TripScheduled:
+		return true, true
+	case TripBoarding:
+		return true, false
+	default:
+		return false, false
+	}
+}
+
+// Trip carries its timetable: the scheduled departure and arrival, either
+// of which may be unset, and the actual ones, set when the trip starts and
+// completes. Status is only changed through the transition endpoints; an
+// update leaves it and the actual times alone.
 type Trip struct {
-	ID           string `json:"id"`
-	TripNumberID string `json:"trip_number_id"`
-	FromCityID   string `json:"from_city_id"`
-	FromCityData City   `json:"from_city_data"`
-	ToCityID     string `json:"to_city_id"`
-	ToCityData   City   `json:"to_city_data"`
-	DriverID     string `json:"driver_id"`
-	DriverData   Driver `json:"driver_data"`
-	Price        int    `json:"price"`
-	CreatedAt    string `json:"created_at"`
+	ID                 string `json:"id"`
+	TripNumberID       string `json:"trip_number_id"`
+	FromCityID         string `json:"from_city_id"`
+	FromCityData       City   `json:"from_city_data"`
+	ToCityID           string `json:"to_city_id"`
+	ToCityData         City   `json:"to_city_data"`
+	DriverID           string `json:"driver_id"`
+	DriverData         Driver `json:"driver_data"`
+	Price              int    `json:"price"`
+	Status             string `json:"status"`
+	ScheduledDeparture string `json:"scheduled_departure"`
+	ScheduledArrival   string `json:"scheduled_arrival"`
+	DepartedAt         string `json:"departed_at"`
+	ArrivedAt          string `json:"arrived_at"`
+	CreatedAt          string `json:"created_at"`
 }
 
+// CreateTrip carries no trip number: the database assigns T-<n> from
+// trip_number_seq on insert. The scheduled times are RFC 3339.
 type CreateTrip struct {
-	TripNumberID string `json:"trip_number_id"`
-	FromCityID   string `json:"from_city_id"`
-	ToCityID     string `json:"to_city_id"`
-	DriverID     string `json:"driver_id"`
-	Price        int    `json:"price"`
-	CreatedAt    string `json:"created_at"`
+	FromCityID         string `json:"from_city_id"`
+	ToCityID           string `json:"to_city_id"`
+	DriverID           string `json:"driver_id"`
+	Price              int    `json:"price"`
+	ScheduledDeparture string `json:"scheduled_departure"`
+	ScheduledArrival   string `json:"scheduled_arrival"`
+	CreatedAt          string `json:"created_at"`
+}
+
+// Date is when the trip runs: its scheduled departure or, for a trip
+// without a schedule, when it was entered.
+func (t Trip) Date() string {
+	if t.ScheduledDeparture != "" {
+		return t.ScheduledDeparture
+	}
+	return t.CreatedAt
+}
+
+// TripTransition moves a trip to Status at At, on behalf of the actor.
+type TripTransition struct {
+	TripID    string
+	Status    string
+	ActorID   string
+	ActorRole string
+	At        time.Time
+}
+
+// TripEvent records a status change of a trip and who made it.
+type TripEvent struct {
+	ID         string `json:"id"`
+	TripID     string `json:"trip_id"`
+	FromStatus string `json:"from_status"`
+	ToStatus   string `json:"to_status"`
+	ActorID    string `json:"actor_id"`
+	ActorRole  string `json:"actor_role"`
+	CreatedAt  string `json:"created_at"`
+}
+
+type TripEventsResponse struct {
+	Events []TripEvent `json:"events"`
 }
 
 type TripsResponse struct {
-	Trips []Trip `json:"trips"`
-	Count int    `json:"count"`
+	Trips      []Trip `json:"trips"`
+	Count      int    `json:"count"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+var TripSortFields = []string{"price", "scheduled_departure", "created_at"}
+
+// GetTripListRequest filters trips by route, driver, status, price range
+// and the [CreatedFrom, CreatedTo) date range. Zero values leave a filter
+// off.
+type GetTripListRequest struct {
+	GetListRequest
+	FromCityID  string    `json:"from_city_id"`
+	ToCityID    string    `json:"to_city_id"`
+	DriverID    string    `json:"driver_id"`
+	Status      string    `json:"status"`
+	MinPrice    *int      `json:"min_price"`
+	MaxPrice    *int      `json:"max_price"`
+	CreatedFrom time.Time `json:"created_from"`
+	CreatedTo   time.Time `json:"created_to"`
+	// DepartureFrom and DepartureTo bound the scheduled departure, both
+	// ends included; trips without one are left out.
+	DepartureFrom time.Time `json:"departure_from"`
+	DepartureTo   time.Time `json:"departure_to"`
 }
@@ -1,11 +1,44 @@
 package models
 
+import "time"
+
+// TripCustomer is a booking. A cancelled one keeps its row, with the
+// Cancellation, but no longer holds a seat.
 type TripCustomer struct {
-	ID           string   `json:"id"`
-	TripID       string   `json:"trip_id"`
-	CustomerID   string   `json:"customer_id"`
-	CustomerData Customer `json:"customer_data"`
-	CreatedAt    string   `json:"created_at"`
+	ID           string        `json:"id"`
+	TripID       string        `json:"trip_id"`
+	CustomerID   string        `json:"customer_id"`
+	CustomerData Customer      `json:"customer_data"`
+	Cancellation *Cancellation `json:"cancellation,omitempty"`
+	CreatedAt    string        `json:"created_at"`
+}
+
+// Cancellation tells who cancelled a booking, when and why, and how the
+// price was split between the refund and the penalty kept.
+type Cancellation struct {
+	CancelledAt string `json:"cancelled_at"`
+	ActorID     string `json:"actor_id"`
+	ActorRole   string `json:"actor_role"`
+	Reason      string `json:"reason"`
+	Refund      int    `json:"refund"`
+	Penalty     int    `json:"penalty"`
+}
+
+// CancelTripCustomerRequest is the body of a cancellation; the reason is
+// optional.
+type CancelTripCustomerRequest struct {
+	Reason string `json:"reason"`
+}
+
+// CancelTripCustomer cancels the booking ID at At on behalf of the actor.
+type CancelTripCustomer struct {
+	ID        string
+	ActorID   string
+	ActorRole string
+	Reason    string
+	Refund    int
+	Penalty   int
+	At        time.Time
 }
 
 type CreateTripCustomer struct {
@@ -16,4 +49,16 @@ type CreateTripCustomer struct {
 type TripCustomersResponse struct {
 	TripCustomers []TripCustomer `json:"trip_customers"`
 	Count         int            `json:"count"`
+	NextCursor    string         `json:"next_cursor,omitempty"`
+}
+
+var TripCustomerSortFields = []string{"created_at"}
+
+// GetTripCustomerListRequest filters bookings by trip, customer and whether
+// they are cancelled. A nil Cancelled lists both.
+type GetTripCustomerListRequest struct {
+	GetListRequest
+	TripID     string `json:"trip_id"`
+	CustomerID string `json:"customer_id"`
+	Cancelled  *bool  `json:"cancelled"`
 }
@@ -1,15 +1,157 @@
 package api
 
 import (
-	"city2city/api/handler"
+	"crypto/subtle"
+	"log/slog"
 	"net/http"
+	"strings"
+
+	"city2city/api/docs"
+	"city2city/api/handler"
+	"city2city/api/middleware"
+	"city2city/api/router"
+	"city2city/config"
+	"city2city/metrics"
 )
 
-func New(h handler.Handler) {
+// New returns the API: the /v1 resource routes and, for a deprecation
+// period and unless turned off in cfg, the old query-string routes, behind
+// the middleware every request goes through.
+func New(h handler.Handler, cfg config.Config, logger *slog.Logger, reg *metrics.Registry) http.Handler {
+	return middleware.Chain(routes(h, metricsAccess(cfg.MetricsToken, reg), cfg),
+		middleware.RequestID,
+		middleware.AccessLog(logger),
+		middleware.Metrics(reg),
+		middleware.Recover(logger),
+		middleware.CORS(middleware.CORSConfig{
+			AllowedOrigins: cfg.CORSAllowedOrigins,
+			AllowedMethods: cfg.CORSAllowedMethods,
+			AllowedHeaders: cfg.CORSAllowedHeaders,
+			ExposedHeaders: []string{middleware.RequestIDHeader, "Deprecation", "Link"},
+			MaxAge:         cfg.CORSMaxAge,
+		}),
+		h.QueryTimeout,
+	)
+}
+
+// routes registers every route the features in cfg turn on. Each needs an
+// entry in operations.
+func routes(h handler.Handler, metrics http.HandlerFunc, cfg config.Config) *router.Router {
+	r := router.New()
+	auth := h.Authenticate
+
+	if cfg.Docs {
+		r.Handle(http.MethodGet, "/openapi.json", docs.ServeOpenAPI)
+		r.Handle(http.MethodGet, "/docs", docs.ServeDocs)
+	}
+	r.Handle(http.MethodGet, "/metrics", metrics)
+	r.Handle(http.MethodGet, "/healthz", h.Healthz)
+	r.Handle(http.MethodGet, "/readyz", h.Readyz)
+
+	r.Handle(http.MethodPost, "/v1/auth/otp", h.SendOTP)
+	r.Handle(http.MethodPost, "/v1/auth/otp/verify", h.VerifyOTP)
+	r.Handle(http.MethodPost, "/v1/auth/login", h.AdminLogin)
+	r.Handle(http.MethodPost, "/v1/auth/refresh", h.Refresh)
+
+	r.Handle(http.MethodPost, "/v1/admins", auth(h.Admin))
+
+	r.Handle(http.MethodGet, "/v1/cities", auth(h.GetCityList))
+	r.Handle(http.MethodPost, "/v1/cities", auth(h.CreateCity))
+	r.Handle(http.MethodGet, "/v1/cities/{id}", auth(h.GetCityByID))
+	r.Handle(http.MethodPut, "/v1/cities/{id}", auth(h.UpdateCity))
+	r.Handle(http.MethodDelete, "/v1/cities/{id}", auth(h.DeleteCity))
+
+	r.Handle(http.MethodGet, "/v1/customers", auth(h.GetCustomerList))
+	r.Handle(http.MethodPost, "/v1/customers", auth(h.CreateCustomer))
+	r.Handle(http.MethodGet, "/v1/customers/{id}", auth(h.GetCustomerByID))
+	r.Handle(http.MethodPut, "/v1/customers/{id}", auth(h.UpdateCustomer))
+	r.Handle(http.MethodDelete, "/v1/customers/{id}", auth(h.DeleteCustomer))
+
+	r.Handle(http.MethodGet, "/v1/drivers", auth(h.GetDriverList))
+	r.Handle(http.MethodPost, "/v1/drivers", auth(h.CreateDriver))
+	r.Handle(http.MethodGet, "/v1/drivers/{id}", auth(h.GetDriverByID))
+	r.Handle(http.MethodPut, "/v1/drivers/{id}", auth(h.UpdateDriver))
+	r.Handle(http.MethodDelete, "/v1/drivers/{id}", auth(h.DeleteDriver))
+	r.Handle(http.MethodGet, "/v1/drivers/{id}/full", auth(h.DriverFull))
+
+	r.Handle(http.MethodGet, "/v1/cars", auth(h.GetCarList))
+	r.Handle(http.MethodPost, "/v1/cars", auth(h.CreateCar))
+	r.Handle(http.MethodGet, "/v1/cars/available", auth(h.GetAvailableCarList))
+	r.Handle(http.MethodGet, "/v1/cars/{id}", auth(h.GetCarByID))
+	r.Handle(http.MethodPut, "/v1/cars/{id}", auth(h.UpdateCar))
+	r.Handle(http.MethodDelete, "/v1/cars/{id}", auth(h.DeleteCar))
+	r.Handle(http.MethodPut, "/v1/cars/{id}/status", auth(h.UpdateCarStatus))
+	r.Handle(http.MethodPut, "/v1/cars/{id}/route", auth(h.UpdateCarRoute))
+
+	r.Handle(http.MethodGet, "/v1/trips", auth(h.GetTripList))
+	r.Handle(http.MethodPost, "/v1/trips", auth(h.CreateTrip))
+	r.Handle(http.MethodGet, "/v1/trips/by-number/{number}", auth(h.GetTripByNumber))
+	r.Handle(http.MethodGet, "/v1/trips/{id}", auth(h.GetTripByID))
+	r.Handle(http.MethodPut, "/v1/trips/{id}", auth(h.UpdateTrip))
+	r.Handle(http.MethodDelete, "/v1/trips/{id}", auth(h.DeleteTrip))
+	r.Handle(http.MethodPost, "/v1/trips/{id}/board", auth(h.BoardTrip))
+	r.Handle(http.MethodPost, "/v1/trips/{id}/start", auth(h.StartTrip))
+	r.Handle(http.MethodPost, "/v1/trips/{id}/complete", auth(h.CompleteTrip))
+	r.Handle(http.MethodPost, "/v1/trips/{id}/cancel", auth(h.CancelTrip))
+	r.Handle(http.MethodGet, "/v1/trips/{id}/events", auth(h.GetTripEvents))
+	r.Handle(http.MethodGet, "/v1/trips/{trip_id}/customers", auth(h.GetTripCustomerList))
+	r.Handle(http.MethodPost, "/v1/trips/{trip_id}/customers", auth(h.CreateTripCustomer))
+
+	r.Handle(http.MethodGet, "/v1/trip-customers", auth(h.GetTripCustomerList))
+	r.Handle(http.MethodGet, "/v1/trip-customers/{id}", auth(h.GetTripCustomerByID))
+	r.Handle(http.MethodPut, "/v1/trip-customers/{id}", auth(h.UpdateTripCustomer))
+	r.Handle(http.MethodDelete, "/v1/trip-customers/{id}", auth(h.DeleteTripCustomer))
+	r.Handle(http.MethodPost, "/v1/trip-customers/{id}/cancel", auth(h.CancelTripCustomer))
+
+	if cfg.LegacyRoutes {
+		legacy(r, h)
+	}
+
+	return r
+}
+
+// legacy mounts the routes from before /v1, marked deprecated with a link
+// to their successor.
+func legacy(r *router.Router, h handler.Handler) {
+	auth := h.Authenticate
+
+	r.Handle(http.MethodPost, "/auth/otp", deprecated("/v1/auth/otp", h.SendOTP))
+	r.Handle(http.MethodPost, "/auth/otp/verify", deprecated("/v1/auth/otp/verify", h.VerifyOTP))
+	r.Handle(http.MethodPost, "/auth/login", deprecated("/v1/auth/login", h.AdminLogin))
+	r.Handle(http.MethodPost, "/auth/refresh", deprecated("/v1/auth/refresh", h.Refresh))
+
+	r.Handle(http.MethodPost, "/admin", deprecated("/v1/admins", auth(h.Admin)))
+	r.Handle(router.AnyMethod, "/city", deprecated("/v1/cities", auth(h.City)))
+	r.Handle(router.AnyMethod, "/customer", deprecated("/v1/customers", auth(h.Customer)))
+	r.Handle(router.AnyMethod, "/driver", deprecated("/v1/drivers", auth(h.Driver)))
+	r.Handle(http.MethodGet, "/driver/full", deprecated("/v1/drivers/{id}/full", auth(h.DriverFull)))
+	r.Handle(router.AnyMethod, "/car", deprecated("/v1/cars", auth(h.Car)))
+	r.Handle(router.AnyMethod, "/trip", deprecated("/v1/trips", auth(h.Trip)))
+	r.Handle(router.AnyMethod, "/trip_customer", deprecated("/v1/trip-customers", auth(h.TripCustomer)))
+}
+
+// metricsAccess serves reg to scrapers, which must send token as a bearer
+// token when one is configured.
+func metricsAccess(token string, reg *metrics.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			got, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		reg.ServeHTTP(w, r)
+	}
+}
 
-	http.HandleFunc("/city", h.City)
-	http.HandleFunc("/customer", h.Customer)
-	http.HandleFunc("/driver", h.Driver)
-	http.HandleFunc("/car", h.Car)
-	http.HandleFunc("/trip", h.Trip)
+// deprecated marks responses of an old route with the Deprecation header
+// and links to the route replacing it.
+func deprecated(successor string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		next(w, r)
+	}
 }
@@ -0,0 +1,210 @@
+// Package router matches request paths with {name} parameters and
+// dispatches on method, answering 405 with an Allow header for methods a
+// path does not support.
+package router
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// AnyMethod registers a handler that serves every method of a path.
+const AnyMethod = "*"
+
+type Router struct {
+	routes []*route
+}
+
+type route struct {
+	pattern  string
+	segments []string
+	handlers map[string]http.Handler
+}
+
+type (
+	paramsKey  struct{}
+	patternKey struct{}
+)
+
+func New() *Router {
+	return &Router{}
+}
+
+// Handle registers h for method on pattern, a path whose segments are
+// literals or {name} parameters, such as /v1/cities/{id}.
+func (rt *Router) Handle(method, pattern string, h http.HandlerFunc) {
+	for _, existing := range rt.routes {
+		if existing.pattern == pattern {
+			existing.handlers[method] = h
+			return
+		}
+	}
+
+	rt.routes = append(rt.routes, &route{
+		pattern:  pattern,
+		segments: split(pattern),
+		handlers: map[string]http.Handler{method: h},
+	})
+}
+
+// Route is one registered method and pattern.
+type Route struct {
+	Method  string
+	Pattern string
+}
+
+// Routes lists what was registered, in registration order.
+func (rt *Router) Routes() []Route {
+	var routes []Route
+	for _, route := range rt.routes {
+		methods := make([]string, 0, len(route.handlers))
+		for method := range route.handlers {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+
+		for _, method := range methods {
+			routes = append(routes, Route{Method: method, Pattern: route.pattern})
+		}
+	}
+	return routes
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route, params := rt.match(r.URL.Path)
+	if route == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if pattern, ok := r.Context().Value(patternKey{}).(*string); ok {
+		*pattern = route.pattern
+	}
+
+	h, ok := route.handler(r.Method)
+	if !ok {
+		w.Header().Set("Allow", route.allow())
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if len(params) > 0 {
+		r = r.WithContext(context.WithValue(r.Context(), paramsKey{}, params))
+	}
+	h.ServeHTTP(w, r)
+}
+
+// Param returns the path parameter name of the route that matched r, or ""
+// when it has none.
+func Param(r *http.Request, name string) string {
+	params, _ := r.Context().Value(paramsKey{}).(map[string]string)
+	return params[name]
+}
+
+// RecordPattern returns r with room for the pattern of the route that will
+// match it, and that pattern once the router has served r; "" when no route
+// matched. Middleware outside the router uses it to label requests by route
+// rather than by path.
+func RecordPattern(r *http.Request) (*http.Request, *string) {
+	pattern := new(string)
+	return r.WithContext(context.WithValue(r.Context(), patternKey{}, pattern)), pattern
+}
+
+// match finds the route for path. When several match, the one whose first
+// differing segment is a literal wins, so /cars/available beats /cars/{id}.
+func (rt *Router) match(path string) (*route, map[string]string) {
+	var (
+		best       *route
+		bestParams map[string]string
+		segments   = split(path)
+	)
+
+	for _, route := range rt.routes {
+		params, ok := route.match(segments)
+		if !ok {
+			continue
+		}
+		if best == nil || route.moreSpecific(best) {
+			best, bestParams = route, params
+		}
+	}
+
+	return best, bestParams
+}
+
+func (rt *route) match(segments []string) (map[string]string, bool) {
+	if len(segments) != len(rt.segments) {
+		return nil, false
+	}
+
+	var params map[string]string
+	for i, segment := range rt.segments {
+		if name, ok := param(segment); ok {
+			if segments[i] == "" {
+				return nil, false
+			}
+			if params == nil {
+				params = map[string]string{}
+			}
+			params[name] = segments[i]
+		} else if segment != segments[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+func (rt *route) moreSpecific(other *route) bool {
+	for i, segment := range rt.segments {
+		_, isParam := param(segment)
+		_, otherIsParam := param(other.segments[i])
+		if isParam != otherIsParam {
+			return otherIsParam
+		}
+	}
+	return false
+}
+
+// handler returns the handler for method. HEAD falls back to GET.
+func (rt *route) handler(method string) (http.Handler, bool) {
+	if h, ok := rt.handlers[method]; ok {
+		return h, true
+	}
+	if method == http.MethodHead {
+		if h, ok := rt.handlers[http.MethodGet]; ok {
+			return h, true
+		}
+	}
+	h, ok := rt.handlers[AnyMethod]
+	return h, ok
+}
+
+func (rt *route) allow() string {
+	methods := []string{http.MethodOptions}
+	for method := range rt.handlers {
+		methods = append(methods, method)
+		if method == http.MethodGet {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
+
+func split(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+func param(segment string) (string, bool) {
+	if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return segment[1 : len(segment)-1], true
+	}
+	return "", false
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"city2city/api/docs"
+	"city2city/api/handler"
+	"city2city/api/models"
+	"city2city/api/router"
+	"city2city/auth"
+	"city2city/config"
+)
+
+var listQuery = []docs.Param{
+	{Name: "page", Type: "integer", Description: "page number, from 1"},
+	{Name: "limit", Type: "integer", Description: "page size, 10 by default, up to 100 unless configured otherwise"},
+	{Name: "sort", Type: "string", Description: "comma separated fields, - for descending"},
+	{Name: "expand", Type: "string", Description: "comma separated relations to embed"},
+	{Name: "cursor", Type: "string", Description: "keyset paging: empty for the first page, then next_cursor"},
+	{Name: "count", Type: "boolean", Description: "with cursor, also count the total"},
+}
+
+var searchQuery = docs.Param{Name: "search", Type: "string", Description: "text to look for"}
+
+var cancelledQuery = docs.Param{Name: "cancelled", Type: "boolean", Description: "only cancelled bookings, or only active ones"}
+
+func list(params ...docs.Param) []docs.Param {
+	return append(append([]docs.Param{}, listQuery...), params...)
+}
+
+// operations documents every route New registers. CheckSpec keeps the two
+// in step.
+var operations = []docs.Op{
+	{Method: http.MethodGet, Path: "/openapi.json", Tag: "docs", Summary: "This OpenAPI document", Public: true, Produces: "application/json"},
+	{Method: http.MethodGet, Path: "/docs", Tag: "docs", Summary: "API documentation page", Public: true, Produces: "text/html"},
+	{Method: http.MethodGet, Path: "/metrics", Tag: "ops", Summary: "Prometheus metrics; needs METRICS_TOKEN as a bearer token when it is set", Public: true, Produces: "text/plain"},
+	{Method: http.MethodGet, Path: "/healthz", Tag: "ops", Summary: "Liveness: the process answers", Public: true},
+	{Method: http.MethodGet, Path: "/readyz", Tag: "ops", Summary: "Readiness: the database answers and its schema is current; 503 lists the failed checks", Public: true},
+
+	{Method: http.MethodPost, Path: "/v1/auth/otp", Tag: "auth", Summary: "Send a login code by SMS", Public: true, Body: models.SendOTPRequest{}},
+	{Method: http.MethodPost, Path: "/v1/auth/otp/verify", Tag: "auth", Summary: "Exchange a login code for tokens", Public: true, Body: models.VerifyOTPRequest{}, Data: auth.TokenPair{}},
+	{Method: http.MethodPost, Path: "/v1/auth/login", Tag: "auth", Summary: "Log in as staff", Public: true, Body: models.AdminLoginRequest{}, Data: auth.TokenPair{}},
+	{Method: http.MethodPost, Path: "/v1/auth/refresh", Tag: "auth", Summary: "Exchange a refresh token for new tokens", Public: true, Body: models.RefreshRequest{}, Data: auth.TokenPair{}},
+
+	{Method: http.MethodPost, Path: "/v1/admins", Tag: "admins", Summary: "Create a staff account", Status: http.StatusCreated, Body: models.CreateAdmin{}, Data: models.Admin{}},
+
+	{Method: http.MethodGet, Path: "/v1/cities", Tag: "cities", Summary: "List cities", Query: list(searchQuery), Data: models.CitiesResponse{}},
+	{Method: http.MethodPost, Path: "/v1/cities", Tag: "cities", Summary: "Create a city", Status: http.StatusCreated, Body: models.CreateCity{}, Data: models.City{}},
+	{Method: http.MethodGet, Path: "/v1/cities/{id}", Tag: "cities", Summary: "Get a city", Data: models.City{}},
+	{Method: http.MethodPut, Path: "/v1/cities/{id}", Tag: "cities", Summary: "Update a city", Body: models.City{}, Data: models.City{}},
+	{Method: http.MethodDelete, Path: "/v1/cities/{id}", Tag: "cities", Summary: "Delete a city"},
+
+	{Method: http.MethodGet, Path: "/v1/customers", Tag: "customers", Summary: "List customers", Query: list(searchQuery), Data: models.CustomersResponse{}},
+	{Method: http.MethodPost, Path: "/v1/customers", Tag: "customers", Summary: "Create a customer", Status: http.StatusCreated, Body: models.CreateCustomer{}, Data: models.Customer{}},
+	{Method: http.MethodGet, Path: "/v1/customers/{id}", Tag: "customers", Summary: "Get a customer", Data: models.Customer{}},
+	{Method: http.MethodPut, Path: "/v1/customers/{id}", Tag: "customers", Summary: "Update a customer", Body: models.Customer{}, Data: models.Customer{}},
+	{Method: http.MethodDelete, Path: "/v1/customers/{id}", Tag: "customers", Summary: "Delete a customer"},
+
+	{Method: http.MethodGet, Path: "/v1/drivers", Tag: "drivers", Summary: "List drivers", Data: models.DriversResponse{}, Query: list(searchQuery,
+		docs.Param{Name: "from_city_id", Type: "string"},
+		docs.Param{Name: "to_city_id", Type: "string"},
+	)},
+	{Method: http.MethodPost, Path: "/v1/drivers", Tag: "drivers", Summary: "Create a driver", Status: http.StatusCreated, Body: models.CreateDriver{}, Data: models.Driver{}},
+	{Method: http.MethodGet, Path: "/v1/drivers/{id}", Tag: "drivers", Summary: "Get a driver", Data: models.Driver{}},
+	{Method: http.MethodPut, Path: "/v1/drivers/{id}", Tag: "drivers", Summary: "Update a driver", Body: models.Driver{}, Data: models.Driver{}},
+	{Method: http.MethodDelete, Path: "/v1/drivers/{id}", Tag: "drivers", Summary: "Delete a driver"},
+	{Method: http.MethodGet, Path: "/v1/drivers/{id}/full", Tag: "drivers", Summary: "Get a driver with their car and trips", Data: models.DriverFull{}, Query: []docs.Param{
+		{Name: "from", Type: "string:date", Description: "first day of trips, by scheduled departure"},
+		{Name: "to", Type: "string:date", Description: "last day of trips, by scheduled departure"},
+	}},
+
+	{Method: http.MethodGet, Path: "/v1/cars", Tag: "cars", Summary: "List cars", Data: models.CarsResponse{}, Query: list(searchQuery,
+		docs.Param{Name: "status", Type: "boolean"},
+		docs.Param{Name: "brand", Type: "string"},
+		docs.Param{Name: "driver_id", Type: "string"},
+		docs.Param{Name: "from_city_id", Type: "string"},
+		docs.Param{Name: "to_city_id", Type: "string"},
+		docs.Param{Name: "departure_from", Type: "string:date-time"},
+		docs.Param{Name: "departure_to", Type: "string:date-time"},
+	)},
+	{Method: http.MethodPost, Path: "/v1/cars", Tag: "cars", Summary: "Create a car", Status: http.StatusCreated, Body: models.CreateCar{}, Data: models.Car{}},
+	{Method: http.MethodGet, Path: "/v1/cars/available", Tag: "cars", Summary: "List online cars leaving soon on a route", Data: models.CarsResponse{}, Query: list(
+		docs.Param{Name: "from_city_id", Type: "string", Required: true},
+		docs.Param{Name: "to_city_id", Type: "string", Required: true},
+		docs.Param{Name: "brand", Type: "string"},
+		docs.Param{Name: "departure_from", Type: "string:date-time", Description: "defaults to now"},
+		docs.Param{Name: "departure_to", Type: "string:date-time", Description: "defaults to an hour after departure_from"},
+	)},
+	{Method: http.MethodGet, Path: "/v1/cars/{id}", Tag: "cars", Summary: "Get a car", Data: models.Car{}},
+	{Method: http.MethodPut, Path: "/v1/cars/{id}", Tag: "cars", Summary: "Update a car", Body: models.Car{}, Data: models.Car{}},
+	{Method: http.MethodDelete, Path: "/v1/cars/{id}", Tag: "cars", Summary: "Delete a car"},
+	{Method: http.MethodPut, Path: "/v1/cars/{id}/status", Tag: "cars", Summary: "Put a car online or offline", Body: models.UpdateCarStatus{}},
+	{Method: http.MethodPut, Path: "/v1/cars/{id}/route", Tag: "cars", Summary: "Set the route and departure of a car", Body: models.UpdateCarRoute{}},
+
+	{Method: http.MethodGet, Path: "/v1/trips", Tag: "trips", Summary: "List trips", Data: models.TripsResponse{}, Query: list(
+		docs.Param{Name: "from_city_id", Type: "string"},
+		docs.Param{Name: "to_city_id", Type: "string"},
+		docs.Param{Name: "driver_id", Type: "string"},
+		docs.Param{Name: "status", Type: "string", Description: "scheduled, boarding, in_progress, completed or cancelled"},
+		docs.Param{Name: "min_price", Type: "integer"},
+		docs.Param{Name: "max_price", Type: "integer"},
+		docs.Param{Name: "date_from", Type: "string:date", Description: "first day the trip was created"},
+		docs.Param{Name: "date_to", Type: "string:date", Description: "last day the trip was created"},
+		docs.Param{Name: "departure_from", Type: "string:date-time", Description: "earliest scheduled departure"},
+		docs.Param{Name: "departure_to", Type: "string:date-time", Description: "latest scheduled departure"},
+	)},
+	{Method: http.MethodPost, Path: "/v1/trips", Tag: "trips", Summary: "Create a trip", Status: http.StatusCreated, Body: models.CreateTrip{}, Data: models.Trip{}},
+	{Method: http.MethodGet, Path: "/v1/trips/by-number/{number}", Tag: "trips", Summary: "Get a trip by its number", Data: models.Trip{}},
+	{Method: http.MethodGet, Path: "/v1/trips/{id}", Tag: "trips", Summary: "Get a trip", Data: models.Trip{}},
+	{Method: http.MethodPut, Path: "/v1/trips/{id}", Tag: "trips", Summary: "Update a trip that has not departed, its schedule only before boarding", Body: models.Trip{}, Data: models.Trip{}},
+	{Method: http.MethodDelete, Path: "/v1/trips/{id}", Tag: "trips", Summary: "Delete a trip"},
+	{Method: http.MethodPost, Path: "/v1/trips/{id}/board", Tag: "trips", Summary: "Open a scheduled trip for boarding", Data: models.Trip{}},
+	{Method: http.MethodPost, Path: "/v1/trips/{id}/start", Tag: "trips", Summary: "Depart on a scheduled or boarding trip", Data: models.Trip{}},
+	{Method: http.MethodPost, Path: "/v1/trips/{id}/complete", Tag: "trips", Summary: "Arrive at the end of a trip in progress", Data: models.Trip{}},
+	{Method: http.MethodPost, Path: "/v1/trips/{id}/cancel", Tag: "trips", Summary: "Cancel a trip that has not departed", Data: models.Trip{}},
+	{Method: http.MethodGet, Path: "/v1/trips/{id}/events", Tag: "trips", Summary: "List the status changes of a trip", Data: models.TripEventsResponse{}},
+	{Method: http.MethodGet, Path: "/v1/trips/{trip_id}/customers", Tag: "trips", Summary: "List the bookings of a trip", Data: models.TripCustomersResponse{}, Query: list(
+		docs.Param{Name: "customer_id", Type: "string"},
+		cancelledQuery,
+	)},
+	{Method: http.MethodPost, Path: "/v1/trips/{trip_id}/customers", Tag: "trips", Summary: "Book a seat on a trip", Status: http.StatusCreated, Body: models.CreateTripCustomer{}, Data: models.TripCustomer{}},
+
+	{Method: http.MethodGet, Path: "/v1/trip-customers", Tag: "trip-customers", Summary: "List bookings", Data: models.TripCustomersResponse{}, Query: list(
+		docs.Param{Name: "trip_id", Type: "string"},
+		docs.Param{Name: "customer_id", Type: "string"},
+		cancelledQuery,
+	)},
+	{Method: http.MethodGet, Path: "/v1/trip-customers/{id}", Tag: "trip-customers", Summary: "Get a booking", Data: models.TripCustomer{}},
+	{Method: http.MethodPut, Path: "/v1/trip-customers/{id}", Tag: "trip-customers", Summary: "Update a booking", Body: models.TripCustomer{}, Data: models.TripCustomer{}},
+	{Method: http.MethodDelete, Path: "/v1/trip-customers/{id}", Tag: "trip-customers", Summary: "Erase a booking, admins only; cancel it instead"},
+	{Method: http.MethodPost, Path: "/v1/trip-customers/{id}/cancel", Tag: "trip-customers", Summary: "Cancel a booking, refunded by how long before departure", Body: models.CancelTripCustomerRequest{}, Data: models.TripCustomer{}},
+
+	{Method: http.MethodPost, Path: "/auth/otp", Tag: "legacy", Summary: "Use POST /v1/auth/otp", Public: true, Deprecated: true, Body: models.SendOTPRequest{}},
+	{Method: http.MethodPost, Path: "/auth/otp/verify", Tag: "legacy", Summary: "Use POST /v1/auth/otp/verify", Public: true, Deprecated: true, Body: models.VerifyOTPRequest{}, Data: auth.TokenPair{}},
+	{Method: http.MethodPost, Path: "/auth/login", Tag: "legacy", Summary: "Use POST /v1/auth/login", Public: true, Deprecated: true, Body: models.AdminLoginRequest{}, Data: auth.TokenPair{}},
+	{Method: http.MethodPost, Path: "/auth/refresh", Tag: "legacy", Summary: "Use POST /v1/auth/refresh", Public: true, Deprecated: true, Body: models.RefreshRequest{}, Data: auth.TokenPair{}},
+	{Method: http.MethodPost, Path: "/admin", Tag: "legacy", Summary: "Use POST /v1/admins", Deprecated: true, Status: http.StatusCreated, Body: models.CreateAdmin{}, Data: models.Admin{}},
+	{Method: http.MethodGet, Path: "/city", Tag: "legacy", Summary: "Use /v1/cities; GET, POST, PUT and DELETE, the id in the query", Deprecated: true, Data: models.City{}},
+	{Method: http.MethodGet, Path: "/customer", Tag: "legacy", Summary: "Use /v1/customers; GET, POST, PUT and DELETE, the id in the query", Deprecated: true, Data: models.Customer{}},
+	{Method: http.MethodGet, Path: "/driver", Tag: "legacy", Summary: "Use /v1/drivers; GET, POST, PUT and DELETE, the id in the query", Deprecated: true, Data: models.Driver{}},
+	{Method: http.MethodGet, Path: "/driver/full", Tag: "legacy", Summary: "Use GET /v1/drivers/{id}/full", Deprecated: true, Data: models.DriverFull{}},
+	{Method: http.MethodGet, Path: "/car", Tag: "legacy", Summary: "Use /v1/cars; GET, POST, PUT and DELETE, the id in the query", Deprecated: true, Data: models.Car{}},
+	{Method: http.MethodGet, Path: "/trip", Tag: "legacy", Summary: "Use /v1/trips; GET, POST, PUT and DELETE, the id in the query", Deprecated: true, Data: models.Trip{}},
+	{Method: http.MethodGet, Path: "/trip_customer", Tag: "legacy", Summary: "Use /v1/trip-customers; GET, POST, PUT and DELETE, the id in the query", Deprecated: true, Data: models.TripCustomer{}},
+}
+
+// Spec is the OpenAPI document of the API, as indented JSON.
+func Spec() ([]byte, error) {
+	doc := docs.Build(docs.Info{
+		Title:       "city2city",
+		Version:     "1",
+		Description: "Intercity taxi booking. Authenticate with POST /v1/auth/otp/verify or /v1/auth/login and send the access token as a bearer token.",
+	}, models.Error{}, operations)
+
+	spec, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(spec, '\n'), nil
+}
+
+// CheckSpec lists how the routes and the served openapi.json differ from
+// the operation table. Routes taking any method only need their path
+// documented.
+func CheckSpec() ([]string, error) {
+	var problems []string
+
+	documented := map[string]bool{}
+	paths := map[string]bool{}
+	for _, op := range operations {
+		documented[op.Method+" "+op.Path] = true
+		paths[op.Path] = true
+	}
+
+	registered := map[string]bool{}
+	for _, route := range routes(handler.Handler{}, nil, config.Config{LegacyRoutes: true, Docs: true}).Routes() {
+		if route.Method == router.AnyMethod {
+			registered[http.MethodGet+" "+route.Pattern] = true
+			if !paths[route.Pattern] {
+				problems = append(problems, fmt.Sprintf("route %s is not documented", route.Pattern))
+			}
+			continue
+		}
+
+		key := route.Method + " " + route.Pattern
+		registered[key] = true
+		if !documented[key] {
+			problems = append(problems, fmt.Sprintf("route %s is not documented", key))
+		}
+	}
+
+	for _, op := range operations {
+		if key := op.Method + " " + op.Path; !registered[key] {
+			problems = append(problems, fmt.Sprintf("documented %s is not routed", key))
+		}
+	}
+
+	spec, err := Spec()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(spec, docs.OpenAPI) {
+		problems = append(problems, "api/docs/openapi.json is stale, run: go run ./cmd openapi generate")
+	}
+
+	return problems, nil
+}
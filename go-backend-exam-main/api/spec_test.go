@@ -0,0 +1,16 @@
+package api
+
+import "testing"
+
+// TestSpec fails when a route and the operation table, or the served
+// openapi.json, have drifted apart.
+func TestSpec(t *testing.T) {
+	problems, err := CheckSpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, problem := range problems {
+		t.Error(problem)
+	}
+}
@@ -0,0 +1,21 @@
+package auth
+
+import "context"
+
+// Identity is the authenticated caller of a request.
+type Identity struct {
+	Subject string `json:"sub"`
+	Role    string `json:"role"`
+}
+
+type identityKey struct{}
+
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// FromContext returns the identity the auth middleware stored in ctx.
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// Known answers for PBKDF2-HMAC-SHA256, the first from RFC 7914 section 11,
+// the rest the widely published vectors in the shape of RFC 6070.
+func TestPBKDF2(t *testing.T) {
+	tests := []struct {
+		password, salt string
+		iterations     int
+		want           string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"password", "salt", 1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{"password", "salt", 2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{"password", "salt", 4096, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+		{"passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, "348c89dbcbd32b2f32d814b8116e84cf2b17347ebc1800181c4e2a1fb8dd53e1c635518c7dac47e9"},
+		{"pass\x00word", "sa\x00lt", 4096, "89b69d0516f829893c696226650a8687"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want[:8], func(t *testing.T) {
+			got := pbkdf2([]byte(tt.password), []byte(tt.salt), tt.iterations, len(tt.want)/2)
+			if hex.EncodeToString(got) != tt.want {
+				t.Errorf("pbkdf2(%q, %q, %d) = %x, want %s", tt.password, tt.salt, tt.iterations, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(hash, "pbkdf2-sha256$210000$") {
+		t.Errorf("HashPassword() = %s, want a pbkdf2-sha256 hash", hash)
+	}
+
+	if other, _ := HashPassword("secret"); other == hash {
+		t.Error("HashPassword() gave the same hash twice, the salt is not random")
+	}
+
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		want     bool
+	}{
+		{"right password", hash, "secret", true},
+		{"wrong password", hash, "Secret", false},
+		{"empty password", hash, "", false},
+		{"other scheme", strings.Replace(hash, "pbkdf2-sha256", "bcrypt", 1), "secret", false},
+		{"fewer iterations", strings.Replace(hash, "$210000$", "$1$", 1), "secret", false},
+		{"bad iterations", strings.Replace(hash, "$210000$", "$-1$", 1), "secret", false},
+		{"truncated", hash[:strings.LastIndexByte(hash, '$')], "secret", false},
+		{"plain text", "secret", "secret", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CheckPassword(tt.hash, tt.password); got != tt.want {
+				t.Errorf("CheckPassword(%s, %q) = %v, want %v", tt.hash, tt.password, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+// Package auth issues and checks the signed tokens, password hashes and
+// one-time codes the API uses to know who is calling.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	RoleAdmin      = "admin"
+	RoleDispatcher = "dispatcher"
+	RoleCustomer   = "customer"
+	RoleDriver     = "driver"
+)
+
+const (
+	TypeAccess  = "access"
+	TypeRefresh = "refresh"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token has expired")
+)
+
+// Claims is the payload of an HS256 JWT.
+type Claims struct {
+	Subject   string `json:"sub"`
+	Role      string `json:"role"`
+	Type      string `json:"typ"`
+	ID        string `json:"jti"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// Tokens signs and verifies HS256 JWTs with one shared secret.
+type Tokens struct {
+	secret     []byte
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+func NewTokens(secret []byte, accessTTL, refreshTTL time.Duration) Tokens {
+	return Tokens{secret: secret, accessTTL: accessTTL, refreshTTL: refreshTTL}
+}
+
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Issue returns a fresh access and refresh token for identity.
+func (t Tokens) Issue(identity Identity) (TokenPair, error) {
+	now := time.Now()
+
+	access, err := t.sign(identity, TypeAccess, now, t.accessTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	refresh, err := t.sign(identity, TypeRefresh, now, t.refreshTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	return TokenPair{AccessToken: access, RefreshToken: refresh, ExpiresIn: int64(t.accessTTL.Seconds())}, nil
+}
+
+// Verify checks the signature and expiry of token and that it is of type
+// typ, and returns its claims.
+func (t Tokens) Verify(token, typ string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return Claims{}, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, t.mac(parts[0]+"."+parts[1])) {
+		return Claims{}, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+
+	claims := Claims{}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Type != typ || claims.Subject == "" {
+		return Claims{}, ErrInvalidToken
+	}
+
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return Claims{}, ErrExpiredToken
+	}
+
+	return claims, nil
+}
+
+func (t Tokens) sign(identity Identity, typ string, now time.Time, ttl time.Duration) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(Claims{
+		Subject:   identity.Subject,
+		Role:      identity.Role,
+		Type:      typ,
+		ID:        hex.EncodeToString(id),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(t.mac(unsigned)), nil
+}
+
+func (t Tokens) mac(s string) []byte {
+	m := hmac.New(sha256.New, t.secret)
+	m.Write([]byte(s))
+	return m.Sum(nil)
+}
+
+// RandomSecret returns n random bytes for signing tokens when no secret is
+// configured.
+func RandomSecret(n int) []byte {
+	secret := make([]byte, n)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return secret
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	tokens := NewTokens([]byte("test-secret"), time.Minute, time.Hour)
+	identity := Identity{Subject: "driver-1", Role: RoleDriver}
+
+	pair, err := tokens.Issue(identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := tokens.Verify(pair.AccessToken, TypeAccess)
+	if err != nil {
+		t.Fatalf("Verify(access) = %v", err)
+	}
+	if claims.Subject != identity.Subject || claims.Role != identity.Role {
+		t.Errorf("Verify(access) = %+v, want %+v", claims, identity)
+	}
+	if _, err := tokens.Verify(pair.RefreshToken, TypeRefresh); err != nil {
+		t.Errorf("Verify(refresh) = %v", err)
+	}
+
+	expired, err := NewTokens([]byte("test-secret"), -time.Minute, -time.Minute).Issue(identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header, payload, signature := split(t, pair.AccessToken)
+	admin := encode(strings.Replace(decode(t, payload), `"role":"driver"`, `"role":"admin"`, 1))
+
+	tests := []struct {
+		name  string
+		token string
+		typ   string
+		want  error
+	}{
+		{"refresh as access", pair.RefreshToken, TypeAccess, ErrInvalidToken},
+		{"access as refresh", pair.AccessToken, TypeRefresh, ErrInvalidToken},
+		{"expired", expired.AccessToken, TypeAccess, ErrExpiredToken},
+		{"tampered payload", header + "." + admin + "." + signature, TypeAccess, ErrInvalidToken},
+		{"tampered signature", header + "." + payload + "." + flip(signature), TypeAccess, ErrInvalidToken},
+		{"no signature", header + "." + payload + ".", TypeAccess, ErrInvalidToken},
+		{"other secret", resign(NewTokens([]byte("other-secret"), 0, 0), header, payload), TypeAccess, ErrInvalidToken},
+		{"alg none", encode(`{"alg":"none","typ":"JWT"}`) + "." + payload + ".", TypeAccess, ErrInvalidToken},
+		{"alg HS512", resign(tokens, encode(`{"alg":"HS512","typ":"JWT"}`), payload), TypeAccess, ErrInvalidToken},
+		{"alg RS256", resign(tokens, encode(`{"alg":"RS256","typ":"JWT"}`), payload), TypeAccess, ErrInvalidToken},
+		{"not a jwt", "token", TypeAccess, ErrInvalidToken},
+		{"empty", "", TypeAccess, ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tokens.Verify(tt.token, tt.typ); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func split(t *testing.T, token string) (header, payload, signature string) {
+	t.Helper()
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("token %q has %d parts", token, len(parts))
+	}
+	return parts[0], parts[1], parts[2]
+}
+
+func encode(s string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+func decode(t *testing.T, s string) string {
+	t.Helper()
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// resign signs header and payload with the secret of tokens, so that only
+// what the test changed can make Verify fail.
+func resign(tokens Tokens, header, payload string) string {
+	unsigned := header + "." + payload
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(tokens.mac(unsigned))
+}
+
+// flip changes the first character of an encoded signature.
+func flip(signature string) string {
+	if signature[0] == 'A' {
+		return "B" + signature[1:]
+	}
+	return "A" + signature[1:]
+}
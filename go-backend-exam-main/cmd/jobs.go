@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"city2city/storage"
+)
+
+// purgeExpiredOTPs deletes expired login codes every interval until ctx
+// ends. Codes nobody verified would otherwise stay forever. A zero interval
+// turns the purge off.
+func purgeExpiredOTPs(ctx context.Context, store storage.IStorage, interval time.Duration, log *slog.Logger) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		n, err := store.OTP().DeleteExpired(ctx, time.Now().UTC())
+		switch {
+		case err != nil && ctx.Err() == nil:
+			log.Error("purging expired otp codes", slog.Any("error", err))
+		case n > 0:
+			log.Info("purged expired otp codes", slog.Int64("count", n))
+		}
+	}
+}
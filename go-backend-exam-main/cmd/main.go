@@ -1,35 +1,198 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
-	
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
 	"city2city/api"
 	"city2city/api/handler"
+	"city2city/api/models"
+	"city2city/auth"
 	"city2city/config"
+	"city2city/logger"
+	"city2city/metrics"
+	"city2city/storage"
+	"city2city/storage/memory"
 	"city2city/storage/postgres"
-	
+
 	_ "github.com/lib/pq"
 )
 
 func main() {
-	cfg := config.Load()
-	
-	store, err := postgres.New(cfg)
-	if err != nil {
-		log.Fatalln("error while connecting to db err:", err.Error())
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate(loadConfig(nil), os.Args[2:]); err != nil {
+			log.Fatalln("error while migrating err:", err.Error())
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "openapi" {
+		if err := openapi(os.Args[2:]); err != nil {
+			log.Fatalln("error while generating openapi err:", err.Error())
+		}
+		return
+	}
+
+	// config prints the effective configuration, taking the same flags as
+	// the server
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		loadConfig(os.Args[2:]).Print(os.Stdout)
 		return
 	}
-	
-	defer store.CloseDB()
-	
-	handler := handler.New(store)
-	
-	api.New(handler)
-	
-	fmt.Println("Server is running on port 8088")
-	if err = http.ListenAndServe(":8088", nil); err != nil {
-		log.Fatalln("error while running server err:", err.Error())
+
+	cfg := loadConfig(os.Args[1:])
+
+	log, err := logger.New(os.Stdout, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		fatal(slog.Default(), "configuring the logger", err)
+	}
+	// the standard library and anything logging without an injected logger
+	// go through the same handler
+	slog.SetDefault(log)
+
+	log.Debug("configuration", slog.Any("config", cfg))
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err = run(ctx, stop, cfg, log); err != nil {
+		fatal(log, "server stopped", err)
+	}
+}
+
+// run serves until ctx ends. It then drains in-flight requests, stops the
+// background jobs and closes the database, in that order. stop restores the
+// default signal handling, so that a second signal kills a slow drain.
+func run(ctx context.Context, stop func(), cfg config.Config, log *slog.Logger) error {
+	store, err := newStorage(ctx, cfg, log)
+	if err != nil {
+		return fmt.Errorf("connecting to db: %w", err)
+	}
+	defer func() {
+		store.CloseDB()
+		log.Info("database closed")
+	}()
+
+	if cfg.RequireSchemaCurrent {
+		if err = checkSchema(store); err != nil {
+			return fmt.Errorf("checking schema: %w", err)
+		}
+	}
+
+	if cfg.AdminLogin != "" && cfg.AdminPassword != "" {
+		if err = seedAdmin(store, cfg); err != nil {
+			return fmt.Errorf("creating admin: %w", err)
+		}
 	}
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	jobs := sync.WaitGroup{}
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		purgeExpiredOTPs(jobsCtx, store, cfg.OTPCleanupInterval, log)
+	}()
+	defer func() {
+		stopJobs()
+		jobs.Wait()
+		log.Info("background jobs stopped")
+	}()
+
+	handler := handler.New(store, cfg, log)
+
+	reg := metrics.NewRegistry()
+	metrics.RegisterStorage(reg, store)
+
+	srv := &http.Server{
+		Addr:              cfg.HTTPAddr,
+		Handler:           api.New(handler, cfg, log, reg),
+		ReadHeaderTimeout: cfg.HTTPReadHeaderTimeout,
+		ReadTimeout:       cfg.HTTPReadTimeout,
+		WriteTimeout:      cfg.HTTPWriteTimeout,
+		IdleTimeout:       cfg.HTTPIdleTimeout,
+		ErrorLog:          slog.NewLogLogger(log.Handler(), slog.LevelWarn),
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+	log.Info("server is running", slog.String("addr", cfg.HTTPAddr))
+
+	select {
+	case err = <-serveErr:
+		return fmt.Errorf("running server: %w", err)
+	case <-ctx.Done():
+		stop()
+	}
+
+	log.Info("shutting down, draining requests", slog.Duration("timeout", cfg.ShutdownTimeout))
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err = srv.Shutdown(shutdownCtx); err != nil {
+		srv.Close()
+		return fmt.Errorf("draining requests: %w", err)
+	}
+	log.Info("requests drained")
+
+	return nil
+}
+
+// loadConfig loads the configuration with the flags in args, exiting when it
+// is invalid.
+func loadConfig(args []string) config.Config {
+	cfg, err := config.Load(args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatalln("error while loading config err:", err.Error())
+	}
+	return cfg
+}
+
+// fatal logs what failed and exits.
+func fatal(log *slog.Logger, msg string, err error) {
+	log.Error(msg, slog.Any("error", err))
+	os.Exit(1)
+}
+
+func newStorage(ctx context.Context, cfg config.Config, log *slog.Logger) (storage.IStorage, error) {
+	switch cfg.Storage {
+	case "memory":
+		return memory.New(), nil
+	case "postgres":
+		return postgres.New(ctx, cfg, log)
+	default:
+		return nil, fmt.Errorf("unknown storage %q", cfg.Storage)
+	}
+}
+
+// seedAdmin creates the configured admin unless one with that login exists.
+func seedAdmin(store storage.IStorage, cfg config.Config) error {
+	ctx := context.Background()
+
+	_, err := store.Admin().GetByLogin(ctx, cfg.AdminLogin)
+	if !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+
+	hash, err := auth.HashPassword(cfg.AdminPassword)
+	if err != nil {
+		return err
+	}
+
+	_, err = store.Admin().Create(ctx, models.CreateAdmin{Login: cfg.AdminLogin, Role: auth.RoleAdmin, PasswordHash: hash})
+	return err
 }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"city2city/config"
+	"city2city/migrations"
+	"city2city/storage"
+	"city2city/storage/postgres"
+)
+
+const migrateUsage = "usage: migrate up|down|status|create <name>"
+
+// migrate runs the migrate subcommand against the configured postgres database.
+func migrate(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	if args[0] == "create" {
+		if len(args) != 2 {
+			return errors.New(migrateUsage)
+		}
+		up, down, err := migrations.Create(migrations.Dir, args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Println("created", up)
+		fmt.Println("created", down)
+		return nil
+	}
+
+	db, err := postgres.Connect(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		done, err := migrator.Up(ctx)
+		for _, m := range done {
+			fmt.Printf("applied %d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 {
+			fmt.Println("schema is up to date")
+		}
+	case "down":
+		m, ok, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("no migrations applied")
+			return nil
+		}
+		fmt.Printf("reverted %d_%s\n", m.Version, m.Name)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%06d_%-24s %s\n", s.Version, s.Name, applied)
+		}
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return nil
+}
+
+// checkSchema fails when store is migrated and its database is behind the
+// code.
+func checkSchema(store storage.IStorage) error {
+	versioner, ok := store.(storage.ISchemaVersioner)
+	if !ok {
+		return nil
+	}
+
+	current, latest, err := versioner.SchemaVersion(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if current < latest {
+		return fmt.Errorf("schema is at version %d, code expects %d: run migrate up", current, latest)
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"city2city/api"
+)
+
+const openapiUsage = "usage: openapi generate|check"
+
+// specFile is where generate writes the document served at /openapi.json.
+var specFile = filepath.Join("api", "docs", "openapi.json")
+
+// openapi writes the OpenAPI document, or checks that it and the routes
+// still match the operation table.
+func openapi(args []string) error {
+	if len(args) != 1 {
+		return errors.New(openapiUsage)
+	}
+
+	switch args[0] {
+	case "generate":
+		spec, err := api.Spec()
+		if err != nil {
+			return err
+		}
+		if err = os.WriteFile(specFile, spec, 0o644); err != nil {
+			return err
+		}
+		fmt.Println("wrote", specFile)
+	case "check":
+		problems, err := api.CheckSpec()
+		if err != nil {
+			return err
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("the OpenAPI document has drifted:\n\t%s", strings.Join(problems, "\n\t"))
+		}
+		fmt.Println("the OpenAPI document is up to date")
+	default:
+		return errors.New(openapiUsage)
+	}
+
+	return nil
+}
@@ -1,40 +1,112 @@
+// Package config loads the server configuration. Every setting has a
+// default and can be overridden, in increasing precedence, by a YAML file,
+// the environment (or a .env file) and a command-line flag:
+//
+//	http:
+//	  addr: ":8080"          # HTTP_ADDR=:8080    -http.addr=:8080
+//
+// The struct tags of Config name each setting: key is its YAML path and
+// flag name, env its environment variable, and secret marks values that
+// are redacted when the configuration is printed.
 package config
 
-import (
-	"fmt"
-	"os"
-
-	"github.com/lpernett/godotenv"
-	"github.com/spf13/cast"
-)
+import "time"
 
 type Config struct {
-	PostgresHost     string
-	PostgresPort     string
-	PostgresUser     string
-	PostgresPassword string
-	PostgresDB       string
-}
+	// Env is development or production. Production refuses to start
+	// without real secrets.
+	Env string `key:"env" env:"APP_ENV" default:"development"`
 
-func Load() Config {
-	if err := godotenv.Load(); err != nil {
-		fmt.Println("error!!!", err)
-	}
+	// HTTPAddr is the address the server listens on, such as :8088.
+	HTTPAddr string `key:"http.addr" env:"HTTP_ADDR" default:":8088"`
+	// HTTPReadHeaderTimeout, HTTPReadTimeout, HTTPWriteTimeout and
+	// HTTPIdleTimeout bound a client connection; see http.Server. The
+	// write timeout must leave room for QueryTimeout.
+	HTTPReadHeaderTimeout time.Duration `key:"http.read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT" default:"5s"`
+	HTTPReadTimeout       time.Duration `key:"http.read_timeout" env:"HTTP_READ_TIMEOUT" default:"15s"`
+	HTTPWriteTimeout      time.Duration `key:"http.write_timeout" env:"HTTP_WRITE_TIMEOUT" default:"30s"`
+	HTTPIdleTimeout       time.Duration `key:"http.idle_timeout" env:"HTTP_IDLE_TIMEOUT" default:"120s"`
+	// ShutdownTimeout is how long in-flight requests get to finish once a
+	// SIGTERM or SIGINT arrives.
+	ShutdownTimeout time.Duration `key:"http.shutdown_timeout" env:"SHUTDOWN_TIMEOUT" default:"20s"`
 
-	cfg := Config{}
+	// Storage selects the backend: "postgres" (default) or "memory".
+	Storage string `key:"storage" env:"STORAGE" default:"postgres"`
 
-	cfg.PostgresHost = cast.ToString(getOrReturnDefault("POSTGRES_HOST", "localhost"))
-	cfg.PostgresPort = cast.ToString(getOrReturnDefault("POSTGRES_PORT", "5432"))
-	cfg.PostgresUser = cast.ToString(getOrReturnDefault("POSTGRES_USER", "postgres"))
-	cfg.PostgresPassword = cast.ToString(getOrReturnDefault("POSTGRES_PASSWORD", "password"))
-	cfg.PostgresDB = cast.ToString(getOrReturnDefault("POSTGRES_DB", "db"))
+	PostgresHost     string `key:"postgres.host" env:"POSTGRES_HOST" default:"localhost"`
+	PostgresPort     string `key:"postgres.port" env:"POSTGRES_PORT" default:"5432"`
+	PostgresUser     string `key:"postgres.user" env:"POSTGRES_USER" default:"postgres"`
+	PostgresPassword string `key:"postgres.password" env:"POSTGRES_PASSWORD" default:"password" secret:"true"`
+	PostgresDB       string `key:"postgres.db" env:"POSTGRES_DB" default:"db"`
 
-	return cfg
-}
-func getOrReturnDefault(key string, defaultValue interface{}) interface{} {
-	value := os.Getenv(key)
-	if value != "" {
-		return value
-	}
-	return defaultValue
+	// DBConnectAttempts is how many times startup tries to reach the
+	// database, waiting DBConnectBackoff after the first failure and twice
+	// as long after each next one.
+	DBConnectAttempts int           `key:"db.connect_attempts" env:"DB_CONNECT_ATTEMPTS" default:"5"`
+	DBConnectBackoff  time.Duration `key:"db.connect_backoff" env:"DB_CONNECT_BACKOFF" default:"1s"`
+	// DBMaxOpenConns and DBMaxIdleConns size the connection pool, zero
+	// meaning no limit; DBConnMaxLifetime and DBConnMaxIdleTime recycle
+	// its connections. See sql.DB.
+	DBMaxOpenConns    int           `key:"db.max_open_conns" env:"DB_MAX_OPEN_CONNS" default:"25"`
+	DBMaxIdleConns    int           `key:"db.max_idle_conns" env:"DB_MAX_IDLE_CONNS" default:"10"`
+	DBConnMaxLifetime time.Duration `key:"db.conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME" default:"30m"`
+	DBConnMaxIdleTime time.Duration `key:"db.conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME" default:"5m"`
+
+	// QueryTimeout bounds the storage work done for a single request.
+	QueryTimeout time.Duration `key:"db.query_timeout" env:"QUERY_TIMEOUT" default:"5s"`
+
+	// RequireSchemaCurrent makes the server refuse to start while postgres
+	// migrations are pending.
+	RequireSchemaCurrent bool `key:"db.require_schema_current" env:"REQUIRE_SCHEMA_CURRENT" default:"false"`
+
+	// JWTSecret signs access and refresh tokens. When empty a random secret
+	// is used, so tokens do not survive a restart; production requires one
+	// of at least 32 bytes.
+	JWTSecret       string        `key:"auth.jwt_secret" env:"JWT_SECRET" secret:"true"`
+	AccessTokenTTL  time.Duration `key:"auth.access_token_ttl" env:"ACCESS_TOKEN_TTL" default:"15m"`
+	RefreshTokenTTL time.Duration `key:"auth.refresh_token_ttl" env:"REFRESH_TOKEN_TTL" default:"720h"`
+	OTPTTL          time.Duration `key:"auth.otp_ttl" env:"OTP_TTL" default:"5m"`
+	// OTPMaxAttempts is how many wrong guesses a login code survives.
+	OTPMaxAttempts int `key:"auth.otp_max_attempts" env:"OTP_MAX_ATTEMPTS" default:"5"`
+	// OTPCleanupInterval is how often expired login codes are purged; zero
+	// turns the purge off.
+	OTPCleanupInterval time.Duration `key:"auth.otp_cleanup_interval" env:"OTP_CLEANUP_INTERVAL" default:"10m"`
+
+	// AdminLogin and AdminPassword, when both set, create the first admin
+	// on startup if no admin with that login exists.
+	AdminLogin    string `key:"auth.admin_login" env:"ADMIN_LOGIN"`
+	AdminPassword string `key:"auth.admin_password" env:"ADMIN_PASSWORD" secret:"true"`
+
+	// CORSAllowedOrigins lists the browser origins, such as the dashboard,
+	// allowed to call the API; "*" allows any. Empty turns CORS off.
+	CORSAllowedOrigins []string      `key:"cors.allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+	CORSAllowedMethods []string      `key:"cors.allowed_methods" env:"CORS_ALLOWED_METHODS" default:"GET,POST,PUT,DELETE"`
+	CORSAllowedHeaders []string      `key:"cors.allowed_headers" env:"CORS_ALLOWED_HEADERS" default:"Authorization,Content-Type,X-Request-ID"`
+	CORSMaxAge         time.Duration `key:"cors.max_age" env:"CORS_MAX_AGE" default:"10m"`
+
+	// MetricsToken, when set, must be sent as a bearer token to scrape
+	// /metrics.
+	MetricsToken string `key:"metrics.token" env:"METRICS_TOKEN" secret:"true"`
+
+	// LogLevel is debug, info, warn or error; LogFormat is json or text.
+	LogLevel  string `key:"log.level" env:"LOG_LEVEL" default:"info"`
+	LogFormat string `key:"log.format" env:"LOG_FORMAT" default:"json"`
+
+	// LegacyRoutes mounts the deprecated routes from before /v1.
+	LegacyRoutes bool `key:"features.legacy_routes" env:"FEATURE_LEGACY_ROUTES" default:"true"`
+	// Docs serves /openapi.json and /docs.
+	Docs bool `key:"features.docs" env:"FEATURE_DOCS" default:"true"`
+
+	// ListDefaultLimit and ListMaxLimit are the page size of list
+	// endpoints without and with a limit parameter.
+	ListDefaultLimit int `key:"lists.default_limit" env:"LIST_DEFAULT_LIMIT" default:"10"`
+	ListMaxLimit     int `key:"lists.max_limit" env:"LIST_MAX_LIMIT" default:"100"`
+
+	// RefundRules decide how much of the price a cancelled booking gets
+	// back, by how long before the scheduled departure it is cancelled.
+	// What is not refunded is kept as a penalty.
+	RefundRules RefundRules `key:"bookings.refund_rules" env:"BOOKING_REFUND_RULES" default:"2h:100,0s:50"`
+
+	// sources tells, by key, which layer each value came from.
+	sources map[string]string
 }
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/lpernett/godotenv"
+	"github.com/spf13/cast"
+)
+
+// The layers a value can come from, lowest precedence first.
+const (
+	sourceDefault = "default"
+	sourceFile    = "file"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
+
+// setting is a field of Config with its tags.
+type setting struct {
+	index  int
+	key    string
+	env    string
+	def    string
+	secret bool
+}
+
+func settings() []setting {
+	var list []setting
+
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key, ok := field.Tag.Lookup("key")
+		if !ok {
+			continue
+		}
+
+		list = append(list, setting{
+			index:  i,
+			key:    key,
+			env:    field.Tag.Get("env"),
+			def:    field.Tag.Get("default"),
+			secret: field.Tag.Get("secret") == "true",
+		})
+	}
+
+	return list
+}
+
+// Load builds the configuration from the defaults, the YAML file named by
+// the -config flag or CONFIG_FILE, the environment and .env, and the flags
+// in args, each overriding the one before. It fails on unknown settings,
+// values that do not parse and configurations Validate rejects.
+func Load(args []string) (Config, error) {
+	var (
+		list  = settings()
+		fs    = flag.NewFlagSet("city2city", flag.ContinueOnError)
+		file  = fs.String("config", "", "YAML configuration file (env CONFIG_FILE)")
+		flags = map[string]*string{}
+	)
+	for _, s := range list {
+		usage := "env " + s.env
+		if s.def != "" {
+			usage += ", default " + s.def
+		}
+		flags[s.key] = fs.String(s.key, "", usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	if fs.NArg() > 0 {
+		return Config{}, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	// the .env file is optional, the environment may carry everything
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Config{}, fmt.Errorf("reading .env: %w", err)
+	}
+
+	fileValues := map[string]interface{}{}
+	if *file == "" {
+		*file = os.Getenv("CONFIG_FILE")
+	}
+	if *file != "" {
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			return Config{}, fmt.Errorf("reading config file: %w", err)
+		}
+		if fileValues, err = parseYAML(data); err != nil {
+			return Config{}, fmt.Errorf("%s: %w", *file, err)
+		}
+	}
+
+	setFlags := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+
+	var (
+		cfg   = Config{sources: map[string]string{}}
+		v     = reflect.ValueOf(&cfg).Elem()
+		known = map[string]bool{}
+		errs  []error
+	)
+	for _, s := range list {
+		known[s.key] = true
+
+		var value interface{} = s.def
+		source := sourceDefault
+		if fv, ok := fileValues[s.key]; ok {
+			value, source = fv, sourceFile
+		}
+		if ev := os.Getenv(s.env); ev != "" {
+			value, source = ev, sourceEnv
+		}
+		if setFlags[s.key] {
+			value, source = *flags[s.key], sourceFlag
+		}
+
+		if err := set(v.Field(s.index), value); err != nil {
+			errs = append(errs, fmt.Errorf("%s (from %s): %w", s.key, source, err))
+		}
+		cfg.sources[s.key] = source
+	}
+
+	for key := range fileValues {
+		if !known[key] {
+			errs = append(errs, fmt.Errorf("%s: unknown setting in %s", key, *file))
+		}
+	}
+
+	if len(errs) > 0 {
+		return Config{}, errors.Join(errs...)
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// set parses value, a string or, from a YAML list, a []string, into field.
+// Types of their own parse it with UnmarshalText, a list joined with commas.
+func set(field reflect.Value, value interface{}) error {
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		s, isString := value.(string)
+		if !isString {
+			s = strings.Join(value.([]string), ",")
+		}
+		return u.UnmarshalText([]byte(strings.TrimSpace(s)))
+	}
+
+	if items, ok := value.([]string); ok {
+		if field.Type() != reflect.TypeOf([]string{}) {
+			return errors.New("a list is not allowed here")
+		}
+		field.Set(reflect.ValueOf(items))
+		return nil
+	}
+
+	s := strings.TrimSpace(value.(string))
+
+	switch field.Interface().(type) {
+	case time.Duration:
+		if s == "" {
+			field.SetInt(0)
+			return nil
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 30s or 5m", s)
+		}
+		field.SetInt(int64(d))
+	case []string:
+		field.Set(reflect.ValueOf(list(s)))
+	case string:
+		field.SetString(s)
+	case int:
+		n, err := cast.ToIntE(s)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", s)
+		}
+		field.SetInt(int64(n))
+	case bool:
+		b, err := cast.ToBoolE(s)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", s)
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+
+	return nil
+}
+
+// list splits a comma separated value, dropping empty items.
+func list(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RefundRule refunds Percent of the price of a booking cancelled at least
+// Before the scheduled departure.
+type RefundRule struct {
+	Before  time.Duration
+	Percent int
+}
+
+// RefundRules are written as before:percent pairs, longest notice first,
+// such as 2h:100,0s:50: all of the price back when cancelling two hours
+// ahead or more, half of it until departure.
+type RefundRules []RefundRule
+
+// UnmarshalText parses the before:percent list.
+func (r *RefundRules) UnmarshalText(text []byte) error {
+	rules := RefundRules{}
+	for _, item := range list(string(text)) {
+		before, percent, ok := strings.Cut(item, ":")
+		if !ok {
+			return fmt.Errorf("%q is not a before:percent rule such as 2h:100", item)
+		}
+
+		d, err := time.ParseDuration(strings.TrimSpace(before))
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 30s or 5m", before)
+		}
+		p, err := strconv.Atoi(strings.TrimSpace(percent))
+		if err != nil {
+			return fmt.Errorf("%q is not a whole percentage", percent)
+		}
+
+		rules = append(rules, RefundRule{Before: d, Percent: p})
+	}
+
+	*r = rules
+	return nil
+}
+
+func (r RefundRules) String() string {
+	items := make([]string, 0, len(r))
+	for _, rule := range r {
+		items = append(items, fmt.Sprintf("%s:%d", rule.Before, rule.Percent))
+	}
+	return strings.Join(items, ",")
+}
+
+// Percent returns the share of the price refunded for a cancellation made
+// notice ahead of the departure: that of the first rule whose Before it
+// meets, or none.
+func (r RefundRules) Percent(notice time.Duration) int {
+	for _, rule := range r {
+		if notice >= rule.Before {
+			return rule.Percent
+		}
+	}
+	return 0
+}
+
+// validate checks that the percentages are between 0 and 100 and that the
+// rules go from the longest notice to the shortest.
+func (r RefundRules) validate() error {
+	for i, rule := range r {
+		if rule.Percent < 0 || rule.Percent > 100 {
+			return fmt.Errorf("%d%% is not between 0 and 100", rule.Percent)
+		}
+		if i > 0 && rule.Before >= r[i-1].Before {
+			return fmt.Errorf("%s must come before %s, longest notice first", rule.Before, r[i-1].Before)
+		}
+	}
+	return nil
+}
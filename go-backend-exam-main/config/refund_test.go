@@ -0,0 +1,97 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRefundRulesUnmarshalText(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    RefundRules
+		wantErr bool
+	}{
+		{text: "2h:100,0s:50", want: RefundRules{{2 * time.Hour, 100}, {0, 50}}},
+		{text: " 24h : 100 , 1h30m:25 ", want: RefundRules{{24 * time.Hour, 100}, {90 * time.Minute, 25}}},
+		{text: "", want: RefundRules{}},
+		{text: "2h", wantErr: true},
+		{text: "2 hours:100", wantErr: true},
+		{text: "2h:half", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			var got RefundRules
+			err := got.UnmarshalText([]byte(tt.text))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefundRulesPercent(t *testing.T) {
+	rules := RefundRules{{24 * time.Hour, 100}, {2 * time.Hour, 50}, {0, 10}}
+
+	tests := []struct {
+		notice time.Duration
+		want   int
+	}{
+		{48 * time.Hour, 100},
+		{24 * time.Hour, 100},
+		{24*time.Hour - time.Second, 50},
+		{2 * time.Hour, 50},
+		{time.Hour, 10},
+		{0, 10},
+		{-time.Minute, 0},
+	}
+
+	for _, tt := range tests {
+		if got := rules.Percent(tt.notice); got != tt.want {
+			t.Errorf("Percent(%s): got %d, want %d", tt.notice, got, tt.want)
+		}
+	}
+
+	if got := (RefundRules{}).Percent(time.Hour); got != 0 {
+		t.Errorf("no rules: got %d, want 0", got)
+	}
+}
+
+func TestRefundRulesValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   RefundRules
+		wantErr bool
+	}{
+		{"longest notice first", RefundRules{{2 * time.Hour, 100}, {0, 50}}, false},
+		{"none", RefundRules{}, false},
+		{"shortest notice first", RefundRules{{0, 50}, {2 * time.Hour, 100}}, true},
+		{"same notice twice", RefundRules{{time.Hour, 100}, {time.Hour, 50}}, true},
+		{"over 100 percent", RefundRules{{time.Hour, 120}}, true},
+		{"negative percent", RefundRules{{time.Hour, -5}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rules.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRefundRulesString(t *testing.T) {
+	rules := RefundRules{{2 * time.Hour, 100}, {0, 50}}
+
+	var parsed RefundRules
+	if err := parsed.UnmarshalText([]byte(rules.String())); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, rules) {
+		t.Errorf("%q parsed back as %v", rules.String(), parsed)
+	}
+}
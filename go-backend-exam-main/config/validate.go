@@ -0,0 +1,147 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// minSecretLength is the shortest JWT secret production accepts, the size
+// of the HS256 key.
+const minSecretLength = 32
+
+// Validate reports every setting that is out of range or inconsistent with
+// another, and, in production, every secret left unset or at its default.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+		}
+	}
+	oneOf := func(value, key string, allowed ...string) {
+		for _, a := range allowed {
+			if value == a {
+				return
+			}
+		}
+		check(false, key, "%q is not one of %s", value, strings.Join(allowed, ", "))
+	}
+	positive := func(d time.Duration, key string) {
+		check(d > 0, key, "must be positive")
+	}
+
+	oneOf(c.Env, "env", "development", "production")
+	oneOf(c.Storage, "storage", "postgres", "memory")
+	oneOf(c.LogLevel, "log.level", "debug", "info", "warn", "error")
+	oneOf(c.LogFormat, "log.format", "json", "text")
+
+	check(c.HTTPAddr != "", "http.addr", "is required")
+	positive(c.HTTPReadHeaderTimeout, "http.read_header_timeout")
+	positive(c.HTTPReadTimeout, "http.read_timeout")
+	positive(c.HTTPWriteTimeout, "http.write_timeout")
+	positive(c.HTTPIdleTimeout, "http.idle_timeout")
+	positive(c.ShutdownTimeout, "http.shutdown_timeout")
+	positive(c.QueryTimeout, "db.query_timeout")
+	check(c.HTTPWriteTimeout > c.QueryTimeout, "http.write_timeout", "must be longer than db.query_timeout (%s)", c.QueryTimeout)
+
+	check(c.DBConnectAttempts >= 1, "db.connect_attempts", "must be at least 1")
+	positive(c.DBConnectBackoff, "db.connect_backoff")
+	check(c.DBMaxOpenConns >= 0, "db.max_open_conns", "must not be negative")
+	check(c.DBMaxIdleConns >= 0, "db.max_idle_conns", "must not be negative")
+	check(c.DBMaxOpenConns == 0 || c.DBMaxIdleConns <= c.DBMaxOpenConns, "db.max_idle_conns", "must not exceed db.max_open_conns (%d)", c.DBMaxOpenConns)
+	check(c.DBConnMaxLifetime >= 0, "db.conn_max_lifetime", "must not be negative")
+	check(c.DBConnMaxIdleTime >= 0, "db.conn_max_idle_time", "must not be negative")
+
+	positive(c.AccessTokenTTL, "auth.access_token_ttl")
+	positive(c.OTPTTL, "auth.otp_ttl")
+	check(c.RefreshTokenTTL > c.AccessTokenTTL, "auth.refresh_token_ttl", "must be longer than auth.access_token_ttl (%s)", c.AccessTokenTTL)
+	check(c.OTPMaxAttempts >= 1, "auth.otp_max_attempts", "must be at least 1")
+	check(c.OTPCleanupInterval >= 0, "auth.otp_cleanup_interval", "must not be negative")
+	check((c.AdminLogin == "") == (c.AdminPassword == ""), "auth.admin_login", "and auth.admin_password must be set together")
+
+	check(c.CORSMaxAge >= 0, "cors.max_age", "must not be negative")
+
+	check(c.ListDefaultLimit >= 1, "lists.default_limit", "must be at least 1")
+	check(c.ListMaxLimit >= c.ListDefaultLimit, "lists.max_limit", "must be at least lists.default_limit (%d)", c.ListDefaultLimit)
+
+	if err := c.RefundRules.validate(); err != nil {
+		check(false, "bookings.refund_rules", "%s", err)
+	}
+
+	if c.Env == "production" {
+		check(len(c.JWTSecret) >= minSecretLength, "auth.jwt_secret", "is required in production, at least %d bytes", minSecretLength)
+		check(c.Storage == "postgres", "storage", "must be postgres in production")
+		check(c.PostgresPassword != "" && c.PostgresPassword != defaultOf("PostgresPassword"), "postgres.password", "must be set in production")
+		check(c.AdminPassword == "" || len(c.AdminPassword) >= 12, "auth.admin_password", "must be at least 12 characters in production")
+	}
+
+	return errors.Join(errs...)
+}
+
+func defaultOf(field string) string {
+	f, _ := reflect.TypeOf(Config{}).FieldByName(field)
+	return f.Tag.Get("default")
+}
+
+// entry is one setting as printed, secrets redacted.
+type entry struct {
+	key, value, source string
+}
+
+// effective lists every setting with its value, redacted when it is a set
+// secret, and the layer it came from.
+func (c Config) effective() []entry {
+	var (
+		v       = reflect.ValueOf(c)
+		entries []entry
+	)
+	for _, s := range settings() {
+		value := format(v.Field(s.index))
+		if s.secret && value != "" {
+			value = "[REDACTED]"
+		}
+
+		source := c.sources[s.key]
+		if source == "" {
+			source = sourceDefault
+		}
+		entries = append(entries, entry{key: s.key, value: value, source: source})
+	}
+	return entries
+}
+
+// Print writes the effective configuration, one key: value per line with
+// the layer it came from. Secrets are redacted, except for telling whether
+// they are set.
+func (c Config) Print(w io.Writer) {
+	for _, e := range c.effective() {
+		fmt.Fprintf(w, "%s: %s # %s\n", e.key, e.value, e.source)
+	}
+}
+
+// LogValue lets the configuration be logged, redacted like Print does.
+func (c Config) LogValue() slog.Value {
+	entries := c.effective()
+
+	attrs := make([]slog.Attr, 0, len(entries))
+	for _, e := range entries {
+		attrs = append(attrs, slog.String(e.key, e.value))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+func format(v reflect.Value) string {
+	switch value := v.Interface().(type) {
+	case time.Duration:
+		return value.String()
+	case []string:
+		return "[" + strings.Join(value, ", ") + "]"
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML reads the subset of YAML a configuration file needs: nested
+// maps, scalars (plain, single or double quoted), comments, and lists of
+// scalars either inline ([a, b]) or as "- item" lines. It returns the
+// values by their dotted path, such as http.addr, each a string or, for
+// lists, a []string.
+func parseYAML(data []byte) (map[string]interface{}, error) {
+	type level struct {
+		indent int
+		key    string
+	}
+
+	var (
+		values = map[string]interface{}{}
+		stack  []level
+	)
+
+	path := func(key string) string {
+		keys := make([]string, 0, len(stack)+1)
+		for _, l := range stack {
+			keys = append(keys, l.key)
+		}
+		if key != "" {
+			keys = append(keys, key)
+		}
+		return strings.Join(keys, ".")
+	}
+
+	for n, raw := range strings.Split(string(data), "\n") {
+		lineNo := n + 1
+
+		line := strings.TrimRight(stripComment(raw), " \r")
+		content := strings.TrimLeft(line, " ")
+		if content == "" || content == "---" {
+			continue
+		}
+		if strings.HasPrefix(content, "\t") {
+			return nil, fmt.Errorf("line %d: indent with spaces, not tabs", lineNo)
+		}
+		indent := len(line) - len(content)
+
+		if content == "-" || strings.HasPrefix(content, "- ") {
+			// an item belongs to the last key opened without a value, at
+			// the same indent or less
+			for len(stack) > 0 && stack[len(stack)-1].indent > indent {
+				stack = stack[:len(stack)-1]
+			}
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: list item outside of a key", lineNo)
+			}
+
+			item, err := scalar(strings.TrimSpace(strings.TrimPrefix(content, "-")))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			if strings.Contains(item, ": ") || strings.HasSuffix(item, ":") {
+				return nil, fmt.Errorf("line %d: maps inside lists are not supported", lineNo)
+			}
+
+			key := path("")
+			items, _ := values[key].([]string)
+			values[key] = append(items, item)
+			continue
+		}
+
+		key, value, ok := strings.Cut(content, ":")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("line %d: expected key: value", lineNo)
+		}
+		if value != "" && !strings.HasPrefix(value, " ") {
+			return nil, fmt.Errorf("line %d: expected a space after the colon", lineNo)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+
+		if value == "" {
+			// a map or a list follows, or nothing, which leaves the
+			// setting unset
+			stack = append(stack, level{indent: indent, key: key})
+			continue
+		}
+
+		full := path(key)
+		if _, dup := values[full]; dup {
+			return nil, fmt.Errorf("line %d: %s is set twice", lineNo, full)
+		}
+
+		if strings.HasPrefix(value, "[") {
+			items, err := inlineList(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			values[full] = items
+			continue
+		}
+
+		s, err := scalar(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		values[full] = s
+	}
+
+	return values, nil
+}
+
+// stripComment drops a # comment, one at the start of the line or after a
+// space, outside of quotes.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func scalar(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		unquoted, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("bad double quoted string %s", s)
+		}
+		return unquoted, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return "", fmt.Errorf("bad single quoted string %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case s == "~" || s == "null":
+		return "", nil
+	}
+	return s, nil
+}
+
+func inlineList(s string) ([]string, error) {
+	if !strings.HasSuffix(s, "]") {
+		return nil, fmt.Errorf("unterminated list %s", s)
+	}
+
+	items := []string{}
+	inner := strings.TrimSpace(s[1 : len(s)-1])
+	if inner == "" {
+		return items, nil
+	}
+	for _, raw := range strings.Split(inner, ",") {
+		item, err := scalar(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
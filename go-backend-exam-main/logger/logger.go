@@ -0,0 +1,84 @@
+// Package logger builds the structured logger shared by the server, the
+// handlers and the storage. Every record it writes carries the ID of the
+// request it was made for and has personal data redacted.
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// New returns a logger writing to w at level (debug, info, warn or error)
+// in format (json or text).
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("unknown log level %q", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	case "text":
+		h = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q, use json or text", format)
+	}
+
+	return slog.New(handler{next: h}), nil
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns ctx carrying the request ID that records logged
+// with it are tagged with.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID ctx carries, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// handler adds the request ID to records and redacts them before passing
+// them on.
+type handler struct {
+	next slog.Handler
+}
+
+func (h handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h handler) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, redactText(r.Message), r.PC)
+	if id := RequestID(ctx); id != "" {
+		redacted.AddAttrs(slog.String("request_id", id))
+	}
+	r.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(redact(attr))
+		return true
+	})
+
+	return h.next.Handle(ctx, redacted)
+}
+
+func (h handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redacted[i] = redact(attr)
+	}
+	return handler{next: h.next.WithAttrs(redacted)}
+}
+
+func (h handler) WithGroup(name string) slog.Handler {
+	return handler{next: h.next.WithGroup(name)}
+}
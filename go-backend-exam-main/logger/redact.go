@@ -0,0 +1,100 @@
+package logger
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// secretKeys are attribute keys whose values never reach the log.
+var secretKeys = map[string]bool{
+	"password":      true,
+	"password_hash": true,
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"authorization": true,
+	"secret":        true,
+	"otp":           true,
+	"code":          true,
+}
+
+// personalKeys are attribute keys whose values are personal data, masked
+// whatever their shape: a phone typed without its + or with spaces slips
+// past the patterns below.
+var personalKeys = map[string]func(string) string{
+	"phone": maskPhone,
+	"email": maskEmail,
+}
+
+var (
+	// international numbers as validation.Phone accepts them; bare digit
+	// runs are too often IDs or timestamps
+	phonePattern = regexp.MustCompile(`\+\d{9,15}`)
+	emailPattern = regexp.MustCompile(`[\w.+-]+@[\w-]+(\.[\w-]+)+`)
+)
+
+// redact masks attr when its key names a secret or personal data, and
+// phone numbers and email addresses wherever they appear in its value.
+func redact(attr slog.Attr) slog.Attr {
+	key := strings.ToLower(attr.Key)
+	if secretKeys[key] {
+		return slog.String(attr.Key, "[REDACTED]")
+	}
+
+	value := attr.Value.Resolve()
+	if mask, ok := personalKeys[key]; ok && value.Kind() != slog.KindGroup {
+		return slog.String(attr.Key, mask(value.String()))
+	}
+
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, redactText(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		attrs := make([]any, len(group))
+		for i, a := range group {
+			attrs[i] = redact(a)
+		}
+		return slog.Group(attr.Key, attrs...)
+	case slog.KindAny:
+		// errors and other values are logged as their text, which may
+		// quote what the user sent
+		if err, ok := value.Any().(error); ok {
+			return slog.String(attr.Key, redactText(err.Error()))
+		}
+	}
+
+	return slog.Attr{Key: attr.Key, Value: value}
+}
+
+// redactText masks phone numbers down to their last two digits and email
+// addresses down to the first letter and the domain.
+func redactText(s string) string {
+	s = emailPattern.ReplaceAllStringFunc(s, maskEmail)
+	return phonePattern.ReplaceAllStringFunc(s, maskPhone)
+}
+
+// maskPhone keeps the last two digits of phone.
+func maskPhone(phone string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+
+	if len(digits) < 2 {
+		return "***"
+	}
+	return "***" + digits[len(digits)-2:]
+}
+
+// maskEmail keeps the first letter and the domain of email.
+func maskEmail(email string) string {
+	at := strings.LastIndexByte(email, '@')
+	if at < 1 {
+		return "***"
+	}
+	return email[:1] + "***" + email[at:]
+}
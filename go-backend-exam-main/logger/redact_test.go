@@ -0,0 +1,106 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedactByKey(t *testing.T) {
+	tests := []struct {
+		attr slog.Attr
+		want string
+	}{
+		{slog.String("phone", "+998901234567"), "***67"},
+		{slog.String("phone", "998901234567"), "***67"},
+		{slog.String("phone", "90 123 45 67"), "***67"},
+		{slog.String("Phone", "(90) 123-45-68"), "***68"},
+		{slog.Int64("phone", 998901234567), "***67"},
+		{slog.String("phone", "7"), "***"},
+		{slog.String("email", "bob@example.com"), "b***@example.com"},
+		{slog.String("email", "not an email"), "***"},
+		{slog.String("password", "hunter2"), "[REDACTED]"},
+		{slog.String("Authorization", "Bearer abc"), "[REDACTED]"},
+		{slog.String("otp", "123456"), "[REDACTED]"},
+		{slog.String("code", "123456"), "[REDACTED]"},
+		{slog.String("name", "Bob"), "Bob"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.attr.String(), func(t *testing.T) {
+			got := redact(tt.attr)
+			if got.Key != tt.attr.Key || got.Value.String() != tt.want {
+				t.Errorf("redact(%v) = %v, want %s=%s", tt.attr, got, tt.attr.Key, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactByPattern(t *testing.T) {
+	tests := []struct {
+		attr slog.Attr
+		want string
+	}{
+		{
+			slog.String("msg", "sent to +998901234567 and bob@example.com"),
+			"sent to ***67 and b***@example.com",
+		},
+		{
+			slog.Any("error", errors.New(`customer with phone +998901234567 already exists`)),
+			"customer with phone ***67 already exists",
+		},
+		{
+			// bare digit runs are left alone, they are mostly IDs
+			slog.String("msg", "order 998901234567"),
+			"order 998901234567",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := redact(tt.attr).Value.String(); got != tt.want {
+				t.Errorf("redact(%v) = %q, want %q", tt.attr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactGroup(t *testing.T) {
+	got := redact(slog.Group("customer",
+		slog.String("phone", "998901234567"),
+		slog.String("note", "call +998901234567"),
+		slog.String("token", "abc"),
+	))
+
+	want := "customer=[phone=***67 note=call ***67 token=[REDACTED]]"
+	if got.String() != want {
+		t.Errorf("redact(group) = %s, want %s", got, want)
+	}
+}
+
+func TestLoggerRedacts(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := New(&buf, "info", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	log.With(slog.String("email", "bob@example.com")).
+		InfoContext(ctx, "otp sent to +998901234567", slog.String("phone", "90 123 45 67"), slog.String("code", "123456"))
+
+	out := buf.String()
+	for _, leak := range []string{"998901234567", "90 123 45 67", "bob@example.com", "123456"} {
+		if strings.Contains(out, leak) {
+			t.Errorf("log leaks %q: %s", leak, out)
+		}
+	}
+	for _, want := range []string{`"request_id":"req-1"`, `"phone":"***67"`, `"email":"b***@example.com"`, `otp sent to ***67`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log lacks %s: %s", want, out)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+// Package metrics keeps counters and histograms and exposes them, with
+// gauges read at scrape time, in the Prometheus text format.
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are latency buckets in seconds, from 5ms to 10s.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+
+	// scrapeErrors counts gauge functions that failed, by metric
+	scrapeErrors *CounterVec
+}
+
+// family is one metric with its HELP and TYPE lines.
+type family interface {
+	write(ctx context.Context, buf *bytes.Buffer) error
+}
+
+func NewRegistry() *Registry {
+	reg := &Registry{}
+	reg.scrapeErrors = reg.Counter("metrics_scrape_errors_total", "Gauges that could not be read during a scrape.", "metric")
+	return reg
+}
+
+func (reg *Registry) register(f family) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.families = append(reg.families, f)
+}
+
+// Sample is one value of a gauge, with its label values in the order the
+// gauge declared the label names.
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+// GaugeFunc registers a gauge whose samples f reads at every scrape.
+func (reg *Registry) GaugeFunc(name, help string, labels []string, f func(ctx context.Context) ([]Sample, error)) {
+	reg.register(&gaugeFunc{name: name, help: help, labels: labels, read: f, kind: "gauge"})
+}
+
+// CounterFunc registers a counter kept elsewhere, such as by database/sql,
+// which f reads at every scrape.
+func (reg *Registry) CounterFunc(name, help string, labels []string, f func(ctx context.Context) ([]Sample, error)) {
+	reg.register(&gaugeFunc{name: name, help: help, labels: labels, read: f, kind: "counter"})
+}
+
+// Write writes every metric in the text format. A gauge that fails to read
+// is left out and counted in metrics_scrape_errors_total.
+func (reg *Registry) Write(ctx context.Context) []byte {
+	reg.mu.Lock()
+	families := append([]family{}, reg.families...)
+	reg.mu.Unlock()
+
+	var out bytes.Buffer
+	for _, f := range families {
+		var buf bytes.Buffer
+		if err := f.write(ctx, &buf); err != nil {
+			if g, ok := f.(*gaugeFunc); ok {
+				reg.scrapeErrors.Inc(g.name)
+			}
+			continue
+		}
+		out.Write(buf.Bytes())
+	}
+	return out.Bytes()
+}
+
+// ServeHTTP answers a scrape.
+func (reg *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(reg.Write(r.Context()))
+}
+
+type CounterVec struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	series map[string]*counter
+}
+
+type counter struct {
+	labels []string
+	value  float64
+}
+
+// Counter registers a counter with the given label names.
+func (reg *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labels: labels, series: map[string]*counter{}}
+	reg.register(c)
+	return c
+}
+
+// Inc adds one to the series with the given label values.
+func (c *CounterVec) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+func (c *CounterVec) Add(v float64, labels ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := strings.Join(labels, "\xff")
+	s, ok := c.series[key]
+	if !ok {
+		s = &counter{labels: append([]string{}, labels...)}
+		c.series[key] = s
+	}
+	s.value += v
+}
+
+func (c *CounterVec) write(ctx context.Context, buf *bytes.Buffer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	header(buf, c.name, c.help, "counter")
+	for _, key := range sortedKeys(c.series) {
+		s := c.series[key]
+		line(buf, c.name, c.labels, s.labels, "", "", s.value)
+	}
+	return nil
+}
+
+type HistogramVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+type histogram struct {
+	labels []string
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Histogram registers a histogram with the given upper bounds, in
+// ascending order, and label names.
+func (reg *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{name: name, help: help, labels: labels, buckets: buckets, series: map[string]*histogram{}}
+	reg.register(h)
+	return h
+}
+
+// Observe records v in the series with the given label values.
+func (h *HistogramVec) Observe(v float64, labels ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := strings.Join(labels, "\xff")
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{labels: append([]string{}, labels...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+
+	for i, bound := range h.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *HistogramVec) write(ctx context.Context, buf *bytes.Buffer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	header(buf, h.name, h.help, "histogram")
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		for i, bound := range h.buckets {
+			line(buf, h.name+"_bucket", h.labels, s.labels, "le", formatFloat(bound), float64(s.counts[i]))
+		}
+		line(buf, h.name+"_bucket", h.labels, s.labels, "le", "+Inf", float64(s.count))
+		line(buf, h.name+"_sum", h.labels, s.labels, "", "", s.sum)
+		line(buf, h.name+"_count", h.labels, s.labels, "", "", float64(s.count))
+	}
+	return nil
+}
+
+type gaugeFunc struct {
+	name, help, kind string
+	labels           []string
+	read             func(ctx context.Context) ([]Sample, error)
+}
+
+func (g *gaugeFunc) write(ctx context.Context, buf *bytes.Buffer) error {
+	samples, err := g.read(ctx)
+	if err != nil {
+		return err
+	}
+
+	header(buf, g.name, g.help, g.kind)
+	for _, s := range samples {
+		line(buf, g.name, g.labels, s.Labels, "", "", s.Value)
+	}
+	return nil
+}
+
+func header(buf *bytes.Buffer, name, help, kind string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, kind)
+}
+
+// line writes one sample; extraName and extraValue add a label such as le.
+func line(buf *bytes.Buffer, name string, names, values []string, extraName, extraValue string, v float64) {
+	buf.WriteString(name)
+
+	var pairs []string
+	for i, n := range names {
+		if i < len(values) {
+			pairs = append(pairs, n+`="`+escapeLabel(values[i])+`"`)
+		}
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+extraValue+`"`)
+	}
+	if len(pairs) > 0 {
+		buf.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+
+	buf.WriteString(" " + formatFloat(v) + "\n")
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+func escapeHelp(s string) string { return helpEscaper.Replace(s) }
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
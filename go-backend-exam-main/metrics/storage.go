@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"city2city/api/models"
+	"city2city/storage"
+)
+
+// DBStatser is a store backed by a database/sql pool.
+type DBStatser interface {
+	DBStats() sql.DBStats
+}
+
+// RegisterStorage exports the business figures of store and, for a store
+// backed by a connection pool, the pool statistics.
+func RegisterStorage(reg *Registry, store storage.IStorage) {
+	if pool, ok := store.(DBStatser); ok {
+		registerDBStats(reg, pool)
+	}
+
+	read := statsReader(store)
+
+	reg.GaugeFunc("city2city_trips", "Trips created.", nil, func(ctx context.Context) ([]Sample, error) {
+		stats, err := read(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return []Sample{{Value: float64(stats.Trips)}}, nil
+	})
+
+	reg.GaugeFunc("city2city_bookings", "Seats booked on trips.", nil, func(ctx context.Context) ([]Sample, error) {
+		stats, err := read(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return []Sample{{Value: float64(stats.Bookings)}}, nil
+	})
+
+	reg.GaugeFunc("city2city_cars_online", "Online cars by the city their route leaves from.", []string{"city_id", "city"}, func(ctx context.Context) ([]Sample, error) {
+		stats, err := read(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		samples := make([]Sample, 0, len(stats.OnlineCars))
+		for _, city := range stats.OnlineCars {
+			samples = append(samples, Sample{Labels: []string{city.CityID, city.City}, Value: float64(city.Count)})
+		}
+		return samples, nil
+	})
+}
+
+// statsReader reads the business figures once for the three gauges of a
+// scrape, reusing them for a second.
+func statsReader(store storage.IStorage) func(context.Context) (models.Stats, error) {
+	var (
+		mu     sync.Mutex
+		stats  models.Stats
+		readAt time.Time
+	)
+
+	return func(ctx context.Context) (models.Stats, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if time.Since(readAt) < time.Second {
+			return stats, nil
+		}
+
+		fresh, err := store.Stats().Get(ctx)
+		if err != nil {
+			return models.Stats{}, err
+		}
+		stats, readAt = fresh, time.Now()
+		return stats, nil
+	}
+}
+
+func registerDBStats(reg *Registry, pool DBStatser) {
+	gauge := func(name, help string, value func(sql.DBStats) float64) {
+		reg.GaugeFunc(name, help, nil, func(context.Context) ([]Sample, error) {
+			return []Sample{{Value: value(pool.DBStats())}}, nil
+		})
+	}
+	counter := func(name, help string, value func(sql.DBStats) float64) {
+		reg.CounterFunc(name, help, nil, func(context.Context) ([]Sample, error) {
+			return []Sample{{Value: value(pool.DBStats())}}, nil
+		})
+	}
+
+	gauge("db_max_open_connections", "Maximum number of open connections to the database.", func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) })
+	gauge("db_open_connections", "Established connections, in use and idle.", func(s sql.DBStats) float64 { return float64(s.OpenConnections) })
+	gauge("db_in_use_connections", "Connections currently in use.", func(s sql.DBStats) float64 { return float64(s.InUse) })
+	gauge("db_idle_connections", "Idle connections.", func(s sql.DBStats) float64 { return float64(s.Idle) })
+	counter("db_wait_count_total", "Connections waited for.", func(s sql.DBStats) float64 { return float64(s.WaitCount) })
+	counter("db_wait_duration_seconds_total", "Time spent waiting for a connection.", func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() })
+	counter("db_max_idle_closed_total", "Connections closed because of SetMaxIdleConns.", func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) })
+	counter("db_max_idle_time_closed_total", "Connections closed because of SetConnMaxIdleTime.", func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) })
+	counter("db_max_lifetime_closed_total", "Connections closed because of SetConnMaxLifetime.", func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) })
+}
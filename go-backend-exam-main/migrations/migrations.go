@@ -0,0 +1,328 @@
+// Package migrations holds the numbered postgres schema migrations and
+// applies them, recording every applied version in schema_migrations.
+//
+// Files are named <version>_<name>.up.sql and <version>_<name>.down.sql.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+//go:embed postgres/*.sql
+var postgresFS embed.FS
+
+// Dir is where migrate create writes new files, relative to the module root.
+const Dir = "migrations/postgres"
+
+// lockID serialises migrators running against the same database.
+const lockID = 7310401
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New returns a migrator for the embedded postgres migrations.
+func New(db *sql.DB) (*Migrator, error) {
+	sub, err := fs.Sub(postgresFS, "postgres")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := Load(sub)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Load reads the migrations in fsys, ordered by version. Every version needs
+// both an up and a down file.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Latest is the version the code expects the schema to be at.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version is the highest version applied to the database, 0 for none. It
+// only reads, so readiness probes can call it: a database never migrated
+// has no schema_migrations table and is at version 0.
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	var version sql.NullInt64
+	err := m.db.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&version)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "42P01" {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error while reading schema version: %w", err)
+	}
+
+	return version.Int64, nil
+}
+
+// Status lists every known migration with the time it was applied, if it was.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Migration: migration}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Pending lists the migrations not applied yet, oldest first.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+
+	return pending, nil
+}
+
+// Up applies every pending migration, each in its own transaction, and
+// returns the ones it applied. A migration another migrator applied in the
+// meantime is skipped.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range pending {
+		ran, err := m.inTx(ctx, `SELECT NOT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, migration.Version,
+			migration.Up, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, migration.Version, migration.Name)
+		if err != nil {
+			return done, fmt.Errorf("error while applying migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if ran {
+			done = append(done, migration)
+		}
+	}
+
+	return done, nil
+}
+
+// Down reverts the most recently applied migration. It returns false when
+// nothing was applied.
+func (m *Migrator) Down(ctx context.Context) (Migration, bool, error) {
+	version, err := m.Version(ctx)
+	if err != nil || version == 0 {
+		return Migration{}, false, err
+	}
+
+	for _, migration := range m.migrations {
+		if migration.Version != version {
+			continue
+		}
+
+		ran, err := m.inTx(ctx, `SELECT COALESCE(MAX(version), 0) = $1 FROM schema_migrations`, migration.Version,
+			migration.Down, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+		if err != nil {
+			return Migration{}, false, fmt.Errorf("error while reverting migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if !ran {
+			return Migration{}, false, fmt.Errorf("migration %d_%s is no longer the latest applied, another migrator changed the schema", migration.Version, migration.Name)
+		}
+		return migration, true, nil
+	}
+
+	return Migration{}, false, fmt.Errorf("applied migration %d is unknown to this build", version)
+}
+
+// Create writes an empty up/down pair for name into dir, numbered after the
+// highest version already there, and returns the two paths.
+func Create(dir, name string) (string, string, error) {
+	if !regexp.MustCompile(`^\w+$`).MatchString(name) {
+		return "", "", fmt.Errorf("migration name %q may only contain letters, digits and _", name)
+	}
+
+	migrations, err := Load(os.DirFS(dir))
+	if err != nil {
+		return "", "", err
+	}
+
+	version := int64(1)
+	if len(migrations) > 0 {
+		version = migrations[len(migrations)-1].Version + 1
+	}
+
+	base := filepath.Join(dir, fmt.Sprintf("%06d_%s", version, name))
+	up, down := base+".up.sql", base+".down.sql"
+	for _, path := range []string{up, down} {
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			return "", "", err
+		}
+	}
+
+	return up, down, nil
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version bigint primary key,
+    name text not null,
+    applied_at timestamp not null default now()
+)`)
+	if err != nil {
+		return fmt.Errorf("error while creating schema_migrations: %w", err)
+	}
+	return nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int64]time.Time, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// inTx runs script and then record in one transaction, so a failed
+// migration leaves neither schema nor bookkeeping changed. It first takes
+// an advisory lock and asks the check query, given version, whether the
+// migration is still due: what a concurrent migrator did before the lock
+// was granted is visible by then. It reports whether the script ran.
+func (m *Migrator) inTx(ctx context.Context, check string, version int64, script, record string, args ...interface{}) (bool, error) {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, lockID); err != nil {
+		return false, err
+	}
+
+	var due bool
+	if err := tx.QueryRowContext(ctx, check, version).Scan(&due); err != nil {
+		return false, err
+	}
+	if !due {
+		return false, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return false, err
+	}
+
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
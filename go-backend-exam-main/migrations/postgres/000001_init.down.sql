@@ -0,0 +1,6 @@
+drop table if exists trip_customers;
+drop table if exists trips;
+drop table if exists cars;
+drop table if exists drivers;
+drop table if exists customers;
+drop table if exists cities;
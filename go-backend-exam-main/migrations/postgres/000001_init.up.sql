@@ -1,10 +1,13 @@
-create table cities (
+-- "if not exists" lets databases created from the old db.sql adopt versioning
+-- by running migrate up.
+
+create table if not exists cities (
     id uuid primary key,
     name text check (char_length(name) > 3 AND char_length(name) <= 30),
     created_at timestamp default now()
 );
 
-create table customers (
+create table if not exists customers (
     id uuid primary key,
     full_name text,
     phone text unique,
@@ -14,7 +17,7 @@ create table customers (
 
 
 
-create table drivers (
+create table if not exists drivers (
     id uuid primary key ,
     full_name text,
     phone text unique,
@@ -23,7 +26,7 @@ create table drivers (
     created_at timestamp default now()
 );
 
-create table cars (
+create table if not exists cars (
                       id uuid primary key ,
                       model varchar(30),
                       brand varchar(30),
@@ -32,7 +35,7 @@ create table cars (
                       driver_id uuid references drivers(id),
                       created_at timestamp default now()
 );
-create table trips (
+create table if not exists trips (
     id uuid primary key,
     trip_number_id varchar(5) unique,
     from_city_id uuid references cities(id),
@@ -42,9 +45,9 @@ create table trips (
     created_at timestamp default now()
 );
 
-create table trip_customers (
+create table if not exists trip_customers (
     id uuid primary key,
     trip_id uuid references trips(id),
     customer_id uuid references customers(id),
     created_at timestamp default now()
-);
\ No newline at end of file
+);
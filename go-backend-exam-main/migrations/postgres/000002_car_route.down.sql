@@ -0,0 +1,6 @@
+drop index if exists cars_route_idx;
+
+alter table cars
+    drop column if exists departure_time,
+    drop column if exists to_city_id,
+    drop column if exists from_city_id;
@@ -0,0 +1,6 @@
+alter table cars
+    add column from_city_id uuid references cities(id),
+    add column to_city_id uuid references cities(id),
+    add column departure_time timestamp;
+
+create index cars_route_idx on cars (from_city_id, to_city_id, departure_time) where status;
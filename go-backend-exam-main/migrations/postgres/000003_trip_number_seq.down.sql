@@ -0,0 +1,5 @@
+alter table trips
+    alter column trip_number_id drop not null,
+    alter column trip_number_id drop default;
+
+drop sequence if exists trip_number_seq;
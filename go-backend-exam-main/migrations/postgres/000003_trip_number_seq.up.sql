@@ -0,0 +1,15 @@
+create sequence trip_number_seq;
+
+-- continue after the highest T-<n> handed out by clients so far
+select setval('trip_number_seq',
+              coalesce(max(substring(trip_number_id from '^T-(\d+)$')::bigint), 0) + 1,
+              false)
+from trips;
+
+alter table trips
+    alter column trip_number_id type varchar(30),
+    alter column trip_number_id set default 'T-' || nextval('trip_number_seq');
+
+update trips set trip_number_id = default where trip_number_id is null;
+
+alter table trips alter column trip_number_id set not null;
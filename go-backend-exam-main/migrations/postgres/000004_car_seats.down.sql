@@ -0,0 +1,3 @@
+alter table trip_customers drop constraint if exists trip_customers_trip_id_customer_id_key;
+
+alter table cars drop column if exists seats;
@@ -0,0 +1,3 @@
+alter table cars add column seats int not null default 4 check (seats > 0);
+
+alter table trip_customers add constraint trip_customers_trip_id_customer_id_key unique (trip_id, customer_id);
@@ -0,0 +1,15 @@
+create table admins (
+    id uuid primary key,
+    login varchar(50) unique not null,
+    password_hash text not null,
+    created_at timestamp default now()
+);
+
+create table otp_codes (
+    role varchar(20) not null,
+    phone text not null,
+    code_hash text not null,
+    attempts int not null default 0,
+    expires_at timestamp not null,
+    primary key (role, phone)
+);
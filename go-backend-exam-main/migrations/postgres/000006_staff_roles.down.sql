@@ -0,0 +1,2 @@
+delete from admins where role <> 'admin';
+alter table admins drop column role;
@@ -0,0 +1 @@
+alter table admins add column role varchar(20) not null default 'admin' check (role in ('admin', 'dispatcher'));
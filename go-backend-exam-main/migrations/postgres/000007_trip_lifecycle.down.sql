@@ -0,0 +1,9 @@
+drop table trip_events;
+
+alter table trips
+    drop constraint trips_schedule_check,
+    drop column arrived_at,
+    drop column departed_at,
+    drop column scheduled_arrival,
+    drop column scheduled_departure,
+    drop column status;
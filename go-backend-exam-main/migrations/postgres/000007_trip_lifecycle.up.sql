@@ -0,0 +1,20 @@
+alter table trips
+    add column status varchar(20) not null default 'scheduled'
+        check (status in ('scheduled', 'boarding', 'in_progress', 'completed', 'cancelled')),
+    add column scheduled_departure timestamp,
+    add column scheduled_arrival timestamp,
+    add column departed_at timestamp,
+    add column arrived_at timestamp,
+    add constraint trips_schedule_check check (scheduled_arrival > scheduled_departure);
+
+create table trip_events (
+    id uuid primary key,
+    trip_id uuid not null references trips(id) on delete cascade,
+    from_status varchar(20) not null,
+    to_status varchar(20) not null,
+    actor_id varchar(36) not null,
+    actor_role varchar(20) not null,
+    created_at timestamp not null default now()
+);
+
+create index trip_events_trip_id_idx on trip_events (trip_id, created_at);
@@ -0,0 +1,14 @@
+-- cancelled bookings may repeat an active one, which the constraint forbids
+delete from trip_customers where cancelled_at is not null;
+
+drop index trip_customers_trip_id_customer_id_key;
+
+alter table trip_customers add constraint trip_customers_trip_id_customer_id_key unique (trip_id, customer_id);
+
+alter table trip_customers
+    drop column penalty,
+    drop column refund,
+    drop column cancel_reason,
+    drop column cancelled_by_role,
+    drop column cancelled_by,
+    drop column cancelled_at;
@@ -0,0 +1,14 @@
+alter table trip_customers
+    add column cancelled_at timestamp,
+    add column cancelled_by varchar(36),
+    add column cancelled_by_role varchar(20),
+    add column cancel_reason varchar(500),
+    add column refund int check (refund >= 0),
+    add column penalty int check (penalty >= 0);
+
+-- a cancelled booking stays for history and no longer holds the customer's
+-- place on the trip
+alter table trip_customers drop constraint trip_customers_trip_id_customer_id_key;
+
+create unique index trip_customers_trip_id_customer_id_key on trip_customers (trip_id, customer_id)
+    where cancelled_at is null;
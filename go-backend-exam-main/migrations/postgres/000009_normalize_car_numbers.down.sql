@@ -0,0 +1,2 @@
+-- the original spacing is not kept, normalised plates stay as they are
+select 1;
@@ -0,0 +1,5 @@
+-- plates are stored upper case without spaces; two cars whose plates only
+-- differed in spacing or case fail the unique constraint here and have to
+-- be merged by hand first
+update cars set number = upper(replace(number, ' ', ''))
+    where number <> upper(replace(number, ' ', ''));
@@ -0,0 +1,142 @@
+// Package policy decides what an authenticated caller may do. It knows
+// nothing about HTTP: handlers ask it and turn a refusal into a 403.
+//
+// Admins may do anything. Every other role gets the actions listed for it
+// in rules; an action marked own is limited to records the caller owns.
+package policy
+
+import (
+	"fmt"
+
+	"city2city/auth"
+)
+
+type Action string
+
+const (
+	Read         Action = "read"
+	List         Action = "list"
+	Create       Action = "create"
+	Update       Action = "update"
+	Delete       Action = "delete"
+	UpdateStatus Action = "update the status of"
+	UpdateRoute  Action = "update the route of"
+	Cancel       Action = "cancel"
+)
+
+type Resource string
+
+const (
+	City         Resource = "city"
+	Customer     Resource = "customer"
+	Driver       Resource = "driver"
+	Car          Resource = "car"
+	Trip         Resource = "trip"
+	TripCustomer Resource = "trip_customer"
+	TripEvent    Resource = "trip_event"
+	Admin        Resource = "admin"
+)
+
+// Record names the owners of a record: the customer and the driver it
+// belongs to, either of which may be empty.
+type Record struct {
+	CustomerID string
+	DriverID   string
+}
+
+// Decision is the answer to a policy question. When Allowed is false Reason
+// says why. OwnOnly means the caller is limited to records they own, so a
+// list must be narrowed to them and a single record checked with
+// AuthorizeRecord.
+type Decision struct {
+	Allowed bool
+	OwnOnly bool
+	Reason  string
+}
+
+type rule int
+
+const (
+	deny rule = iota
+	own
+	allow
+)
+
+// Cities and trips are the public timetable, so every role may read them.
+// Drivers move their own trips along but only dispatchers cancel them.
+// Bookings are cancelled, which keeps them for history; only admins may
+// delete one outright.
+var rules = map[string]map[Resource]map[Action]rule{
+	auth.RoleDispatcher: {
+		City:         {Read: allow, List: allow},
+		Customer:     {Read: allow, List: allow},
+		Driver:       {Read: allow, List: allow},
+		Car:          {Read: allow, List: allow},
+		Trip:         {Read: allow, List: allow, Create: allow, Update: allow, Delete: allow, UpdateStatus: allow, Cancel: allow},
+		TripCustomer: {Read: allow, List: allow, Create: allow, Update: allow, Cancel: allow},
+		TripEvent:    {List: allow},
+	},
+	auth.RoleDriver: {
+		City:      {Read: allow, List: allow},
+		Driver:    {Read: own},
+		Car:       {Read: own, List: own, UpdateStatus: own, UpdateRoute: own},
+		Trip:      {Read: own, List: own, UpdateStatus: own},
+		TripEvent: {List: own},
+	},
+	auth.RoleCustomer: {
+		City:         {Read: allow, List: allow},
+		Customer:     {Read: own},
+		Trip:         {Read: allow, List: allow},
+		TripCustomer: {Read: own, List: own, Create: own, Cancel: own},
+	},
+}
+
+// Authorize decides whether identity may perform action on resource at all.
+func Authorize(identity auth.Identity, action Action, resource Resource) Decision {
+	if identity.Role == auth.RoleAdmin {
+		return Decision{Allowed: true}
+	}
+
+	switch rules[identity.Role][resource][action] {
+	case allow:
+		return Decision{Allowed: true}
+	case own:
+		return Decision{Allowed: true, OwnOnly: true}
+	default:
+		return Decision{Reason: fmt.Sprintf("%s may not %s %s", roleName(identity), action, resource)}
+	}
+}
+
+// AuthorizeRecord decides whether identity may perform action on the record
+// of resource owned as described by record.
+func AuthorizeRecord(identity auth.Identity, action Action, resource Resource, record Record) Decision {
+	decision := Authorize(identity, action, resource)
+	if !decision.Allowed || !decision.OwnOnly {
+		return decision
+	}
+
+	if Owns(identity, record) {
+		return decision
+	}
+
+	return Decision{Reason: fmt.Sprintf("%s may only %s their own %s", identity.Role, action, resource)}
+}
+
+// Owns reports whether record belongs to identity.
+func Owns(identity auth.Identity, record Record) bool {
+	switch identity.Role {
+	case auth.RoleCustomer:
+		return record.CustomerID != "" && record.CustomerID == identity.Subject
+	case auth.RoleDriver:
+		return record.DriverID != "" && record.DriverID == identity.Subject
+	default:
+		return false
+	}
+}
+
+func roleName(identity auth.Identity) string {
+	if identity.Role == "" {
+		return "anonymous caller"
+	}
+	return identity.Role
+}
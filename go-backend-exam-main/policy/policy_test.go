@@ -0,0 +1,65 @@
+package policy
+
+import (
+	"testing"
+
+	"city2city/auth"
+)
+
+var (
+	resources = []Resource{City, Customer, Driver, Car, Trip, TripCustomer, TripEvent, Admin}
+	actions   = []Action{Read, List, Create, Update, Delete, UpdateStatus, UpdateRoute, Cancel}
+)
+
+// Which role may do what is tested over HTTP in the api package; here only
+// what holds for every resource and action.
+func TestAuthorize(t *testing.T) {
+	for _, resource := range resources {
+		for _, action := range actions {
+			if got := Authorize(auth.Identity{Subject: "me", Role: auth.RoleAdmin}, action, resource); !got.Allowed || got.OwnOnly {
+				t.Errorf("admin %s %s: got %+v, want allowed outright", action, resource, got)
+			}
+
+			for _, role := range []string{"", "guest"} {
+				got := Authorize(auth.Identity{Subject: "me", Role: role}, action, resource)
+				if got.Allowed || got.Reason == "" {
+					t.Errorf("%q %s %s: got %+v, want refused with a reason", role, action, resource, got)
+				}
+			}
+		}
+	}
+}
+
+func TestAuthorizeRecord(t *testing.T) {
+	tests := []struct {
+		name     string
+		role     string
+		action   Action
+		resource Resource
+		record   Record
+		want     bool
+	}{
+		{"customer own booking", auth.RoleCustomer, Cancel, TripCustomer, Record{CustomerID: "me"}, true},
+		{"customer other booking", auth.RoleCustomer, Cancel, TripCustomer, Record{CustomerID: "other"}, false},
+		{"customer booking without owner", auth.RoleCustomer, Read, TripCustomer, Record{}, false},
+		{"customer owning as driver", auth.RoleCustomer, Read, TripCustomer, Record{DriverID: "me"}, false},
+		{"customer own profile", auth.RoleCustomer, Read, Customer, Record{CustomerID: "me"}, true},
+		{"customer public trip", auth.RoleCustomer, Read, Trip, Record{DriverID: "other"}, true},
+		{"driver own car", auth.RoleDriver, UpdateRoute, Car, Record{DriverID: "me"}, true},
+		{"driver other car", auth.RoleDriver, UpdateRoute, Car, Record{DriverID: "other"}, false},
+		{"driver own trip", auth.RoleDriver, UpdateStatus, Trip, Record{DriverID: "me"}, true},
+		{"driver owning as customer", auth.RoleDriver, Read, Trip, Record{CustomerID: "me"}, false},
+		{"driver denied outright", auth.RoleDriver, Delete, Car, Record{DriverID: "me"}, false},
+		{"dispatcher any booking", auth.RoleDispatcher, Cancel, TripCustomer, Record{CustomerID: "other"}, true},
+		{"admin any record", auth.RoleAdmin, Delete, Customer, Record{CustomerID: "other"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := AuthorizeRecord(auth.Identity{Subject: "me", Role: tt.role}, tt.action, tt.resource, tt.record)
+			if got.Allowed != tt.want {
+				t.Errorf("got %+v, want allowed %v", got, tt.want)
+			}
+		})
+	}
+}
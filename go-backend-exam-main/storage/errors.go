@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of storage failure. Every error a repo returns for one of these
+// reasons matches the kind with errors.Is, whatever the backend.
+var (
+	ErrNotFound            = errors.New("not found")
+	ErrConflict            = errors.New("conflict")
+	ErrForeignKeyViolation = errors.New("foreign key violation")
+	ErrValidation          = errors.New("validation failed")
+)
+
+var (
+	ErrTripFull      = &Error{Kind: ErrConflict, Message: "no free seats left on this trip"}
+	ErrAlreadyBooked = &Error{Kind: ErrConflict, Message: "customer is already booked on this trip"}
+	ErrTripClosed    = &Error{Kind: ErrConflict, Message: "trip is no longer open for booking"}
+	ErrCancelled     = &Error{Kind: ErrConflict, Message: "booking is already cancelled"}
+	ErrTripDeparted  = &Error{Kind: ErrConflict, Message: "bookings can only be cancelled before the trip departs"}
+	ErrTripFinal     = &Error{Kind: ErrConflict, Message: "trip can only be updated before it departs"}
+	ErrTripBoarding  = &Error{Kind: ErrConflict, Message: "the schedule of a trip can only be changed before boarding"}
+)
+
+// Error is a storage failure of a known Kind with a message fit to show
+// to clients. Err is the driver error behind it, if any.
+type Error struct {
+	Kind    error
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+func NotFound(entity string) *Error {
+	return &Error{Kind: ErrNotFound, Message: entity + " not found"}
+}
+
+// IllegalTransition is the error for moving a trip to a status its current
+// one does not lead to.
+func IllegalTransition(from, to string) *Error {
+	return &Error{Kind: ErrConflict, Message: fmt.Sprintf("trip is %s and cannot become %s", from, to)}
+}
@@ -0,0 +1,62 @@
+package memory
+
+import (
+	"context"
+
+	"city2city/api/models"
+	"city2city/storage"
+	"github.com/google/uuid"
+)
+
+type adminRepo struct {
+	db *db
+}
+
+func NewAdminRepo(db *db) storage.IAdminRepo {
+	return adminRepo{db: db}
+}
+
+func (a adminRepo) Create(ctx context.Context, admin models.CreateAdmin) (string, error) {
+	a.db.mu.Lock()
+	defer a.db.mu.Unlock()
+
+	if a.db.admins.exists(func(other models.Admin) bool { return other.Login == admin.Login }) {
+		return "", uniqueViolation("admins", "login")
+	}
+
+	id := uuid.New().String()
+	a.db.admins.insert(id, models.Admin{
+		ID:           id,
+		Login:        admin.Login,
+		Role:         admin.Role,
+		PasswordHash: admin.PasswordHash,
+		CreatedAt:    timestamp(now()),
+	})
+
+	return id, nil
+}
+
+func (a adminRepo) Get(ctx context.Context, id string) (models.Admin, error) {
+	a.db.mu.RLock()
+	defer a.db.mu.RUnlock()
+
+	admin, ok := a.db.admins.get(id)
+	if !ok {
+		return models.Admin{}, notFound("admin")
+	}
+
+	return admin, nil
+}
+
+func (a adminRepo) GetByLogin(ctx context.Context, login string) (models.Admin, error) {
+	a.db.mu.RLock()
+	defer a.db.mu.RUnlock()
+
+	for _, admin := range a.db.admins.rows {
+		if admin.Login == login {
+			return admin, nil
+		}
+	}
+
+	return models.Admin{}, notFound("admin")
+}
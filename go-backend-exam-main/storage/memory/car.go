@@ -0,0 +1,184 @@
+package memory
+
+import (
+	"context"
+	"strings"
+
+	"city2city/api/models"
+	"city2city/storage"
+	"github.com/google/uuid"
+)
+
+type carRepo struct {
+	db *db
+}
+
+func NewCarRepo(db *db) storage.ICarRepo {
+	return carRepo{db: db}
+}
+
+func (c carRepo) Create(ctx context.Context, car models.CreateCar) (string, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	id := uuid.New().String()
+	if err := c.check(id, car.Number, car.DriverID); err != nil {
+		return "", err
+	}
+
+	if car.Seats <= 0 {
+		car.Seats = models.DefaultCarSeats
+	}
+
+	c.db.cars.insert(id, models.Car{
+		ID:        id,
+		Model:     car.Model,
+		Brand:     car.Brand,
+		Number:    car.Number,
+		Status:    true,
+		Seats:     car.Seats,
+		DriverID:  car.DriverID,
+		CreatedAt: timestamp(now()),
+	})
+
+	return id, nil
+}
+
+func (c carRepo) Get(ctx context.Context, id string, expand models.Expand) (models.Car, error) {
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+
+	car, ok := c.db.cars.get(id)
+	if !ok {
+		return models.Car{}, notFound("car")
+	}
+
+	return c.hydrate(car, expand), nil
+}
+
+func (c carRepo) GetList(ctx context.Context, req models.GetCarListRequest) (models.CarsResponse, error) {
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+
+	all := c.db.cars.newest(func(car models.Car) bool {
+		departure := parseTimestamp(car.DepartureTime)
+		return (req.Search == "" || containsFold(car.Model, req.Search) || containsFold(car.Number, req.Search)) &&
+			(req.Status == nil || car.Status == *req.Status) &&
+			(req.Brand == "" || strings.EqualFold(car.Brand, req.Brand)) &&
+			(req.DriverID == "" || car.DriverID == req.DriverID) &&
+			(req.FromCityID == "" || car.FromCityID == req.FromCityID) &&
+			(req.ToCityID == "" || car.ToCityID == req.ToCityID) &&
+			(req.DepartureFrom.IsZero() || car.DepartureTime != "" && !departure.Before(req.DepartureFrom)) &&
+			(req.DepartureTo.IsZero() || car.DepartureTime != "" && !departure.After(req.DepartureTo))
+	})
+	sortRows(all, req.Sort, map[string]func(a, b models.Car) int{
+		"brand": func(a, b models.Car) int { return strings.Compare(a.Brand, b.Brand) },
+		"model": func(a, b models.Car) int { return strings.Compare(a.Model, b.Model) },
+		"departure_time": func(a, b models.Car) int {
+			return compareCreatedAt(a.DepartureTime, b.DepartureTime)
+		},
+		"created_at": func(a, b models.Car) int { return compareCreatedAt(a.CreatedAt, b.CreatedAt) },
+	})
+
+	cars, next, err := list(all, req.GetListRequest, func(c models.Car) (string, string) { return c.CreatedAt, c.ID })
+	if err != nil {
+		return models.CarsResponse{}, err
+	}
+
+	for i := range cars {
+		cars[i] = c.hydrate(cars[i], req.Expand)
+	}
+
+	return models.CarsResponse{Cars: cars, Count: count(all, req.GetListRequest), NextCursor: next}, nil
+}
+
+func (c carRepo) Update(ctx context.Context, car models.Car) (string, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	stored, ok := c.db.cars.get(car.ID)
+	if !ok {
+		return "", notFound("car")
+	}
+
+	if err := c.check(car.ID, car.Number, stored.DriverID); err != nil {
+		return "", err
+	}
+
+	stored.Model = car.Model
+	stored.Brand = car.Brand
+	stored.Number = car.Number
+	if car.Seats != 0 {
+		stored.Seats = car.Seats
+	}
+	c.db.cars.update(car.ID, stored)
+
+	return car.ID, nil
+}
+
+func (c carRepo) Delete(ctx context.Context, id string) error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	if !c.db.cars.delete(id) {
+		return notFound("car")
+	}
+
+	return nil
+}
+
+func (c carRepo) UpdateCarRoute(ctx context.Context, updateCarRoute models.UpdateCarRoute) error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	car, ok := c.db.cars.get(updateCarRoute.CarID)
+	if !ok {
+		return notFound("car")
+	}
+
+	if _, ok := c.db.cities.get(updateCarRoute.FromCityID); !ok {
+		return foreignKeyViolation("cars", "from_city_id")
+	}
+	if _, ok := c.db.cities.get(updateCarRoute.ToCityID); !ok {
+		return foreignKeyViolation("cars", "to_city_id")
+	}
+
+	car.FromCityID = updateCarRoute.FromCityID
+	car.ToCityID = updateCarRoute.ToCityID
+	car.DepartureTime = timestamp(updateCarRoute.DepartureTime.UTC())
+	c.db.cars.update(car.ID, car)
+
+	return nil
+}
+
+func (c carRepo) UpdateCarStatus(ctx context.Context, updateCarStatus models.UpdateCarStatus) error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	car, ok := c.db.cars.get(updateCarStatus.ID)
+	if !ok {
+		return notFound("car")
+	}
+
+	car.Status = updateCarStatus.Status
+	c.db.cars.update(car.ID, car)
+
+	return nil
+}
+
+func (c carRepo) check(id, number, driverID string) error {
+	if c.db.cars.exists(func(other models.Car) bool { return other.ID != id && other.Number == number }) {
+		return uniqueViolation("cars", "number")
+	}
+	if _, ok := c.db.drivers.get(driverID); driverID != "" && !ok {
+		return foreignKeyViolation("cars", "driver_id")
+	}
+	return nil
+}
+
+func (c carRepo) hydrate(car models.Car, expand models.Expand) models.Car {
+	if expand.Has(models.ExpandDriver) && car.DriverID != "" {
+		car.DriverData = c.db.driver(car.DriverID)
+	}
+	return car
+}
@@ -0,0 +1,118 @@
+package memory
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"city2city/api/models"
+	"city2city/storage"
+	"github.com/google/uuid"
+)
+
+type cityRepo struct {
+	db *db
+}
+
+func NewCityRepo(db *db) storage.ICityRepo {
+	return cityRepo{db: db}
+}
+
+func (c cityRepo) Create(ctx context.Context, city models.CreateCity) (string, error) {
+	if err := checkCityName(city.Name); err != nil {
+		return "", err
+	}
+
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	id := uuid.New().String()
+	c.db.cities.insert(id, models.City{
+		ID:        id,
+		Name:      city.Name,
+		CreatedAt: timestamp(now()),
+	})
+
+	return id, nil
+}
+
+func (c cityRepo) Get(ctx context.Context, id string) (models.City, error) {
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+
+	city, ok := c.db.cities.get(id)
+	if !ok {
+		return models.City{}, notFound("city")
+	}
+
+	return city, nil
+}
+
+func (c cityRepo) GetList(ctx context.Context, req models.GetCityListRequest) (models.CitiesResponse, error) {
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+
+	all := c.db.cities.newest(func(city models.City) bool {
+		return req.Search == "" || containsFold(city.Name, req.Search)
+	})
+	sortRows(all, req.Sort, map[string]func(a, b models.City) int{
+		"name":       func(a, b models.City) int { return strings.Compare(a.Name, b.Name) },
+		"created_at": func(a, b models.City) int { return compareCreatedAt(a.CreatedAt, b.CreatedAt) },
+	})
+
+	cities, next, err := list(all, req.GetListRequest, func(c models.City) (string, string) { return c.CreatedAt, c.ID })
+	if err != nil {
+		return models.CitiesResponse{}, err
+	}
+
+	return models.CitiesResponse{Cities: cities, Count: count(all, req.GetListRequest), NextCursor: next}, nil
+}
+
+func (c cityRepo) Update(ctx context.Context, city models.City) (string, error) {
+	if err := checkCityName(city.Name); err != nil {
+		return "", err
+	}
+
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	stored, ok := c.db.cities.get(city.ID)
+	if !ok {
+		return "", notFound("city")
+	}
+
+	stored.Name = city.Name
+	c.db.cities.update(city.ID, stored)
+
+	return city.ID, nil
+}
+
+func (c cityRepo) Delete(ctx context.Context, id string) error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	if _, ok := c.db.cities.get(id); !ok {
+		return notFound("city")
+	}
+
+	switch {
+	case c.db.drivers.exists(func(d models.Driver) bool { return d.FromCityID == id || d.ToCityID == id }):
+		return stillReferenced("cities", "drivers")
+	case c.db.cars.exists(func(car models.Car) bool { return car.FromCityID == id || car.ToCityID == id }):
+		return stillReferenced("cities", "cars")
+	case c.db.trips.exists(func(t models.Trip) bool { return t.FromCityID == id || t.ToCityID == id }):
+		return stillReferenced("cities", "trips")
+	}
+
+	c.db.cities.delete(id)
+
+	return nil
+}
+
+// checkCityName mirrors the check constraint on cities.name.
+func checkCityName(name string) error {
+	if n := utf8.RuneCountInString(name); n <= 3 || n > 30 {
+		return checkViolation("cities", "name")
+	}
+	return nil
+}
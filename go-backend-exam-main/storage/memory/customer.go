@@ -0,0 +1,134 @@
+package memory
+
+import (
+	"context"
+	"strings"
+
+	"city2city/api/models"
+	"city2city/storage"
+	"github.com/google/uuid"
+)
+
+type customerRepo struct {
+	db *db
+}
+
+func NewCustomerRepo(db *db) storage.ICustomerRepo {
+	return customerRepo{db: db}
+}
+
+func (c customerRepo) Create(ctx context.Context, customer models.CreateCustomer) (string, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	id := uuid.New().String()
+	if err := c.checkUnique(id, customer.Phone, customer.Email); err != nil {
+		return "", err
+	}
+
+	c.db.customers.insert(id, models.Customer{
+		ID:        id,
+		FullName:  customer.FullName,
+		Phone:     customer.Phone,
+		Email:     customer.Email,
+		CreatedAt: timestamp(now()),
+	})
+
+	return id, nil
+}
+
+func (c customerRepo) Get(ctx context.Context, id string) (models.Customer, error) {
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+
+	customer, ok := c.db.customers.get(id)
+	if !ok {
+		return models.Customer{}, notFound("customer")
+	}
+
+	return customer, nil
+}
+
+func (c customerRepo) GetByPhone(ctx context.Context, phone string) (models.Customer, error) {
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+
+	for _, customer := range c.db.customers.rows {
+		if customer.Phone == phone {
+			return customer, nil
+		}
+	}
+
+	return models.Customer{}, notFound("customer")
+}
+
+func (c customerRepo) GetList(ctx context.Context, req models.GetCustomerListRequest) (models.CustomersResponse, error) {
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+
+	all := c.db.customers.newest(func(customer models.Customer) bool {
+		return req.Search == "" || containsFold(customer.FullName, req.Search) || containsFold(customer.Phone, req.Search)
+	})
+	sortRows(all, req.Sort, map[string]func(a, b models.Customer) int{
+		"full_name":  func(a, b models.Customer) int { return strings.Compare(a.FullName, b.FullName) },
+		"created_at": func(a, b models.Customer) int { return compareCreatedAt(a.CreatedAt, b.CreatedAt) },
+	})
+
+	customers, next, err := list(all, req.GetListRequest, func(c models.Customer) (string, string) { return c.CreatedAt, c.ID })
+	if err != nil {
+		return models.CustomersResponse{}, err
+	}
+
+	return models.CustomersResponse{Customers: customers, Count: count(all, req.GetListRequest), NextCursor: next}, nil
+}
+
+func (c customerRepo) Update(ctx context.Context, customer models.Customer) (string, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	stored, ok := c.db.customers.get(customer.ID)
+	if !ok {
+		return "", notFound("customer")
+	}
+
+	if err := c.checkUnique(customer.ID, customer.Phone, customer.Email); err != nil {
+		return "", err
+	}
+
+	stored.FullName = customer.FullName
+	stored.Phone = customer.Phone
+	stored.Email = customer.Email
+	c.db.customers.update(customer.ID, stored)
+
+	return customer.ID, nil
+}
+
+func (c customerRepo) Delete(ctx context.Context, id string) error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	if c.db.tripCustomers.exists(func(tc models.TripCustomer) bool { return tc.CustomerID == id }) {
+		return stillReferenced("customers", "trip_customers")
+	}
+
+	if !c.db.customers.delete(id) {
+		return notFound("customer")
+	}
+
+	return nil
+}
+
+func (c customerRepo) checkUnique(id, phone, email string) error {
+	for _, other := range c.db.customers.rows {
+		if other.ID == id {
+			continue
+		}
+		if other.Phone == phone {
+			return uniqueViolation("customers", "phone")
+		}
+		if other.Email == email {
+			return uniqueViolation("customers", "email")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"city2city/api/models"
+	"city2city/storage"
+	"github.com/google/uuid"
+)
+
+type driverRepo struct {
+	db *db
+}
+
+func NewDriverRepo(db *db) storage.IDriverRepo {
+	return driverRepo{db: db}
+}
+
+func (d driverRepo) Create(ctx context.Context, driver models.CreateDriver) (string, error) {
+	d.db.mu.Lock()
+	defer d.db.mu.Unlock()
+
+	id := uuid.New().String()
+	if err := d.check(id, driver.Phone, driver.FromCityID, driver.ToCityID); err != nil {
+		return "", err
+	}
+
+	d.db.drivers.insert(id, models.Driver{
+		ID:         id,
+		FullName:   driver.FullName,
+		Phone:      driver.Phone,
+		FromCityID: driver.FromCityID,
+		ToCityID:   driver.ToCityID,
+		CreatedAt:  timestamp(now()),
+	})
+
+	return id, nil
+}
+
+func (d driverRepo) Get(ctx context.Context, id string, expand models.Expand) (models.Driver, error) {
+	d.db.mu.RLock()
+	defer d.db.mu.RUnlock()
+
+	driver, ok := d.db.drivers.get(id)
+	if !ok {
+		return models.Driver{}, notFound("driver")
+	}
+
+	return d.hydrate(driver, expand), nil
+}
+
+func (d driverRepo) GetByPhone(ctx context.Context, phone string) (models.Driver, error) {
+	d.db.mu.RLock()
+	defer d.db.mu.RUnlock()
+
+	for _, driver := range d.db.drivers.rows {
+		if driver.Phone == phone {
+			return d.hydrate(driver, models.Expand{}), nil
+		}
+	}
+
+	return models.Driver{}, notFound("driver")
+}
+
+func (d driverRepo) GetFull(ctx context.Context, req models.GetDriverFullRequest) (models.DriverFull, error) {
+	d.db.mu.RLock()
+	defer d.db.mu.RUnlock()
+
+	driver, ok := d.db.drivers.get(req.ID)
+	if !ok {
+		return models.DriverFull{}, notFound("driver")
+	}
+
+	full := models.DriverFull{
+		Driver: d.hydrate(driver, nil),
+		Trips:  []models.DriverTrip{},
+	}
+
+	if cars := d.db.cars.newest(func(c models.Car) bool { return c.DriverID == req.ID }); len(cars) > 0 {
+		full.Car = &cars[0]
+	}
+
+	trips := d.db.trips.newest(func(t models.Trip) bool {
+		if t.DriverID != req.ID {
+			return false
+		}
+		date := parseTimestamp(t.Date())
+		return (req.From.IsZero() || !date.Before(req.From)) && (req.To.IsZero() || date.Before(req.To))
+	})
+
+	// by when they run, like the postgres query
+	slices.Reverse(trips)
+	slices.SortStableFunc(trips, func(a, b models.Trip) int { return compareCreatedAt(a.Date(), b.Date()) })
+
+	for _, trip := range trips {
+		trip.FromCityData = d.db.city(trip.FromCityID)
+		trip.ToCityData = d.db.city(trip.ToCityID)
+
+		customers := []models.Customer{}
+		bookings := d.db.tripCustomers.newest(func(tc models.TripCustomer) bool {
+			return tc.TripID == trip.ID && tc.Cancellation == nil
+		})
+		for j := len(bookings) - 1; j >= 0; j-- {
+			customers = append(customers, d.db.customer(bookings[j].CustomerID))
+		}
+
+		full.Trips = append(full.Trips, models.DriverTrip{
+			Trip:      trip,
+			Date:      trip.Date(),
+			Customers: customers,
+		})
+	}
+
+	return full, nil
+}
+
+func (d driverRepo) GetList(ctx context.Context, req models.GetDriverListRequest) (models.DriversResponse, error) {
+	d.db.mu.RLock()
+	defer d.db.mu.RUnlock()
+
+	all := d.db.drivers.newest(func(driver models.Driver) bool {
+		return (req.Search == "" || containsFold(driver.FullName, req.Search) || containsFold(driver.Phone, req.Search)) &&
+			(req.FromCityID == "" || driver.FromCityID == req.FromCityID) &&
+			(req.ToCityID == "" || driver.ToCityID == req.ToCityID)
+	})
+	sortRows(all, req.Sort, map[string]func(a, b models.Driver) int{
+		"full_name":  func(a, b models.Driver) int { return strings.Compare(a.FullName, b.FullName) },
+		"created_at": func(a, b models.Driver) int { return compareCreatedAt(a.CreatedAt, b.CreatedAt) },
+	})
+
+	drivers, next, err := list(all, req.GetListRequest, func(d models.Driver) (string, string) { return d.CreatedAt, d.ID })
+	if err != nil {
+		return models.DriversResponse{}, err
+	}
+
+	for i := range drivers {
+		drivers[i] = d.hydrate(drivers[i], req.Expand)
+	}
+
+	return models.DriversResponse{Drivers: drivers, Count: count(all, req.GetListRequest), NextCursor: next}, nil
+}
+
+func (d driverRepo) Update(ctx context.Context, driver models.Driver) (string, error) {
+	d.db.mu.Lock()
+	defer d.db.mu.Unlock()
+
+	stored, ok := d.db.drivers.get(driver.ID)
+	if !ok {
+		return "", notFound("driver")
+	}
+
+	if err := d.check(driver.ID, driver.Phone, driver.FromCityID, driver.ToCityID); err != nil {
+		return "", err
+	}
+
+	stored.FullName = driver.FullName
+	stored.Phone = driver.Phone
+	stored.FromCityID = driver.FromCityID
+	stored.ToCityID = driver.ToCityID
+	d.db.drivers.update(driver.ID, stored)
+
+	return driver.ID, nil
+}
+
+func (d driverRepo) Delete(ctx context.Context, id string) error {
+	d.db.mu.Lock()
+	defer d.db.mu.Unlock()
+
+	switch {
+	case d.db.cars.exists(func(c models.Car) bool { return c.DriverID == id }):
+		return stillReferenced("drivers", "cars")
+	case d.db.trips.exists(func(t models.Trip) bool { return t.DriverID == id }):
+		return stillReferenced("drivers", "trips")
+	}
+
+	if !d.db.drivers.delete(id) {
+		return notFound("driver")
+	}
+
+	return nil
+}
+
+func (d driverRepo) check(id, phone, fromCityID, toCityID string) error {
+	if d.db.drivers.exists(func(other models.Driver) bool { return other.ID != id && other.Phone == phone }) {
+		return uniqueViolation("drivers", "phone")
+	}
+	if _, ok := d.db.cities.get(fromCityID); fromCityID != "" && !ok {
+		return foreignKeyViolation("drivers", "from_city_id")
+	}
+	if _, ok := d.db.cities.get(toCityID); toCityID != "" && !ok {
+		return foreignKeyViolation("drivers", "to_city_id")
+	}
+	return nil
+}
+
+func (d driverRepo) hydrate(driver models.Driver, expand models.Expand) models.Driver {
+	if expand.Has(models.ExpandFromCity) {
+		driver.FromCityData = d.db.city(driver.FromCityID)
+	}
+	if expand.Has(models.ExpandToCity) {
+		driver.ToCityData = d.db.city(driver.ToCityID)
+	}
+	return driver
+}
@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"city2city/api/models"
+)
+
+func TestDriverFullGoesByDeparture(t *testing.T) {
+	ctx := context.Background()
+	store := New()
+	now := time.Now().UTC()
+
+	nextWeek := newTrip(t, store, 4, models.CreateTrip{Price: 1000, ScheduledDeparture: now.AddDate(0, 0, 7).Format(time.RFC3339)})
+	trip, err := store.Trip().Get(ctx, nextWeek, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tomorrow := create(t)(store.Trip().Create(ctx, models.CreateTrip{
+		FromCityID: trip.FromCityID, ToCityID: trip.ToCityID, DriverID: trip.DriverID, Price: 1000,
+		ScheduledDeparture: now.AddDate(0, 0, 1).Format(time.RFC3339),
+	}))
+	unscheduled := create(t)(store.Trip().Create(ctx, models.CreateTrip{
+		FromCityID: trip.FromCityID, ToCityID: trip.ToCityID, DriverID: trip.DriverID, Price: 1000,
+	}))
+
+	full, err := store.Driver().GetFull(ctx, models.GetDriverFullRequest{ID: trip.DriverID, From: now.AddDate(0, 0, -1), To: now.AddDate(0, 0, 3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// all three were created today, only two run this week
+	var got []string
+	for _, trip := range full.Trips {
+		got = append(got, trip.ID)
+		if trip.Date != trip.Trip.Date() {
+			t.Errorf("trip %s: got date %s, want %s", trip.ID, trip.Date, trip.Trip.Date())
+		}
+	}
+	if want := []string{unscheduled, tomorrow}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got trips %v, want %v", got, want)
+	}
+}
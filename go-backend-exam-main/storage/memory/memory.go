@@ -0,0 +1,333 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"city2city/api/models"
+	"city2city/storage"
+)
+
+// Store keeps every table in process memory. It mirrors the postgres store
+// closely enough to run the API and handler tests without a database: the
+// same unique and foreign key rules, newest-first ordering and LIMIT/OFFSET
+// paging. All repos share one lock.
+type Store struct {
+	db *db
+}
+
+type db struct {
+	mu            sync.RWMutex
+	cities        *table[models.City]
+	customers     *table[models.Customer]
+	drivers       *table[models.Driver]
+	cars          *table[models.Car]
+	trips         *table[models.Trip]
+	tripCustomers *table[models.TripCustomer]
+	tripEvents    *table[models.TripEvent]
+	admins        *table[models.Admin]
+	otps          map[string]models.OTP
+	tripNumberSeq int
+	// inTx marks the copy of the tables a transaction works on
+	inTx bool
+}
+
+func New() storage.IStorage {
+	return Store{
+		db: &db{
+			cities:        newTable[models.City](),
+			customers:     newTable[models.Customer](),
+			drivers:       newTable[models.Driver](),
+			cars:          newTable[models.Car](),
+			trips:         newTable[models.Trip](),
+			tripCustomers: newTable[models.TripCustomer](),
+			tripEvents:    newTable[models.TripEvent](),
+			admins:        newTable[models.Admin](),
+			otps:          map[string]models.OTP{},
+		},
+	}
+}
+
+func (s Store) CloseDB() {}
+
+func (s Store) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s Store) City() storage.ICityRepo {
+	return NewCityRepo(s.db)
+}
+
+func (s Store) Customer() storage.ICustomerRepo {
+	return NewCustomerRepo(s.db)
+}
+
+func (s Store) Driver() storage.IDriverRepo {
+	return NewDriverRepo(s.db)
+}
+
+func (s Store) Car() storage.ICarRepo {
+	return NewCarRepo(s.db)
+}
+
+func (s Store) Trip() storage.ITripRepo {
+	return NewTripRepo(s.db)
+}
+
+func (s Store) TripCustomer() storage.ITripCustomerRepo {
+	return NewTripCustomerRepo(s.db)
+}
+
+func (s Store) Admin() storage.IAdminRepo {
+	return NewAdminRepo(s.db)
+}
+
+func (s Store) OTP() storage.IOTPRepo {
+	return NewOTPRepo(s.db)
+}
+
+func (s Store) Stats() storage.IStatsRepo {
+	return NewStatsRepo(s.db)
+}
+
+// table holds rows by id and remembers insertion order, which is also
+// created_at order.
+type table[T any] struct {
+	rows  map[string]T
+	order []string
+}
+
+func newTable[T any]() *table[T] {
+	return &table[T]{rows: map[string]T{}}
+}
+
+func (t *table[T]) clone() *table[T] {
+	return &table[T]{rows: maps.Clone(t.rows), order: slices.Clone(t.order)}
+}
+
+func (t *table[T]) get(id string) (T, bool) {
+	row, ok := t.rows[id]
+	return row, ok
+}
+
+func (t *table[T]) insert(id string, row T) {
+	t.rows[id] = row
+	t.order = append(t.order, id)
+}
+
+func (t *table[T]) update(id string, row T) bool {
+	if _, ok := t.rows[id]; !ok {
+		return false
+	}
+	t.rows[id] = row
+	return true
+}
+
+func (t *table[T]) delete(id string) bool {
+	if _, ok := t.rows[id]; !ok {
+		return false
+	}
+
+	delete(t.rows, id)
+	for i, orderID := range t.order {
+		if orderID == id {
+			t.order = append(t.order[:i], t.order[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// newest returns the rows matching keep, most recently created first.
+func (t *table[T]) newest(keep func(T) bool) []T {
+	rows := []T{}
+	for i := len(t.order) - 1; i >= 0; i-- {
+		row := t.rows[t.order[i]]
+		if keep == nil || keep(row) {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+func (t *table[T]) exists(match func(T) bool) bool {
+	for _, row := range t.rows {
+		if match(row) {
+			return true
+		}
+	}
+	return false
+}
+
+// list pages rows, already filtered and sorted, as req asks: by LIMIT/OFFSET
+// or, in cursor mode, newest first by (created_at, id) after req.After. key
+// gives a row's created_at and id.
+func list[T any](rows []T, req models.GetListRequest, key func(T) (string, string)) ([]T, string, error) {
+	if !req.CursorMode {
+		rows, err := page(rows, req.Page, req.Limit)
+		return rows, "", err
+	}
+
+	newer := func(a, b T) int {
+		aCreatedAt, aID := key(a)
+		bCreatedAt, bID := key(b)
+		if c := compareCreatedAt(bCreatedAt, aCreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(bID, aID)
+	}
+
+	rows = slices.Clone(rows)
+	slices.SortFunc(rows, newer)
+
+	if req.After != nil {
+		i := 0
+		for ; i < len(rows); i++ {
+			createdAt, id := key(rows[i])
+			t := parseTimestamp(createdAt)
+			if t.Before(req.After.CreatedAt) || t.Equal(req.After.CreatedAt) && id < req.After.ID {
+				break
+			}
+		}
+		rows = rows[i:]
+	}
+
+	if len(rows) > req.Limit+1 {
+		rows = rows[:req.Limit+1]
+	}
+
+	rows, next := models.NextCursor(rows, req.Limit, key)
+	return rows, next, nil
+}
+
+// count is the total for a list response, left at zero when req does not
+// ask for one.
+func count[T any](rows []T, req models.GetListRequest) int {
+	if !req.NeedsCount() {
+		return 0
+	}
+	return len(rows)
+}
+
+// page applies LIMIT limit OFFSET (page-1)*limit the way postgres does.
+func page[T any](rows []T, page, limit int) ([]T, error) {
+	offset := (page - 1) * limit
+	if limit < 0 {
+		return nil, errors.New("LIMIT must not be negative")
+	}
+	if offset < 0 {
+		return nil, errors.New("OFFSET must not be negative")
+	}
+
+	if offset >= len(rows) {
+		return []T{}, nil
+	}
+	rows = rows[offset:]
+	if limit < len(rows) {
+		rows = rows[:limit]
+	}
+	return rows, nil
+}
+
+// sortRows orders rows, which come newest first, by the fields of sort that
+// have a comparison in fields. Rows that compare equal keep their order.
+func sortRows[T any](rows []T, sort []models.SortField, fields map[string]func(a, b T) int) {
+	sorter := func(a, b T) int { return 0 }
+	for i := len(sort) - 1; i >= 0; i-- {
+		compare, ok := fields[sort[i].Field]
+		if !ok {
+			continue
+		}
+		desc, next := sort[i].Desc, sorter
+		sorter = func(a, b T) int {
+			if c := compare(a, b); c != 0 {
+				if desc {
+					return -c
+				}
+				return c
+			}
+			return next(a, b)
+		}
+	}
+
+	slices.SortStableFunc(rows, sorter)
+}
+
+func compareCreatedAt(a, b string) int {
+	return parseTimestamp(a).Compare(parseTimestamp(b))
+}
+
+// containsFold reports whether substr is within s, ignoring case, like
+// ILIKE '%substr%'.
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+// timestamp formats t the way database/sql renders a postgres timestamp
+// scanned into a string.
+func timestamp(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
+
+// The join helpers return the zero value for a missing or empty reference,
+// like a postgres LEFT JOIN does.
+
+func (d *db) city(id string) models.City {
+	city, _ := d.cities.get(id)
+	return city
+}
+
+func (d *db) driver(id string) models.Driver {
+	driver, _ := d.drivers.get(id)
+	driver.FromCityData = models.City{ID: driver.FromCityID}
+	driver.ToCityData = models.City{ID: driver.ToCityID}
+	return driver
+}
+
+func (d *db) customer(id string) models.Customer {
+	customer, _ := d.customers.get(id)
+	return customer
+}
+
+func parseTimestamp(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, s)
+	return t
+}
+
+// The error helpers word their messages like postgres does and return the
+// same kinds of *storage.Error the postgres repos do.
+
+func notFound(entity string) error {
+	return &storage.Error{Kind: storage.ErrNotFound, Message: entity + " not found", Err: sql.ErrNoRows}
+}
+
+func uniqueViolation(table, column string) error {
+	return &storage.Error{Kind: storage.ErrConflict,
+		Message: fmt.Sprintf("duplicate key value violates unique constraint on %s.%s", table, column)}
+}
+
+func foreignKeyViolation(table, column string) error {
+	return &storage.Error{Kind: storage.ErrForeignKeyViolation,
+		Message: fmt.Sprintf("insert or update on %s violates foreign key constraint on %s", table, column)}
+}
+
+func stillReferenced(table, by string) error {
+	return &storage.Error{Kind: storage.ErrForeignKeyViolation,
+		Message: fmt.Sprintf("update or delete on %s violates foreign key constraint: still referenced from %s", table, by)}
+}
+
+func checkViolation(table, column string) error {
+	return &storage.Error{Kind: storage.ErrValidation,
+		Message: fmt.Sprintf("new row for relation %s violates check constraint on %s", table, column)}
+}
@@ -0,0 +1,55 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"city2city/api/models"
+	"city2city/storage"
+)
+
+// newTrip stores a trip between two new cities, driven in a car of seats
+// places, and returns its ID.
+func newTrip(t *testing.T, store storage.IStorage, seats int, trip models.CreateTrip) string {
+	t.Helper()
+	ctx := context.Background()
+
+	from := create(t)(store.City().Create(ctx, models.CreateCity{Name: "Tashkent"}))
+	to := create(t)(store.City().Create(ctx, models.CreateCity{Name: "Samarkand"}))
+	driver := create(t)(store.Driver().Create(ctx, models.CreateDriver{
+		FullName: "Ali Valiyev", Phone: "+998901234567", FromCityID: from, ToCityID: to,
+	}))
+	create(t)(store.Car().Create(ctx, models.CreateCar{
+		Model: "Cobalt", Brand: "Chevrolet", Number: "01A123BC", Seats: seats, DriverID: driver,
+	}))
+
+	trip.FromCityID, trip.ToCityID, trip.DriverID = from, to, driver
+	return create(t)(store.Trip().Create(ctx, trip))
+}
+
+// newCustomers stores n customers and returns their IDs.
+func newCustomers(t *testing.T, store storage.IStorage, n int) []string {
+	t.Helper()
+
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = create(t)(store.Customer().Create(context.Background(), models.CreateCustomer{
+			FullName: fmt.Sprintf("Customer %d", i),
+			Phone:    fmt.Sprintf("+99890111%04d", i),
+			Email:    fmt.Sprintf("customer%d@example.com", i),
+		}))
+	}
+	return ids
+}
+
+// create fails the test on the error of a Create call and returns its ID.
+func create(t *testing.T) func(id string, err error) string {
+	return func(id string, err error) string {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		return id
+	}
+}
@@ -0,0 +1,72 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"city2city/api/models"
+	"city2city/storage"
+)
+
+type otpRepo struct {
+	db *db
+}
+
+func NewOTPRepo(db *db) storage.IOTPRepo {
+	return otpRepo{db: db}
+}
+
+func (o otpRepo) Save(ctx context.Context, otp models.OTP) error {
+	o.db.mu.Lock()
+	defer o.db.mu.Unlock()
+
+	o.db.otps[otpKey(otp.Role, otp.Phone)] = otp
+
+	return nil
+}
+
+func (o otpRepo) Attempt(ctx context.Context, role, phone string) (models.OTP, error) {
+	o.db.mu.Lock()
+	defer o.db.mu.Unlock()
+
+	otp, ok := o.db.otps[otpKey(role, phone)]
+	if !ok {
+		return models.OTP{}, notFound("otp")
+	}
+
+	otp.Attempts++
+	o.db.otps[otpKey(role, phone)] = otp
+
+	return otp, nil
+}
+
+func (o otpRepo) Delete(ctx context.Context, role, phone string) error {
+	o.db.mu.Lock()
+	defer o.db.mu.Unlock()
+
+	if _, ok := o.db.otps[otpKey(role, phone)]; !ok {
+		return notFound("otp")
+	}
+	delete(o.db.otps, otpKey(role, phone))
+
+	return nil
+}
+
+func (o otpRepo) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	o.db.mu.Lock()
+	defer o.db.mu.Unlock()
+
+	var n int64
+	for key, otp := range o.db.otps {
+		if otp.ExpiresAt.Before(before) {
+			delete(o.db.otps, key)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func otpKey(role, phone string) string {
+	return role + "|" + phone
+}
@@ -0,0 +1,45 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"city2city/api/models"
+	"city2city/storage"
+)
+
+type statsRepo struct {
+	db *db
+}
+
+func NewStatsRepo(db *db) storage.IStatsRepo {
+	return statsRepo{db: db}
+}
+
+func (s statsRepo) Get(ctx context.Context) (models.Stats, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	stats := models.Stats{
+		Trips:      len(s.db.trips.rows),
+		Bookings:   len(s.db.tripCustomers.newest(func(tc models.TripCustomer) bool { return tc.Cancellation == nil })),
+		OnlineCars: []models.CityCount{},
+	}
+
+	online := map[string]int{}
+	for _, car := range s.db.cars.rows {
+		if car.Status && car.FromCityID != "" {
+			online[car.FromCityID]++
+		}
+	}
+	for cityID, count := range online {
+		city, ok := s.db.cities.get(cityID)
+		if !ok {
+			continue
+		}
+		stats.OnlineCars = append(stats.OnlineCars, models.CityCount{CityID: cityID, City: city.Name, Count: count})
+	}
+	sort.Slice(stats.OnlineCars, func(i, j int) bool { return stats.OnlineCars[i].City < stats.OnlineCars[j].City })
+
+	return stats, nil
+}
@@ -0,0 +1,256 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"city2city/api/models"
+	"city2city/storage"
+	"github.com/google/uuid"
+)
+
+type tripRepo struct {
+	db *db
+}
+
+func NewTripRepo(db *db) storage.ITripRepo {
+	return tripRepo{db: db}
+}
+
+func (t tripRepo) Create(ctx context.Context, trip models.CreateTrip) (string, error) {
+	t.db.mu.Lock()
+	defer t.db.mu.Unlock()
+
+	if err := t.check(trip.FromCityID, trip.ToCityID, trip.DriverID, trip.Price, trip.ScheduledDeparture, trip.ScheduledArrival); err != nil {
+		return "", err
+	}
+
+	t.db.tripNumberSeq++
+	id := uuid.New().String()
+	t.db.trips.insert(id, models.Trip{
+		ID:                 id,
+		TripNumberID:       fmt.Sprintf("T-%d", t.db.tripNumberSeq),
+		FromCityID:         trip.FromCityID,
+		ToCityID:           trip.ToCityID,
+		DriverID:           trip.DriverID,
+		Price:              trip.Price,
+		Status:             models.TripScheduled,
+		ScheduledDeparture: utcTimestamp(trip.ScheduledDeparture),
+		ScheduledArrival:   utcTimestamp(trip.ScheduledArrival),
+		CreatedAt:          timestamp(now()),
+	})
+
+	return id, nil
+}
+
+func (t tripRepo) Get(ctx context.Context, id string, expand models.Expand) (models.Trip, error) {
+	t.db.mu.RLock()
+	defer t.db.mu.RUnlock()
+
+	trip, ok := t.db.trips.get(id)
+	if !ok {
+		return models.Trip{}, notFound("trip")
+	}
+
+	return t.hydrate(trip, expand), nil
+}
+
+func (t tripRepo) GetByNumber(ctx context.Context, number string, expand models.Expand) (models.Trip, error) {
+	t.db.mu.RLock()
+	defer t.db.mu.RUnlock()
+
+	for _, trip := range t.db.trips.rows {
+		if trip.TripNumberID == number {
+			return t.hydrate(trip, expand), nil
+		}
+	}
+
+	return models.Trip{}, notFound("trip")
+}
+
+func (t tripRepo) GetList(ctx context.Context, req models.GetTripListRequest) (models.TripsResponse, error) {
+	t.db.mu.RLock()
+	defer t.db.mu.RUnlock()
+
+	all := t.db.trips.newest(func(trip models.Trip) bool {
+		created := parseTimestamp(trip.CreatedAt)
+		departure := parseTimestamp(trip.ScheduledDeparture)
+		return (req.FromCityID == "" || trip.FromCityID == req.FromCityID) &&
+			(req.ToCityID == "" || trip.ToCityID == req.ToCityID) &&
+			(req.DriverID == "" || trip.DriverID == req.DriverID) &&
+			(req.Status == "" || trip.Status == req.Status) &&
+			(req.MinPrice == nil || trip.Price >= *req.MinPrice) &&
+			(req.MaxPrice == nil || trip.Price <= *req.MaxPrice) &&
+			(req.CreatedFrom.IsZero() || !created.Before(req.CreatedFrom)) &&
+			(req.CreatedTo.IsZero() || created.Before(req.CreatedTo)) &&
+			(req.DepartureFrom.IsZero() || trip.ScheduledDeparture != "" && !departure.Before(req.DepartureFrom)) &&
+			(req.DepartureTo.IsZero() || trip.ScheduledDeparture != "" && !departure.After(req.DepartureTo))
+	})
+	sortRows(all, req.Sort, map[string]func(a, b models.Trip) int{
+		"price": func(a, b models.Trip) int { return a.Price - b.Price },
+		"scheduled_departure": func(a, b models.Trip) int {
+			return compareCreatedAt(a.ScheduledDeparture, b.ScheduledDeparture)
+		},
+		"created_at": func(a, b models.Trip) int { return compareCreatedAt(a.CreatedAt, b.CreatedAt) },
+	})
+
+	trips, next, err := list(all, req.GetListRequest, func(t models.Trip) (string, string) { return t.CreatedAt, t.ID })
+	if err != nil {
+		return models.TripsResponse{}, err
+	}
+
+	for i := range trips {
+		trips[i] = t.hydrate(trips[i], req.Expand)
+	}
+
+	return models.TripsResponse{Trips: trips, Count: count(all, req.GetListRequest), NextCursor: next}, nil
+}
+
+func (t tripRepo) Update(ctx context.Context, trip models.Trip) (string, error) {
+	t.db.mu.Lock()
+	defer t.db.mu.Unlock()
+
+	stored, ok := t.db.trips.get(trip.ID)
+	if !ok {
+		return "", notFound("trip")
+	}
+
+	departure, arrival := utcTimestamp(trip.ScheduledDeparture), utcTimestamp(trip.ScheduledArrival)
+	switch fields, schedule := models.TripEditable(stored.Status); {
+	case !fields:
+		return "", storage.ErrTripFinal
+	case !schedule && (departure != stored.ScheduledDeparture || arrival != stored.ScheduledArrival):
+		return "", storage.ErrTripBoarding
+	}
+
+	if err := t.check(trip.FromCityID, trip.ToCityID, trip.DriverID, trip.Price, trip.ScheduledDeparture, trip.ScheduledArrival); err != nil {
+		return "", err
+	}
+
+	stored.FromCityID = trip.FromCityID
+	stored.ToCityID = trip.ToCityID
+	stored.DriverID = trip.DriverID
+	stored.Price = trip.Price
+	stored.ScheduledDeparture = departure
+	stored.ScheduledArrival = arrival
+	t.db.trips.update(trip.ID, stored)
+
+	return trip.ID, nil
+}
+
+func (t tripRepo) Delete(ctx context.Context, id string) error {
+	t.db.mu.Lock()
+	defer t.db.mu.Unlock()
+
+	if _, ok := t.db.trips.get(id); !ok {
+		return notFound("trip")
+	}
+
+	if t.db.tripCustomers.exists(func(tc models.TripCustomer) bool { return tc.TripID == id }) {
+		return stillReferenced("trips", "trip_customers")
+	}
+
+	t.db.trips.delete(id)
+	// trip_events references trips on delete cascade
+	for _, event := range t.db.tripEvents.newest(func(e models.TripEvent) bool { return e.TripID == id }) {
+		t.db.tripEvents.delete(event.ID)
+	}
+
+	return nil
+}
+
+func (t tripRepo) Transition(ctx context.Context, req models.TripTransition) error {
+	t.db.mu.Lock()
+	defer t.db.mu.Unlock()
+
+	trip, ok := t.db.trips.get(req.TripID)
+	if !ok {
+		return notFound("trip")
+	}
+
+	if !models.CanTransitionTrip(trip.Status, req.Status) {
+		return storage.IllegalTransition(trip.Status, req.Status)
+	}
+
+	at := timestamp(req.At.UTC())
+	switch req.Status {
+	case models.TripInProgress:
+		trip.DepartedAt = at
+	case models.TripCompleted:
+		trip.ArrivedAt = at
+	}
+
+	id := uuid.New().String()
+	t.db.tripEvents.insert(id, models.TripEvent{
+		ID:         id,
+		TripID:     trip.ID,
+		FromStatus: trip.Status,
+		ToStatus:   req.Status,
+		ActorID:    req.ActorID,
+		ActorRole:  req.ActorRole,
+		CreatedAt:  at,
+	})
+
+	trip.Status = req.Status
+	t.db.trips.update(trip.ID, trip)
+
+	return nil
+}
+
+func (t tripRepo) GetEvents(ctx context.Context, tripID string) ([]models.TripEvent, error) {
+	t.db.mu.RLock()
+	defer t.db.mu.RUnlock()
+
+	events := t.db.tripEvents.newest(func(e models.TripEvent) bool { return e.TripID == tripID })
+	slices.Reverse(events)
+
+	return events, nil
+}
+
+func (t tripRepo) check(fromCityID, toCityID, driverID string, price int, departure, arrival string) error {
+	if price < 0 {
+		return checkViolation("trips", "price")
+	}
+	if departure != "" && arrival != "" && !parseTimestamp(arrival).After(parseTimestamp(departure)) {
+		return checkViolation("trips", "scheduled_arrival")
+	}
+	if _, ok := t.db.cities.get(fromCityID); fromCityID != "" && !ok {
+		return foreignKeyViolation("trips", "from_city_id")
+	}
+	if _, ok := t.db.cities.get(toCityID); toCityID != "" && !ok {
+		return foreignKeyViolation("trips", "to_city_id")
+	}
+	if _, ok := t.db.drivers.get(driverID); driverID != "" && !ok {
+		return foreignKeyViolation("trips", "driver_id")
+	}
+	return nil
+}
+
+func (t tripRepo) hydrate(trip models.Trip, expand models.Expand) models.Trip {
+	if expand.Has(models.ExpandFromCity) {
+		trip.FromCityData = t.db.city(trip.FromCityID)
+	}
+	if expand.Has(models.ExpandToCity) {
+		trip.ToCityData = t.db.city(trip.ToCityID)
+	}
+	if expand.Has(models.ExpandDriver) {
+		trip.DriverData = t.db.driver(trip.DriverID)
+	}
+	return trip
+}
+
+// utcTimestamp stores an RFC 3339 time in UTC, as postgres does with a
+// timestamp column, leaving an empty one empty.
+func utcTimestamp(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return value
+	}
+	return timestamp(t.UTC())
+}
@@ -0,0 +1,179 @@
+package memory
+
+import (
+	"context"
+
+	"city2city/api/models"
+	"city2city/storage"
+	"github.com/google/uuid"
+)
+
+type tripCustomerRepo struct {
+	db *db
+}
+
+func NewTripCustomerRepo(db *db) storage.ITripCustomerRepo {
+	return tripCustomerRepo{db: db}
+}
+
+func (c tripCustomerRepo) Create(ctx context.Context, req models.CreateTripCustomer) (string, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	if err := c.reserveSeat(req.TripID, req.CustomerID, ""); err != nil {
+		return "", err
+	}
+
+	id := uuid.New().String()
+	c.db.tripCustomers.insert(id, models.TripCustomer{
+		ID:         id,
+		TripID:     req.TripID,
+		CustomerID: req.CustomerID,
+		CreatedAt:  timestamp(now()),
+	})
+
+	return id, nil
+}
+
+func (c tripCustomerRepo) Get(ctx context.Context, id string, expand models.Expand) (models.TripCustomer, error) {
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+
+	tripCustomer, ok := c.db.tripCustomers.get(id)
+	if !ok {
+		return models.TripCustomer{}, notFound("trip customer")
+	}
+
+	return c.hydrate(tripCustomer, expand), nil
+}
+
+func (c tripCustomerRepo) GetList(ctx context.Context, req models.GetTripCustomerListRequest) (models.TripCustomersResponse, error) {
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+
+	all := c.db.tripCustomers.newest(func(tc models.TripCustomer) bool {
+		return (req.TripID == "" || tc.TripID == req.TripID) &&
+			(req.CustomerID == "" || tc.CustomerID == req.CustomerID) &&
+			(req.Cancelled == nil || (tc.Cancellation != nil) == *req.Cancelled)
+	})
+	sortRows(all, req.Sort, map[string]func(a, b models.TripCustomer) int{
+		"created_at": func(a, b models.TripCustomer) int { return compareCreatedAt(a.CreatedAt, b.CreatedAt) },
+	})
+
+	tripCustomers, next, err := list(all, req.GetListRequest, func(tc models.TripCustomer) (string, string) { return tc.CreatedAt, tc.ID })
+	if err != nil {
+		return models.TripCustomersResponse{}, err
+	}
+
+	for i := range tripCustomers {
+		tripCustomers[i] = c.hydrate(tripCustomers[i], req.Expand)
+	}
+
+	return models.TripCustomersResponse{TripCustomers: tripCustomers, Count: count(all, req.GetListRequest), NextCursor: next}, nil
+}
+
+func (c tripCustomerRepo) Update(ctx context.Context, req models.TripCustomer) (string, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	stored, ok := c.db.tripCustomers.get(req.ID)
+	if !ok {
+		return "", notFound("trip customer")
+	}
+	if stored.Cancellation != nil {
+		return "", storage.ErrCancelled
+	}
+
+	if err := c.reserveSeat(req.TripID, req.CustomerID, req.ID); err != nil {
+		return "", err
+	}
+
+	stored.TripID = req.TripID
+	stored.CustomerID = req.CustomerID
+	c.db.tripCustomers.update(req.ID, stored)
+
+	return req.ID, nil
+}
+
+func (c tripCustomerRepo) Cancel(ctx context.Context, req models.CancelTripCustomer) error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	booking, ok := c.db.tripCustomers.get(req.ID)
+	if !ok {
+		return notFound("trip customer")
+	}
+	if booking.Cancellation != nil {
+		return storage.ErrCancelled
+	}
+	if trip, ok := c.db.trips.get(booking.TripID); ok && !models.TripOpenForBooking(trip.Status) {
+		return storage.ErrTripDeparted
+	}
+
+	booking.Cancellation = &models.Cancellation{
+		CancelledAt: timestamp(req.At.UTC()),
+		ActorID:     req.ActorID,
+		ActorRole:   req.ActorRole,
+		Reason:      req.Reason,
+		Refund:      req.Refund,
+		Penalty:     req.Penalty,
+	}
+	c.db.tripCustomers.update(req.ID, booking)
+
+	return nil
+}
+
+func (c tripCustomerRepo) Delete(ctx context.Context, id string) error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	if !c.db.tripCustomers.delete(id) {
+		return notFound("trip customer")
+	}
+
+	return nil
+}
+
+// reserveSeat applies the same rules as the postgres repo; the store's write
+// lock already serialises concurrent bookings.
+func (c tripCustomerRepo) reserveSeat(tripID, customerID, bookingID string) error {
+	trip, ok := c.db.trips.get(tripID)
+	if !ok {
+		return notFound("trip")
+	}
+	if !models.TripOpenForBooking(trip.Status) {
+		return storage.ErrTripClosed
+	}
+	if _, ok := c.db.customers.get(customerID); !ok {
+		return foreignKeyViolation("trip_customers", "customer_id")
+	}
+
+	seats := models.DefaultCarSeats
+	if cars := c.db.cars.newest(func(car models.Car) bool { return car.DriverID == trip.DriverID }); trip.DriverID != "" && len(cars) > 0 {
+		seats = cars[0].Seats
+	}
+
+	taken := 0
+	for _, tc := range c.db.tripCustomers.rows {
+		if tc.TripID != tripID || tc.ID == bookingID || tc.Cancellation != nil {
+			continue
+		}
+		if tc.CustomerID == customerID {
+			return storage.ErrAlreadyBooked
+		}
+		taken++
+	}
+
+	if taken >= seats {
+		return storage.ErrTripFull
+	}
+
+	return nil
+}
+
+func (c tripCustomerRepo) hydrate(tripCustomer models.TripCustomer, expand models.Expand) models.TripCustomer {
+	if expand.Has(models.ExpandCustomer) {
+		tripCustomer.CustomerData = c.db.customer(tripCustomer.CustomerID)
+	}
+	return tripCustomer
+}
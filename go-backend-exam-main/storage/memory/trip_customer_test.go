@@ -0,0 +1,144 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"city2city/api/models"
+	"city2city/storage"
+)
+
+func TestCreateTripCustomerNeverOverbooks(t *testing.T) {
+	const seats, customers = 3, 20
+
+	store := New()
+	tripID := newTrip(t, store, seats, models.CreateTrip{Price: 1000})
+	ids := newCustomers(t, store, customers)
+
+	errs := make([]error, customers)
+	wg := sync.WaitGroup{}
+	for i, id := range ids {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			_, errs[i] = store.TripCustomer().Create(context.Background(), models.CreateTripCustomer{TripID: tripID, CustomerID: id})
+		}(i, id)
+	}
+	wg.Wait()
+
+	booked, full := 0, 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			booked++
+		case errors.Is(err, storage.ErrTripFull):
+			full++
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+
+	if booked != seats || full != customers-seats {
+		t.Errorf("got %d booked and %d full, want %d and %d", booked, full, seats, customers-seats)
+	}
+}
+
+func TestCancelTripCustomer(t *testing.T) {
+	ctx := context.Background()
+	store := New()
+	tripID := newTrip(t, store, 1, models.CreateTrip{Price: 1000})
+	customers := newCustomers(t, store, 2)
+
+	bookingID := create(t)(store.TripCustomer().Create(ctx, models.CreateTripCustomer{TripID: tripID, CustomerID: customers[0]}))
+
+	at := time.Date(2024, 5, 1, 8, 30, 0, 0, time.FixedZone("UZT", 5*60*60))
+	cancel := models.CancelTripCustomer{ID: bookingID, ActorID: customers[0], ActorRole: "customer", Reason: "plans changed", Refund: 500, Penalty: 500, At: at}
+	if err := store.TripCustomer().Cancel(ctx, cancel); err != nil {
+		t.Fatalf("cancelling: %v", err)
+	}
+
+	booking, err := store.TripCustomer().Get(ctx, bookingID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.Cancellation{CancelledAt: "2024-05-01T03:30:00Z", ActorID: customers[0], ActorRole: "customer", Reason: "plans changed", Refund: 500, Penalty: 500}
+	if booking.Cancellation == nil || *booking.Cancellation != want {
+		t.Errorf("got cancellation %+v, want %+v", booking.Cancellation, want)
+	}
+
+	if err = store.TripCustomer().Cancel(ctx, cancel); !errors.Is(err, storage.ErrCancelled) {
+		t.Errorf("cancelling again: got error %v, want %v", err, storage.ErrCancelled)
+	}
+	if _, err = store.TripCustomer().Update(ctx, models.TripCustomer{ID: bookingID, TripID: tripID, CustomerID: customers[0]}); !errors.Is(err, storage.ErrCancelled) {
+		t.Errorf("updating: got error %v, want %v", err, storage.ErrCancelled)
+	}
+
+	// the seat is free again, for anyone
+	create(t)(store.TripCustomer().Create(ctx, models.CreateTripCustomer{TripID: tripID, CustomerID: customers[1]}))
+
+	cancelled := true
+	list, err := store.TripCustomer().GetList(ctx, models.GetTripCustomerListRequest{GetListRequest: models.GetListRequest{Page: 1, Limit: 10}, TripID: tripID, Cancelled: &cancelled})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.TripCustomers) != 1 || list.TripCustomers[0].ID != bookingID {
+		t.Errorf("got cancelled bookings %+v, want only %s", list.TripCustomers, bookingID)
+	}
+}
+
+func TestCancelTripCustomerAfterDeparture(t *testing.T) {
+	tests := []struct {
+		path []string
+		want error
+	}{
+		{nil, nil},
+		{[]string{models.TripBoarding}, nil},
+		{[]string{models.TripInProgress}, storage.ErrTripDeparted},
+		{[]string{models.TripInProgress, models.TripCompleted}, storage.ErrTripDeparted},
+		{[]string{models.TripCancelled}, storage.ErrTripDeparted},
+	}
+
+	for _, tt := range tests {
+		status := models.TripScheduled
+		if len(tt.path) > 0 {
+			status = tt.path[len(tt.path)-1]
+		}
+
+		t.Run(status, func(t *testing.T) {
+			ctx := context.Background()
+			store := New()
+			tripID := newTrip(t, store, 4, models.CreateTrip{Price: 1000})
+			customerID := newCustomers(t, store, 1)[0]
+			bookingID := create(t)(store.TripCustomer().Create(ctx, models.CreateTripCustomer{TripID: tripID, CustomerID: customerID}))
+
+			for _, next := range tt.path {
+				if err := store.Trip().Transition(ctx, models.TripTransition{TripID: tripID, Status: next, At: time.Now()}); err != nil {
+					t.Fatalf("moving the trip to %s: %v", next, err)
+				}
+			}
+
+			err := store.TripCustomer().Cancel(ctx, models.CancelTripCustomer{ID: bookingID, ActorID: customerID, ActorRole: "customer", At: time.Now()})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got error %v, want %v", err, tt.want)
+			}
+
+			booking, err := store.TripCustomer().Get(ctx, bookingID, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cancelled := booking.Cancellation != nil; cancelled != (tt.want == nil) {
+				t.Errorf("got cancelled %v, want %v", cancelled, tt.want == nil)
+			}
+		})
+	}
+}
+
+func TestCancelTripCustomerUnknown(t *testing.T) {
+	err := New().TripCustomer().Cancel(context.Background(), models.CancelTripCustomer{ID: "3f1f7b8e-52b4-4b7c-9d61-0d1c5c1f5e11", At: time.Now()})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("got error %v, want not found", err)
+	}
+}
@@ -0,0 +1,200 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"city2city/api/models"
+	"city2city/storage"
+)
+
+func TestTripTransition(t *testing.T) {
+	// the statuses a new trip goes through to reach each status
+	paths := map[string][]string{
+		models.TripScheduled:  nil,
+		models.TripBoarding:   {models.TripBoarding},
+		models.TripInProgress: {models.TripInProgress},
+		models.TripCompleted:  {models.TripInProgress, models.TripCompleted},
+		models.TripCancelled:  {models.TripCancelled},
+	}
+
+	tests := []struct {
+		from string
+		to   string
+		ok   bool
+	}{
+		{models.TripScheduled, models.TripScheduled, false},
+		{models.TripScheduled, models.TripBoarding, true},
+		{models.TripScheduled, models.TripInProgress, true},
+		{models.TripScheduled, models.TripCompleted, false},
+		{models.TripScheduled, models.TripCancelled, true},
+		{models.TripBoarding, models.TripScheduled, false},
+		{models.TripBoarding, models.TripBoarding, false},
+		{models.TripBoarding, models.TripInProgress, true},
+		{models.TripBoarding, models.TripCompleted, false},
+		{models.TripBoarding, models.TripCancelled, true},
+		{models.TripInProgress, models.TripScheduled, false},
+		{models.TripInProgress, models.TripBoarding, false},
+		{models.TripInProgress, models.TripInProgress, false},
+		{models.TripInProgress, models.TripCompleted, true},
+		{models.TripInProgress, models.TripCancelled, false},
+		{models.TripCompleted, models.TripScheduled, false},
+		{models.TripCompleted, models.TripBoarding, false},
+		{models.TripCompleted, models.TripInProgress, false},
+		{models.TripCompleted, models.TripCompleted, false},
+		{models.TripCompleted, models.TripCancelled, false},
+		{models.TripCancelled, models.TripScheduled, false},
+		{models.TripCancelled, models.TripBoarding, false},
+		{models.TripCancelled, models.TripInProgress, false},
+		{models.TripCancelled, models.TripCompleted, false},
+		{models.TripCancelled, models.TripCancelled, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+" to "+tt.to, func(t *testing.T) {
+			ctx := context.Background()
+			store := New()
+			tripID := newTrip(t, store, 4, models.CreateTrip{Price: 1000})
+
+			for _, status := range paths[tt.from] {
+				if err := store.Trip().Transition(ctx, models.TripTransition{TripID: tripID, Status: status, At: time.Now()}); err != nil {
+					t.Fatalf("moving the trip to %s: %v", status, err)
+				}
+			}
+
+			err := store.Trip().Transition(ctx, models.TripTransition{TripID: tripID, Status: tt.to, ActorID: "dispatcher", At: time.Now()})
+
+			trip, getErr := store.Trip().Get(ctx, tripID, nil)
+			if getErr != nil {
+				t.Fatal(getErr)
+			}
+			events, getErr := store.Trip().GetEvents(ctx, tripID)
+			if getErr != nil {
+				t.Fatal(getErr)
+			}
+
+			if !tt.ok {
+				if !errors.Is(err, storage.ErrConflict) {
+					t.Fatalf("got error %v, want a conflict", err)
+				}
+				if trip.Status != tt.from || len(events) != len(paths[tt.from]) {
+					t.Errorf("a refused transition changed the trip: status %s, %d events", trip.Status, len(events))
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("got error %v, want none", err)
+			}
+			if trip.Status != tt.to {
+				t.Errorf("got status %s, want %s", trip.Status, tt.to)
+			}
+			last := events[len(events)-1]
+			if last.FromStatus != tt.from || last.ToStatus != tt.to || last.ActorID != "dispatcher" {
+				t.Errorf("got event %+v, want %s to %s by dispatcher", last, tt.from, tt.to)
+			}
+			if tt.to == models.TripInProgress && trip.DepartedAt == "" {
+				t.Error("departed_at is not set")
+			}
+		})
+	}
+}
+
+func TestTripTransitionUnknownTrip(t *testing.T) {
+	err := New().Trip().Transition(context.Background(), models.TripTransition{
+		TripID: "3f1f7b8e-52b4-4b7c-9d61-0d1c5c1f5e11", Status: models.TripBoarding, At: time.Now(),
+	})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("got error %v, want not found", err)
+	}
+}
+
+func TestTripListByDeparture(t *testing.T) {
+	ctx := context.Background()
+	store := New()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	today := newTrip(t, store, 4, models.CreateTrip{Price: 1000, ScheduledDeparture: now.Add(time.Hour).Format(time.RFC3339)})
+	trip, err := store.Trip().Get(ctx, today, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, departure := range []string{now.AddDate(0, 0, 7).Format(time.RFC3339), ""} {
+		create(t)(store.Trip().Create(ctx, models.CreateTrip{
+			FromCityID: trip.FromCityID, ToCityID: trip.ToCityID, DriverID: trip.DriverID, Price: 1000, ScheduledDeparture: departure,
+		}))
+	}
+
+	resp, err := store.Trip().GetList(ctx, models.GetTripListRequest{
+		GetListRequest: models.GetListRequest{Page: 1, Limit: 10},
+		DepartureFrom:  now,
+		DepartureTo:    now.Add(24 * time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Trips) != 1 || resp.Trips[0].ID != today {
+		t.Errorf("got trips %+v, want only %s", resp.Trips, today)
+	}
+}
+
+func TestTripUpdateFollowsStatus(t *testing.T) {
+	departure := time.Now().UTC().Add(2 * time.Hour).Truncate(time.Second)
+
+	tests := []struct {
+		path       []string
+		reschedule error
+		reprice    error
+	}{
+		{nil, nil, nil},
+		{[]string{models.TripBoarding}, storage.ErrTripBoarding, nil},
+		{[]string{models.TripInProgress}, storage.ErrTripFinal, storage.ErrTripFinal},
+		{[]string{models.TripInProgress, models.TripCompleted}, storage.ErrTripFinal, storage.ErrTripFinal},
+		{[]string{models.TripCancelled}, storage.ErrTripFinal, storage.ErrTripFinal},
+	}
+
+	for _, tt := range tests {
+		status := models.TripScheduled
+		if len(tt.path) > 0 {
+			status = tt.path[len(tt.path)-1]
+		}
+
+		t.Run(status, func(t *testing.T) {
+			ctx := context.Background()
+			store := New()
+			tripID := newTrip(t, store, 4, models.CreateTrip{Price: 1000, ScheduledDeparture: departure.Format(time.RFC3339)})
+			for _, next := range tt.path {
+				if err := store.Trip().Transition(ctx, models.TripTransition{TripID: tripID, Status: next, At: time.Now()}); err != nil {
+					t.Fatalf("moving the trip to %s: %v", next, err)
+				}
+			}
+
+			trip, err := store.Trip().Get(ctx, tripID, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rescheduled := trip
+			rescheduled.ScheduledDeparture = departure.Add(time.Hour).Format(time.RFC3339)
+			if _, err = store.Trip().Update(ctx, rescheduled); !errors.Is(err, tt.reschedule) {
+				t.Errorf("rescheduling: got error %v, want %v", err, tt.reschedule)
+			}
+
+			repriced, _ := store.Trip().Get(ctx, tripID, nil)
+			repriced.Price = 1500
+			if _, err = store.Trip().Update(ctx, repriced); !errors.Is(err, tt.reprice) {
+				t.Errorf("repricing: got error %v, want %v", err, tt.reprice)
+			}
+
+			stored, _ := store.Trip().Get(ctx, tripID, nil)
+			if stored.Status != status {
+				t.Errorf("got status %s, want %s", stored.Status, status)
+			}
+			if updated := stored.Price == 1500; updated != (tt.reprice == nil) {
+				t.Errorf("got price %d after repricing", stored.Price)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package memory
+
+import (
+	"context"
+	"maps"
+
+	"city2city/storage"
+)
+
+// WithTx runs fn on a copy of the tables, holding the store's lock
+// throughout, so a transaction never conflicts with another write and is
+// never retried. The copy replaces the tables if fn returns nil and is
+// dropped otherwise, a panic included.
+func (s Store) WithTx(ctx context.Context, fn func(tx storage.IStorage) error) error {
+	if s.db.inTx {
+		return fn(s)
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	tx := s.db.snapshot()
+	defer func() {
+		// like a postgres sequence, the trip number is not rolled back
+		s.db.tripNumberSeq = tx.tripNumberSeq
+	}()
+
+	if err := fn(Store{db: tx}); err != nil {
+		return err
+	}
+
+	s.db.commit(tx)
+	return nil
+}
+
+// snapshot copies the tables for a transaction to work on.
+func (d *db) snapshot() *db {
+	return &db{
+		cities:        d.cities.clone(),
+		customers:     d.customers.clone(),
+		drivers:       d.drivers.clone(),
+		cars:          d.cars.clone(),
+		trips:         d.trips.clone(),
+		tripCustomers: d.tripCustomers.clone(),
+		tripEvents:    d.tripEvents.clone(),
+		admins:        d.admins.clone(),
+		otps:          maps.Clone(d.otps),
+		tripNumberSeq: d.tripNumberSeq,
+		inTx:          true,
+	}
+}
+
+// commit takes the tables of tx.
+func (d *db) commit(tx *db) {
+	d.cities = tx.cities
+	d.customers = tx.customers
+	d.drivers = tx.drivers
+	d.cars = tx.cars
+	d.trips = tx.trips
+	d.tripCustomers = tx.tripCustomers
+	d.tripEvents = tx.tripEvents
+	d.admins = tx.admins
+	d.otps = tx.otps
+}
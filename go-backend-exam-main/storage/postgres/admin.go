@@ -0,0 +1,53 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"city2city/api/models"
+
+	"github.com/google/uuid"
+)
+
+type adminRepo struct {
+	db  querier
+	log *slog.Logger
+}
+
+func NewAdminRepo(db querier, log *slog.Logger) adminRepo {
+	return adminRepo{
+		db:  db,
+		log: log.With(slog.String("entity", "admin")),
+	}
+}
+
+func (a adminRepo) Create(ctx context.Context, admin models.CreateAdmin) (string, error) {
+	uid := uuid.New().String()
+
+	if _, err := a.db.ExecContext(ctx, `INSERT INTO admins (id, login, role, password_hash) VALUES ($1, $2, $3, $4)`,
+		uid, admin.Login, admin.Role, admin.PasswordHash); err != nil {
+		return "", fmt.Errorf("error while inserting admin: %w", logged(ctx, a.log, "create", err))
+	}
+
+	return uid, nil
+}
+
+func (a adminRepo) Get(ctx context.Context, id string) (models.Admin, error) {
+	return a.get(ctx, `WHERE id = $1`, id)
+}
+
+func (a adminRepo) GetByLogin(ctx context.Context, login string) (models.Admin, error) {
+	return a.get(ctx, `WHERE login = $1`, login)
+}
+
+func (a adminRepo) get(ctx context.Context, where string, arg string) (models.Admin, error) {
+	admin := models.Admin{}
+	err := a.db.QueryRowContext(ctx, `SELECT id, login, role, password_hash, created_at FROM admins `+where, arg).
+		Scan(&admin.ID, &admin.Login, &admin.Role, &admin.PasswordHash, &admin.CreatedAt)
+	if err != nil {
+		return models.Admin{}, fmt.Errorf("error while getting admin: %w", logged(ctx, a.log, "get", err))
+	}
+
+	return admin, nil
+}
@@ -1,8 +1,10 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"log/slog"
 
 	"city2city/api/models"
 	"city2city/storage"
@@ -10,157 +12,245 @@ import (
 )
 
 type carRepo struct {
-	db *sql.DB
+	db  querier
+	log *slog.Logger
 }
 
-func NewCarRepo(db *sql.DB) storage.ICarRepo {
-	return carRepo{db: db}
+func NewCarRepo(db querier, log *slog.Logger) storage.ICarRepo {
+	return carRepo{db: db, log: log.With(slog.String("entity", "car"))}
 }
 
-func (c carRepo) Create(car models.CreateCar) (string, error) {
+func (c carRepo) Create(ctx context.Context, car models.CreateCar) (string, error) {
 	uid := uuid.New()
 
-	result, err := c.db.Exec("INSERT INTO cars (id, model, brand, number, driver_id) VALUES ($1, $2, $3, $4, $5)",
+	if car.Seats <= 0 {
+		car.Seats = models.DefaultCarSeats
+	}
+
+	// a car without a driver yet stores NULL, not an empty uuid
+	_, err := c.db.ExecContext(ctx, "INSERT INTO cars (id, model, brand, number, seats, driver_id) VALUES ($1, $2, $3, $4, $5, NULLIF($6::text, '')::uuid)",
 		uid,
 		car.Model,
 		car.Brand,
 		car.Number,
+		car.Seats,
 		car.DriverID,
 	)
 	if err != nil {
-		return "", fmt.Errorf("error while inserting data: %w", err)
-	}
-
-	// LastInsertId ve RowsAffected değerlerini kontrol et
-	lastInsertID, err := result.LastInsertId()
-	if err != nil {
-		return "", fmt.Errorf("error getting LastInsertId: %w", err)
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return "", fmt.Errorf("error getting RowsAffected: %w", err)
+		return "", fmt.Errorf("error while inserting data: %w", logged(ctx, c.log, "create", err))
 	}
 
-	if rowsAffected == 0 {
-		return "", fmt.Errorf("no rows affected")
-	}
-
-	return fmt.Sprintf("Last Insert ID: %d", lastInsertID), nil
+	return uid.String(), nil
 }
 
-func (c carRepo) Get(id string) (models.Car, error) {
-	query := `SELECT * FROM cars WHERE id = $1`
-	row := c.db.QueryRow(query, id)
-	var car models.Car
-	if err := row.Scan(&car.ID, &car.Model, &car.Brand, &car.Number, &car.DriverID, &car.DriverData, &car.CreatedAt); err != nil {
-		return models.Car{}, fmt.Errorf("error getting car: %w", err)
+func (c carRepo) Get(ctx context.Context, id string, expand models.Expand) (models.Car, error) {
+	row := newCarRow(expand)
+	if err := c.db.QueryRowContext(ctx, row.query()+" WHERE c.id = $1", id).Scan(row.dest()...); err != nil {
+		return models.Car{}, fmt.Errorf("error getting car: %w", logged(ctx, c.log, "get", err))
 	}
-	return car, nil
+
+	return row.car(), nil
 }
 
-func (c carRepo) GetList(req models.GetListRequest) (models.CarsResponse, error) {
+func (c carRepo) GetList(ctx context.Context, req models.GetCarListRequest) (models.CarsResponse, error) {
 	var (
 		cars  = []models.Car{}
 		count int
+		f     = filter{}
 	)
 
+	if req.Search != "" {
+		f.add(`(c.model ILIKE ? OR c.number ILIKE ?)`, likePattern(req.Search))
+	}
+	if req.Status != nil {
+		f.add(`c.status = ?`, *req.Status)
+	}
+	if req.Brand != "" {
+		f.add(`lower(c.brand) = lower(?)`, req.Brand)
+	}
+	if req.DriverID != "" {
+		f.add(`c.driver_id = ?`, req.DriverID)
+	}
+	if req.FromCityID != "" {
+		f.add(`c.from_city_id = ?`, req.FromCityID)
+	}
+	if req.ToCityID != "" {
+		f.add(`c.to_city_id = ?`, req.ToCityID)
+	}
+	if !req.DepartureFrom.IsZero() {
+		f.add(`c.departure_time >= ?`, req.DepartureFrom.UTC())
+	}
+	if !req.DepartureTo.IsZero() {
+		f.add(`c.departure_time <= ?`, req.DepartureTo.UTC())
+	}
+
 	// Count query
-	countQuery := `SELECT COUNT(*) FROM cars`
-	if err := c.db.QueryRow(countQuery).Scan(&count); err != nil {
-		return models.CarsResponse{}, fmt.Errorf("error getting car count: %w", err)
+	if req.NeedsCount() {
+		countQuery := `SELECT COUNT(*) FROM cars c` + f.where()
+		if err := c.db.QueryRowContext(ctx, countQuery, f.args...).Scan(&count); err != nil {
+			return models.CarsResponse{}, fmt.Errorf("error getting car count: %w", logged(ctx, c.log, "get_list", err))
+		}
 	}
 
 	// Data query
-	query := `SELECT c.id, c.model, c.brand, c.number, c.driver_id, c.created_at,
-	                 d.id as driver_id, d.full_name, d.phone,
-	                 d.from_city_id as driver_from_city_id,
-	                 d.to_city_id as driver_to_city_id,
-	                 d.created_at as driver_created_at
-              FROM cars c
-              LEFT JOIN drivers d ON c.driver_id = d.id
-              ORDER BY c.created_at DESC
-              LIMIT $1 OFFSET $2`
-
-	rows, err := c.db.Query(query, req.Limit, (req.Page-1)*req.Limit)
+	row := newCarRow(req.Expand)
+	where, tail, args := f.list(req.GetListRequest, "c", models.CarSortFields)
+	query := row.query() + where + tail
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return models.CarsResponse{}, fmt.Errorf("error getting car list: %w", err)
+		return models.CarsResponse{}, fmt.Errorf("error getting car list: %w", logged(ctx, c.log, "get_list", err))
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var car models.Car
-		var driver models.Driver
-		if err := rows.Scan(&car.ID, &car.Model, &car.Brand, &car.Number, &car.DriverID, &car.CreatedAt,
-			&driver.ID, &driver.FullName, &driver.Phone, &driver.FromCityID, &driver.ToCityID, &driver.CreatedAt); err != nil {
-			return models.CarsResponse{}, fmt.Errorf("error scanning car row: %w", err)
+		if err := rows.Scan(row.dest()...); err != nil {
+			return models.CarsResponse{}, fmt.Errorf("error scanning car row: %w", logged(ctx, c.log, "get_list", err))
 		}
-		car.DriverData = models.Driver{
-			ID:           driver.ID,
-			FullName:     driver.FullName,
-			Phone:        driver.Phone,
-			FromCityID:   driver.FromCityID,
-			FromCityData: models.City{ID: driver.FromCityID}, // Bu kısmı veritabanınıza uygun şekilde doldurun
-			ToCityID:     driver.ToCityID,
-			ToCityData:   models.City{ID: driver.ToCityID}, // Bu kısmı veritabanınıza uygun şekilde doldurun
-			CreatedAt:    driver.CreatedAt,
-		}
-		cars = append(cars, car)
+		cars = append(cars, row.car())
+	}
+
+	if err := rows.Err(); err != nil {
+		return models.CarsResponse{}, fmt.Errorf("error iterating cars: %w", logged(ctx, c.log, "get_list", err))
+	}
+
+	resp := models.CarsResponse{Cars: cars, Count: count}
+	if req.CursorMode {
+		resp.Cars, resp.NextCursor = models.NextCursor(cars, req.Limit, func(c models.Car) (string, string) { return c.CreatedAt, c.ID })
 	}
 
-	return models.CarsResponse{
-		Cars:  cars,
-		Count: count,
-	}, nil
+	return resp, nil
 }
 
-func (c carRepo) Update(car models.Car) (string, error) {
+func (c carRepo) Update(ctx context.Context, car models.Car) (string, error) {
 	query := `UPDATE cars
 		              SET model = $1,
 		                  brand = $2,
-		                  number = $3
-		                  WHERE id = $4 `
-	result, err := c.db.Exec(query, car.Model, car.Brand, car.Number, car.ID)
+		                  number = $3,
+		                  seats = COALESCE(NULLIF($4, 0), seats)
+		                  WHERE id = $5 `
+	result, err := c.db.ExecContext(ctx, query, car.Model, car.Brand, car.Number, car.Seats, car.ID)
 	if err != nil {
-		return "", fmt.Errorf("error updating car: %w", err)
+		return "", fmt.Errorf("error updating car: %w", logged(ctx, c.log, "update", err))
 	}
 
 	affectedRows, err := result.RowsAffected()
 	if err != nil {
-		return "", fmt.Errorf("error getting affected rows: %w", err)
+		return "", fmt.Errorf("error getting affected rows: %w", logged(ctx, c.log, "update", err))
 	}
 
 	if affectedRows == 0 {
-		return "", fmt.Errorf("no rows affected")
+		return "", storage.NotFound("car")
 	}
 
 	return car.ID, nil
 }
 
-func (c carRepo) Delete(id string) error {
+func (c carRepo) Delete(ctx context.Context, id string) error {
 	query := `DELETE FROM cars WHERE id = $1`
-	result, err := c.db.Exec(query, id)
+	result, err := c.db.ExecContext(ctx, query, id)
 	if err != nil {
-		return fmt.Errorf("error deleting car: %w", err)
+		return fmt.Errorf("error deleting car: %w", logged(ctx, c.log, "delete", err))
 	}
 
 	affectedRows, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("error getting affected rows: %w", err)
+		return fmt.Errorf("error getting affected rows: %w", logged(ctx, c.log, "delete", err))
 	}
 
 	if affectedRows == 0 {
-		return fmt.Errorf("no rows affected")
+		return storage.NotFound("car")
 	}
 
 	return nil
 }
 
-func (c carRepo) UpdateCarRoute(models.UpdateCarRoute) error {
+func (c carRepo) UpdateCarRoute(ctx context.Context, updateCarRoute models.UpdateCarRoute) error {
+	query := `UPDATE cars
+	             SET from_city_id = $1,
+	                 to_city_id = $2,
+	                 departure_time = $3
+	           WHERE id = $4`
+	// departure_time has no time zone: it holds UTC, as the memory store does
+	result, err := c.db.ExecContext(ctx, query, updateCarRoute.FromCityID, updateCarRoute.ToCityID,
+		updateCarRoute.DepartureTime.UTC(), updateCarRoute.CarID)
+	if err != nil {
+		return fmt.Errorf("error updating car route: %w", logged(ctx, c.log, "update_car_route", err))
+	}
+
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting affected rows: %w", logged(ctx, c.log, "update_car_route", err))
+	}
+
+	if affectedRows == 0 {
+		return storage.NotFound("car")
+	}
 
 	return nil
 }
-func (c carRepo) UpdateCarStatus(updateCarStatus models.UpdateCarStatus) error {
+
+func (c carRepo) UpdateCarStatus(ctx context.Context, updateCarStatus models.UpdateCarStatus) error {
+	result, err := c.db.ExecContext(ctx, `UPDATE cars SET status = $1 WHERE id = $2`, updateCarStatus.Status, updateCarStatus.ID)
+	if err != nil {
+		return fmt.Errorf("error updating car status: %w", logged(ctx, c.log, "update_car_status", err))
+	}
+
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting affected rows: %w", logged(ctx, c.log, "update_car_status", err))
+	}
+
+	if affectedRows == 0 {
+		return storage.NotFound("car")
+	}
 
 	return nil
 }
+
+// carRow builds the car SELECT, joining the driver when it is expanded.
+type carRow struct {
+	expand                                        models.Expand
+	c                                             models.Car
+	driverID, fromCityID, toCityID, departureTime sql.NullString
+	driver                                        nullDriver
+}
+
+func newCarRow(expand models.Expand) *carRow {
+	return &carRow{expand: expand}
+}
+
+func (r *carRow) query() string {
+	query := `SELECT c.id, c.model, c.brand, c.number, c.status, c.seats, c.driver_id,
+	                 c.from_city_id, c.to_city_id, c.departure_time, c.created_at`
+	joins := ""
+
+	if r.expand.Has(models.ExpandDriver) {
+		query += ", " + driverColumns("d")
+		joins += " LEFT JOIN drivers d ON d.id = c.driver_id"
+	}
+
+	return query + " FROM cars c" + joins
+}
+
+func (r *carRow) dest() []interface{} {
+	dest := []interface{}{&r.c.ID, &r.c.Model, &r.c.Brand, &r.c.Number, &r.c.Status, &r.c.Seats, &r.driverID,
+		&r.fromCityID, &r.toCityID, &r.departureTime, &r.c.CreatedAt}
+
+	if r.expand.Has(models.ExpandDriver) {
+		dest = append(dest, r.driver.dest()...)
+	}
+
+	return dest
+}
+
+func (r *carRow) car() models.Car {
+	car := r.c
+	car.DriverID = r.driverID.String
+	car.FromCityID = r.fromCityID.String
+	car.ToCityID = r.toCityID.String
+	car.DepartureTime = r.departureTime.String
+	car.DriverData = r.driver.driver()
+
+	return car
+}
@@ -1,9 +1,9 @@
 package postgres
 
 import (
-	"database/sql"
-	"errors"
+	"context"
 	"fmt"
+	"log/slog"
 
 	"city2city/api/models"
 	"city2city/storage"
@@ -11,62 +11,51 @@ import (
 )
 
 type cityRepo struct {
-	db *sql.DB
+	db  querier
+	log *slog.Logger
 }
 
-func NewCityRepo(db *sql.DB) storage.ICityRepo {
-	return cityRepo{db: db}
+func NewCityRepo(db querier, log *slog.Logger) storage.ICityRepo {
+	return cityRepo{db: db, log: log.With(slog.String("entity", "city"))}
 }
 
-func (c cityRepo) Create(city models.CreateCity) (string, error) {
+func (c cityRepo) Create(ctx context.Context, city models.CreateCity) (string, error) {
 	// Generate a new UUID
 	cityID := uuid.New().String()
 
 	// Prepare the SQL query with a placeholder for the UUID
 	query := `INSERT INTO cities (id, name) VALUES ($1, $2) RETURNING id`
 
-	// Execute the query, passing the generated UUID as a parameter
-	rows, err := c.db.Query(query, cityID, city.Name)
-	if err != nil {
-		return "", err
-	}
-	defer rows.Close()
-
-	// No need to scan for the ID as it's already generated and returned
-	if !rows.Next() {
-		if err := rows.Err(); err != nil {
-			return "", err
-		}
-		return "", errors.New("failed to create city")
+	if err := c.db.QueryRowContext(ctx, query, cityID, city.Name).Scan(&cityID); err != nil {
+		return "", fmt.Errorf("failed to create city: %w", logged(ctx, c.log, "create", err))
 	}
 
 	return cityID, nil
 }
 
-func (c cityRepo) Get(id string) (models.City, error) {
+func (c cityRepo) Get(ctx context.Context, id string) (models.City, error) {
 	var city models.City
-	err := c.db.QueryRow("SELECT id, name, created_at FROM cities WHERE id = $1", id).Scan(&city.ID, &city.Name, &city.CreatedAt)
+	err := c.db.QueryRowContext(ctx, "SELECT id, name, created_at FROM cities WHERE id = $1", id).Scan(&city.ID, &city.Name, &city.CreatedAt)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			fmt.Println("error while getting city", err.Error())
-			return models.City{}, err
-		}
-		return models.City{}, err
+		return models.City{}, logged(ctx, c.log, "get", err)
 	}
 
 	return city, nil
 }
 
-func (c cityRepo) GetList(req models.GetListRequest) (models.CitiesResponse, error) {
-	limit := req.Limit
-	offset := (req.Page - 1) * limit
+func (c cityRepo) GetList(ctx context.Context, req models.GetCityListRequest) (models.CitiesResponse, error) {
+	f := filter{}
+	if req.Search != "" {
+		f.add(`c.name ILIKE ?`, likePattern(req.Search))
+	}
 
-	rows, err := c.db.Query(
-		`SELECT id, name, created_at FROM cities ORDER BY created_at DESC LIMIT $1 OFFSET $2`,
-		limit, offset,
+	where, tail, args := f.list(req.GetListRequest, "c", models.CitySortFields)
+	rows, err := c.db.QueryContext(ctx,
+		`SELECT c.id, c.name, c.created_at FROM cities c`+where+tail,
+		args...,
 	)
 	if err != nil {
-		return models.CitiesResponse{}, err
+		return models.CitiesResponse{}, logged(ctx, c.log, "get_list", err)
 	}
 	defer rows.Close()
 
@@ -75,62 +64,70 @@ func (c cityRepo) GetList(req models.GetListRequest) (models.CitiesResponse, err
 		var city models.City
 		err := rows.Scan(&city.ID, &city.Name, &city.CreatedAt)
 		if err != nil {
-			return models.CitiesResponse{}, err
+			return models.CitiesResponse{}, logged(ctx, c.log, "get_list", err)
 		}
 		cities = append(cities, city)
 	}
 
-	count, err := c.countCities()
-	if err != nil {
-		return models.CitiesResponse{}, err
+	if err := rows.Err(); err != nil {
+		return models.CitiesResponse{}, logged(ctx, c.log, "get_list", err)
+	}
+
+	resp := models.CitiesResponse{Cities: cities}
+	if req.CursorMode {
+		resp.Cities, resp.NextCursor = models.NextCursor(cities, req.Limit, func(c models.City) (string, string) { return c.CreatedAt, c.ID })
+	}
+
+	if req.NeedsCount() {
+		if resp.Count, err = c.countCities(ctx, f); err != nil {
+			return models.CitiesResponse{}, logged(ctx, c.log, "get_list", err)
+		}
 	}
 
-	return models.CitiesResponse{Cities: cities, Count: count}, nil
+	return resp, nil
 }
 
-func (c cityRepo) Update(city models.City) (string, error) {
-	result, err := c.db.Exec("UPDATE cities SET name = $1 WHERE id = $2", city.Name, city.ID)
+func (c cityRepo) Update(ctx context.Context, city models.City) (string, error) {
+	result, err := c.db.ExecContext(ctx, "UPDATE cities SET name = $1 WHERE id = $2", city.Name, city.ID)
 	if err != nil {
-		return "", err
+		return "", logged(ctx, c.log, "update", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return "", err
+		return "", logged(ctx, c.log, "update", err)
 	}
 
 	if rowsAffected == 0 {
-		fmt.Println("error while updating city", err.Error())
-		return "", err
+		return "", storage.NotFound("city")
 	}
 
 	return city.ID, nil
 }
 
-func (c cityRepo) Delete(id string) error {
-	result, err := c.db.Exec("DELETE FROM cities WHERE id = $1", id)
+func (c cityRepo) Delete(ctx context.Context, id string) error {
+	result, err := c.db.ExecContext(ctx, "DELETE FROM cities WHERE id = $1", id)
 	if err != nil {
-		fmt.Println("error while deleting city", err.Error())
-		return err
+		return logged(ctx, c.log, "delete", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return err
+		return logged(ctx, c.log, "delete", err)
 	}
 
 	if rowsAffected == 0 {
-		return sql.ErrNoRows
+		return storage.NotFound("city")
 	}
 
 	return nil
 }
 
-func (c cityRepo) countCities() (int, error) {
+func (c cityRepo) countCities(ctx context.Context, f filter) (int, error) {
 	var count int
-	err := c.db.QueryRow("SELECT COUNT(*) FROM cities").Scan(&count)
+	err := c.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM cities c"+f.where(), f.args...).Scan(&count)
 	if err != nil {
-		return 0, err
+		return 0, logged(ctx, c.log, "count_cities", err)
 	}
 	return count, nil
 }
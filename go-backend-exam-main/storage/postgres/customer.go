@@ -1,65 +1,87 @@
 package postgres
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
+	"log/slog"
 
 	"city2city/api/models"
+	"city2city/storage"
 	"github.com/google/uuid"
 )
 
 type customerRepo struct {
-	db *sql.DB
+	db  querier
+	log *slog.Logger
 }
 
-func NewCustomerRepo(db *sql.DB) customerRepo {
+func NewCustomerRepo(db querier, log *slog.Logger) customerRepo {
 	return customerRepo{
-		db: db,
+		db:  db,
+		log: log.With(slog.String("entity", "customer")),
 	}
 }
 
-func (c customerRepo) Create(customer models.CreateCustomer) (string, error) {
+func (c customerRepo) Create(ctx context.Context, customer models.CreateCustomer) (string, error) {
 	uid := uuid.New().String()
 
-	if _, err := c.db.Exec("INSERT INTO customers (id, full_name, phone, email) VALUES ($1, $2, $3, $4)",
+	if _, err := c.db.ExecContext(ctx, "INSERT INTO customers (id, full_name, phone, email) VALUES ($1, $2, $3, $4)",
 		uid,
 		customer.FullName,
 		customer.Phone,
 		customer.Email,
 	); err != nil {
-		fmt.Println("error while inserting data ", err.Error())
-		return "", err
+		return "", logged(ctx, c.log, "create", err)
 	}
-	return "", nil
+	return uid, nil
 }
 
-func (c customerRepo) Get(id string) (models.Customer, error) {
+func (c customerRepo) Get(ctx context.Context, id string) (models.Customer, error) {
 	query := `
         SELECT id, full_name, phone, email, created_at
         FROM customers
         WHERE id = $1
     `
 
-	row := c.db.QueryRow(query, id)
+	row := c.db.QueryRowContext(ctx, query, id)
 	var customer models.Customer
 	if err := row.Scan(&customer.ID, &customer.FullName, &customer.Phone, &customer.Email, &customer.CreatedAt); err != nil {
-		return models.Customer{}, fmt.Errorf("error getting customer: %w", err)
+		return models.Customer{}, fmt.Errorf("error getting customer: %w", logged(ctx, c.log, "get", err))
 	}
 
 	return customer, nil
 }
 
-func (c customerRepo) GetList(req models.GetListRequest) (models.CustomersResponse, error) {
+func (c customerRepo) GetByPhone(ctx context.Context, phone string) (models.Customer, error) {
 	query := `
         SELECT id, full_name, phone, email, created_at
         FROM customers
-        ORDER BY created_at DESC
-        LIMIT $1 OFFSET $2
+        WHERE phone = $1
     `
 
-	rows, err := c.db.Query(query, req.Limit, (req.Page-1)*req.Limit)
+	row := c.db.QueryRowContext(ctx, query, phone)
+	var customer models.Customer
+	if err := row.Scan(&customer.ID, &customer.FullName, &customer.Phone, &customer.Email, &customer.CreatedAt); err != nil {
+		return models.Customer{}, fmt.Errorf("error getting customer by phone: %w", logged(ctx, c.log, "get_by_phone", err))
+	}
+
+	return customer, nil
+}
+
+func (c customerRepo) GetList(ctx context.Context, req models.GetCustomerListRequest) (models.CustomersResponse, error) {
+	f := filter{}
+	if req.Search != "" {
+		f.add(`(c.full_name ILIKE ? OR c.phone ILIKE ?)`, likePattern(req.Search))
+	}
+
+	where, tail, args := f.list(req.GetListRequest, "c", models.CustomerSortFields)
+	query := `
+        SELECT c.id, c.full_name, c.phone, c.email, c.created_at
+        FROM customers c` + where + tail
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return models.CustomersResponse{}, fmt.Errorf("error getting customer list: %w", err)
+		return models.CustomersResponse{}, fmt.Errorf("error getting customer list: %w", logged(ctx, c.log, "get_list", err))
 	}
 	defer rows.Close()
 
@@ -67,28 +89,31 @@ func (c customerRepo) GetList(req models.GetListRequest) (models.CustomersRespon
 	for rows.Next() {
 		var customer models.Customer
 		if err := rows.Scan(&customer.ID, &customer.FullName, &customer.Phone, &customer.Email, &customer.CreatedAt); err != nil {
-			return models.CustomersResponse{}, fmt.Errorf("error scanning customer: %w", err)
+			return models.CustomersResponse{}, fmt.Errorf("error scanning customer: %w", logged(ctx, c.log, "get_list", err))
 		}
 		customers = append(customers, customer)
 	}
 
 	if err := rows.Err(); err != nil {
-		return models.CustomersResponse{}, fmt.Errorf("error iterating customers: %w", err)
+		return models.CustomersResponse{}, fmt.Errorf("error iterating customers: %w", logged(ctx, c.log, "get_list", err))
+	}
+
+	resp := models.CustomersResponse{Customers: customers}
+	if req.CursorMode {
+		resp.Customers, resp.NextCursor = models.NextCursor(customers, req.Limit, func(c models.Customer) (string, string) { return c.CreatedAt, c.ID })
 	}
 
-	countQuery := `SELECT COUNT(*) FROM customers`
-	var count int
-	if err := c.db.QueryRow(countQuery).Scan(&count); err != nil {
-		return models.CustomersResponse{}, fmt.Errorf("error getting customer count: %w", err)
+	if req.NeedsCount() {
+		countQuery := `SELECT COUNT(*) FROM customers c` + f.where()
+		if err := c.db.QueryRowContext(ctx, countQuery, f.args...).Scan(&resp.Count); err != nil {
+			return models.CustomersResponse{}, fmt.Errorf("error getting customer count: %w", logged(ctx, c.log, "get_list", err))
+		}
 	}
 
-	return models.CustomersResponse{
-		Customers: customers,
-		Count:     count,
-	}, nil
+	return resp, nil
 }
 
-func (c customerRepo) Update(customer models.Customer) (string, error) {
+func (c customerRepo) Update(ctx context.Context, customer models.Customer) (string, error) {
 	query := `
         UPDATE customers
         SET full_name = $2, phone = $3, email = $4
@@ -96,23 +121,30 @@ func (c customerRepo) Update(customer models.Customer) (string, error) {
         RETURNING id
     `
 
-	row := c.db.QueryRow(query, customer.ID, customer.FullName, customer.Phone, customer.Email)
+	row := c.db.QueryRowContext(ctx, query, customer.ID, customer.FullName, customer.Phone, customer.Email)
 	var id string
 	if err := row.Scan(&id); err != nil {
-		return "", fmt.Errorf("error updating customer: %w", err)
+		return "", fmt.Errorf("error updating customer: %w", logged(ctx, c.log, "update", err))
 	}
 
 	return id, nil
 }
 
-func (c customerRepo) Delete(id string) error {
+func (c customerRepo) Delete(ctx context.Context, id string) error {
 	query := `
         DELETE FROM customers
         WHERE id = $1
     `
 
-	if _, err := c.db.Exec(query, id); err != nil {
-		return fmt.Errorf("error deleting customer: %w", err)
+	result, err := c.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("error deleting customer: %w", logged(ctx, c.log, "delete", err))
+	}
+
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("error getting affected rows: %w", logged(ctx, c.log, "delete", err))
+	} else if n == 0 {
+		return storage.NotFound("customer")
 	}
 
 	return nil
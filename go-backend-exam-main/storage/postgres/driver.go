@@ -1,149 +1,318 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"log/slog"
 
 	"city2city/api/models"
+	"city2city/storage"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type driverRepo struct {
-	db *sql.DB
+	db  querier
+	log *slog.Logger
 }
 
-func NewDriverRepo(db *sql.DB) driverRepo {
+func NewDriverRepo(db querier, log *slog.Logger) driverRepo {
 	return driverRepo{
-		db: db,
+		db:  db,
+		log: log.With(slog.String("entity", "driver")),
 	}
 }
 
-func (d driverRepo) Create(driver models.CreateDriver) (string, error) {
+func (d driverRepo) Create(ctx context.Context, driver models.CreateDriver) (string, error) {
 	uid := uuid.New().String()
 
-	if _, err := d.db.Exec("INSERT INTO drivers (id, full_name, phone, from_city_id,to_city_id) VALUES ($1, $2, $3, $4, $5)",
+	if _, err := d.db.ExecContext(ctx, "INSERT INTO drivers (id, full_name, phone, from_city_id,to_city_id) VALUES ($1, $2, $3, $4, $5)",
 		uid,
 		driver.FullName,
 		driver.Phone,
 		driver.FromCityID,
 		driver.ToCityID); err != nil {
-		fmt.Println("error while inserting data drivers...", err.Error())
-		return "", err
+		return "", logged(ctx, d.log, "create", err)
 	}
 
-	return "", nil
+	return uid, nil
 }
 
-func (d driverRepo) Get(id string) (models.Driver, error) {
-	stmt, err := d.db.Prepare("SELECT * FROM drivers WHERE id = $1")
+func (d driverRepo) Get(ctx context.Context, id string, expand models.Expand) (models.Driver, error) {
+	row := newDriverRow(expand)
+	err := d.db.QueryRowContext(ctx, row.query()+" WHERE d.id = $1", id).Scan(row.dest()...)
 	if err != nil {
-		return models.Driver{}, err
+		return models.Driver{}, logged(ctx, d.log, "get", err)
 	}
-	defer stmt.Close()
 
-	row := stmt.QueryRow(id)
+	return row.driver(), nil
+}
 
-	var driver models.Driver
-	err = row.Scan(&driver.ID, &driver.FullName, &driver.Phone, &driver.FromCityID, &driver.ToCityID, &driver.CreatedAt)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			fmt.Println("error while getting data", err.Error())
-			return models.Driver{}, err
-		} else {
-			return models.Driver{}, err
-		}
+func (d driverRepo) GetByPhone(ctx context.Context, phone string) (models.Driver, error) {
+	row := newDriverRow(models.Expand{})
+	if err := d.db.QueryRowContext(ctx, row.query()+" WHERE d.phone = $1", phone).Scan(row.dest()...); err != nil {
+		return models.Driver{}, fmt.Errorf("error while getting driver by phone: %w", logged(ctx, d.log, "get_by_phone", err))
 	}
 
-	return driver, nil
+	return row.driver(), nil
 }
 
-func (d driverRepo) GetList(req models.GetListRequest) (models.DriversResponse, error) {
+func (d driverRepo) GetList(ctx context.Context, req models.GetDriverListRequest) (models.DriversResponse, error) {
 	var (
 		drivers           = []models.Driver{}
 		count             = 0
 		countQuery, query string
-		page              = req.Page
-		offset            = (page - 1) * req.Limit
+		row               = newDriverRow(req.Expand)
+		f                 = filter{}
 	)
 
-	countQuery = `
- SELECT count(1) from drivers `
+	if req.Search != "" {
+		f.add(`(d.full_name ILIKE ? OR d.phone ILIKE ?)`, likePattern(req.Search))
+	}
+	if req.FromCityID != "" {
+		f.add(`d.from_city_id = ?`, req.FromCityID)
+	}
+	if req.ToCityID != "" {
+		f.add(`d.to_city_id = ?`, req.ToCityID)
+	}
+
+	if req.NeedsCount() {
+		countQuery = `
+ SELECT count(1) from drivers d` + f.where()
+
+		if err := d.db.QueryRowContext(ctx, countQuery, f.args...).Scan(&count); err != nil {
+			return models.DriversResponse{}, logged(ctx, d.log, "get_list", err)
+		}
+	}
+
+	where, tail, args := f.list(req.GetListRequest, "d", models.DriverSortFields)
+	query = row.query() + where + tail
+
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return models.DriversResponse{}, logged(ctx, d.log, "get_list", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = rows.Scan(row.dest()...); err != nil {
+			return models.DriversResponse{}, logged(ctx, d.log, "get_list", err)
+		}
+
+		drivers = append(drivers, row.driver())
+	}
 
-	if err := d.db.QueryRow(countQuery).Scan(&count); err != nil {
-		fmt.Println("error while scanning count of drivers", err.Error())
-		return models.DriversResponse{}, err
+	if err = rows.Err(); err != nil {
+		return models.DriversResponse{}, logged(ctx, d.log, "get_list", err)
 	}
 
-	query = `
- SELECT id, full_name, phone, from_city_id, to_city_id, created_at
-  FROM drivers
-      `
+	resp := models.DriversResponse{Drivers: drivers, Count: count}
+	if req.CursorMode {
+		resp.Drivers, resp.NextCursor = models.NextCursor(drivers, req.Limit, func(d models.Driver) (string, string) { return d.CreatedAt, d.ID })
+	}
 
-	query += fmt.Sprintf("LIMIT %d OFFSET %d", req.Limit, offset)
+	return resp, nil
+}
 
-	rows, err := d.db.Query(query)
+// GetFull loads the driver with cities, their car, and their trips in the
+// requested range together with every trip's booked customers. It runs a
+// fixed number of queries regardless of how many trips the driver has.
+func (d driverRepo) GetFull(ctx context.Context, req models.GetDriverFullRequest) (models.DriverFull, error) {
+	driver, err := d.Get(ctx, req.ID, nil)
 	if err != nil {
-		fmt.Println("error while query rows", err.Error())
-		return models.DriversResponse{}, err
+		return models.DriverFull{}, err
+	}
+
+	full := models.DriverFull{
+		Driver: driver,
+		Trips:  []models.DriverTrip{},
+	}
+
+	carRow := newCarRow(models.Expand{})
+	err = d.db.QueryRowContext(ctx, carRow.query()+" WHERE c.driver_id = $1 ORDER BY c.created_at DESC LIMIT 1", req.ID).Scan(carRow.dest()...)
+	switch {
+	case err == nil:
+		car := carRow.car()
+		full.Car = &car
+	case err != sql.ErrNoRows:
+		return models.DriverFull{}, fmt.Errorf("error while getting driver car: %w", logged(ctx, d.log, "get_full", err))
 	}
 
+	var from, to sql.NullTime
+	if !req.From.IsZero() {
+		from = sql.NullTime{Time: req.From.UTC(), Valid: true}
+	}
+	if !req.To.IsZero() {
+		to = sql.NullTime{Time: req.To.UTC(), Valid: true}
+	}
+
+	// the schedule goes by when trips run, as models.Trip.Date does
+	tripRow := newTripRow(models.Expand{models.ExpandFromCity: true, models.ExpandToCity: true})
+	rows, err := d.db.QueryContext(ctx, tripRow.query()+`
+  WHERE t.driver_id = $1
+    AND ($2::timestamp IS NULL OR COALESCE(t.scheduled_departure, t.created_at) >= $2)
+    AND ($3::timestamp IS NULL OR COALESCE(t.scheduled_departure, t.created_at) < $3)
+  ORDER BY COALESCE(t.scheduled_departure, t.created_at), t.created_at`, req.ID, from, to)
+	if err != nil {
+		return models.DriverFull{}, fmt.Errorf("error while getting driver trips: %w", logged(ctx, d.log, "get_full", err))
+	}
+	defer rows.Close()
+
+	var (
+		tripIDs   []string
+		tripIndex = map[string]int{}
+	)
 	for rows.Next() {
-		driver := models.Driver{}
+		if err = rows.Scan(tripRow.dest()...); err != nil {
+			return models.DriverFull{}, fmt.Errorf("error while scanning driver trip: %w", logged(ctx, d.log, "get_full", err))
+		}
+
+		trip := tripRow.trip()
+		tripIndex[trip.ID] = len(full.Trips)
+		tripIDs = append(tripIDs, trip.ID)
+		full.Trips = append(full.Trips, models.DriverTrip{
+			Trip:      trip,
+			Date:      trip.Date(),
+			Customers: []models.Customer{},
+		})
+	}
+	if err = rows.Err(); err != nil {
+		return models.DriverFull{}, fmt.Errorf("error while iterating driver trips: %w", logged(ctx, d.log, "get_full", err))
+	}
+
+	if len(tripIDs) == 0 {
+		return full, nil
+	}
+
+	customer := nullCustomer{}
+	var tripID string
+	customerRows, err := d.db.QueryContext(ctx, `
+ SELECT tc.trip_id, `+customerColumns("cu")+`
+  FROM trip_customers tc
+  JOIN customers cu ON cu.id = tc.customer_id
+  WHERE tc.trip_id = ANY($1) AND tc.cancelled_at IS NULL
+  ORDER BY tc.created_at`, pq.Array(tripIDs))
+	if err != nil {
+		return models.DriverFull{}, fmt.Errorf("error while getting trip customers: %w", logged(ctx, d.log, "get_full", err))
+	}
+	defer customerRows.Close()
 
-		if err = rows.Scan(&driver.ID, &driver.FullName, &driver.Phone, &driver.FromCityID, &driver.ToCityID, &driver.CreatedAt); err != nil {
-			fmt.Println("error while scanning row", err.Error())
-			return models.DriversResponse{}, err
+	for customerRows.Next() {
+		if err = customerRows.Scan(append([]interface{}{&tripID}, customer.dest()...)...); err != nil {
+			return models.DriverFull{}, fmt.Errorf("error while scanning trip customer: %w", logged(ctx, d.log, "get_full", err))
 		}
 
-		drivers = append(drivers, driver)
+		i := tripIndex[tripID]
+		full.Trips[i].Customers = append(full.Trips[i].Customers, customer.customer())
+	}
+	if err = customerRows.Err(); err != nil {
+		return models.DriverFull{}, fmt.Errorf("error while iterating trip customers: %w", logged(ctx, d.log, "get_full", err))
 	}
 
-	return models.DriversResponse{
-		Drivers: drivers,
-		Count:   count,
-	}, nil
+	return full, nil
 }
 
-func (d driverRepo) Update(driver models.Driver) (string, error) {
-	stmt, err := d.db.Prepare("UPDATE drivers SET full_name=$1, phone=$2, from_city_id=$3, to_city_id=$4 WHERE id=$5")
+func (d driverRepo) Update(ctx context.Context, driver models.Driver) (string, error) {
+	stmt, err := d.db.PrepareContext(ctx, "UPDATE drivers SET full_name=$1, phone=$2, from_city_id=$3, to_city_id=$4 WHERE id=$5")
 	if err != nil {
-		fmt.Println("error while updating driver data", err.Error())
-		return "", err
+		return "", logged(ctx, d.log, "update", err)
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(driver.FullName, driver.Phone, driver.FromCityID, driver.ToCityID, driver.ID)
+	result, err := stmt.ExecContext(ctx, driver.FullName, driver.Phone, driver.FromCityID, driver.ToCityID, driver.ID)
 	if err != nil {
-		fmt.Println("error while updating driver data", err.Error())
-		return "", err
+		return "", logged(ctx, d.log, "update", err)
+	}
+
+	if n, err := result.RowsAffected(); err != nil {
+		return "", logged(ctx, d.log, "update", err)
+	} else if n == 0 {
+		return "", storage.NotFound("driver")
 	}
 
 	return driver.ID, nil
 }
 
-func (d driverRepo) Delete(id string) error {
-	stmt, err := d.db.Prepare("DELETE FROM drivers WHERE id=$1")
+func (d driverRepo) Delete(ctx context.Context, id string) error {
+	stmt, err := d.db.PrepareContext(ctx, "DELETE FROM drivers WHERE id=$1")
 	if err != nil {
-		fmt.Println("error while deleting data", err.Error())
-		return err
+		return logged(ctx, d.log, "delete", err)
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(id)
+	result, err := stmt.ExecContext(ctx, id)
 	if err != nil {
-		fmt.Println("error while deleting data", err.Error())
-		return err
+		return logged(ctx, d.log, "delete", err)
+	}
+
+	if n, err := result.RowsAffected(); err != nil {
+		return logged(ctx, d.log, "delete", err)
+	} else if n == 0 {
+		return storage.NotFound("driver")
 	}
 
 	return nil
 }
 
-func (d driverRepo) countDrivers() (int, error) {
+func (d driverRepo) countDrivers(ctx context.Context) (int, error) {
 	var count int
-	err := d.db.QueryRow("SELECT COUNT(*) FROM drivers").Scan(&count)
+	err := d.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM drivers").Scan(&count)
 	if err != nil {
-		return 0, err
+		return 0, logged(ctx, d.log, "count_drivers", err)
 	}
 	return count, nil
 }
+
+// driverRow builds the driver SELECT, joining its from and to cities when
+// they are expanded.
+type driverRow struct {
+	expand               models.Expand
+	d                    models.Driver
+	fromCityID, toCityID sql.NullString
+	fromCity, toCity     nullCity
+}
+
+func newDriverRow(expand models.Expand) *driverRow {
+	return &driverRow{expand: expand}
+}
+
+func (r *driverRow) query() string {
+	query := "SELECT d.id, d.full_name, d.phone, d.from_city_id, d.to_city_id, d.created_at"
+	joins := ""
+
+	if r.expand.Has(models.ExpandFromCity) {
+		query += ", " + cityColumns("fc")
+		joins += " LEFT JOIN cities fc ON fc.id = d.from_city_id"
+	}
+	if r.expand.Has(models.ExpandToCity) {
+		query += ", " + cityColumns("tc")
+		joins += " LEFT JOIN cities tc ON tc.id = d.to_city_id"
+	}
+
+	return query + " FROM drivers d" + joins
+}
+
+func (r *driverRow) dest() []interface{} {
+	dest := []interface{}{&r.d.ID, &r.d.FullName, &r.d.Phone, &r.fromCityID, &r.toCityID, &r.d.CreatedAt}
+
+	if r.expand.Has(models.ExpandFromCity) {
+		dest = append(dest, r.fromCity.dest()...)
+	}
+	if r.expand.Has(models.ExpandToCity) {
+		dest = append(dest, r.toCity.dest()...)
+	}
+
+	return dest
+}
+
+func (r *driverRow) driver() models.Driver {
+	driver := r.d
+	driver.FromCityID = r.fromCityID.String
+	driver.ToCityID = r.toCityID.String
+	driver.FromCityData = r.fromCity.city()
+	driver.ToCityData = r.toCity.city()
+
+	return driver
+}
@@ -0,0 +1,82 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+
+	"city2city/storage"
+
+	"github.com/lib/pq"
+)
+
+// dbError turns a database/sql or pq error into a *storage.Error of the
+// matching kind. Errors it does not recognise, context errors among them,
+// come back unchanged.
+func dbError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var storageErr *storage.Error
+	if errors.As(err, &storageErr) {
+		return err
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return &storage.Error{Kind: storage.ErrNotFound, Message: "record not found", Err: err}
+	}
+
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	// pq messages name the constraint, never the offending values, which
+	// are in Detail
+	switch pqErr.Code {
+	case "40001", "40P01":
+		// what is left of a serialization failure or deadlock WithTx
+		// retried
+		return &storage.Error{Kind: storage.ErrConflict, Message: "conflicted with a concurrent change, try again", Err: err}
+	case "23505":
+		return &storage.Error{Kind: storage.ErrConflict, Message: pqErr.Message, Err: err}
+	case "23503":
+		return &storage.Error{Kind: storage.ErrForeignKeyViolation, Message: pqErr.Message, Err: err}
+	}
+
+	switch pqErr.Code.Class() {
+	case "22", "23":
+		// data exceptions (bad uuid, too long, out of range) and the
+		// remaining integrity constraints (check, not null)
+		return &storage.Error{Kind: storage.ErrValidation, Message: pqErr.Message, Err: err}
+	}
+
+	return err
+}
+
+// logged converts err with dbError and logs it with the operation that
+// failed. Errors of a known kind, a missing row or a violated constraint,
+// come from the request and are only logged at debug level; so do context
+// errors, at warn level.
+func logged(ctx context.Context, log *slog.Logger, operation string, err error) error {
+	err = dbError(err)
+	if err == nil {
+		return nil
+	}
+
+	var (
+		level      = slog.LevelError
+		storageErr *storage.Error
+	)
+	switch {
+	case errors.As(err, &storageErr):
+		level = slog.LevelDebug
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		level = slog.LevelWarn
+	}
+
+	log.LogAttrs(ctx, level, "storage operation failed", slog.String("operation", operation), slog.Any("error", err))
+	return err
+}
@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+
+	"city2city/api/models"
+)
+
+// The helpers below scan rows that come from a LEFT JOIN, where every column
+// may be NULL, into the nested models.
+
+func cityColumns(alias string) string {
+	return fmt.Sprintf("%[1]s.id, %[1]s.name, %[1]s.created_at", alias)
+}
+
+type nullCity struct {
+	id, name, createdAt sql.NullString
+}
+
+func (c *nullCity) dest() []interface{} {
+	return []interface{}{&c.id, &c.name, &c.createdAt}
+}
+
+func (c nullCity) city() models.City {
+	return models.City{
+		ID:        c.id.String,
+		Name:      c.name.String,
+		CreatedAt: c.createdAt.String,
+	}
+}
+
+func driverColumns(alias string) string {
+	return fmt.Sprintf("%[1]s.id, %[1]s.full_name, %[1]s.phone, %[1]s.from_city_id, %[1]s.to_city_id, %[1]s.created_at", alias)
+}
+
+type nullDriver struct {
+	id, fullName, phone, fromCityID, toCityID, createdAt sql.NullString
+}
+
+func (d *nullDriver) dest() []interface{} {
+	return []interface{}{&d.id, &d.fullName, &d.phone, &d.fromCityID, &d.toCityID, &d.createdAt}
+}
+
+func (d nullDriver) driver() models.Driver {
+	return models.Driver{
+		ID:           d.id.String,
+		FullName:     d.fullName.String,
+		Phone:        d.phone.String,
+		FromCityID:   d.fromCityID.String,
+		FromCityData: models.City{ID: d.fromCityID.String},
+		ToCityID:     d.toCityID.String,
+		ToCityData:   models.City{ID: d.toCityID.String},
+		CreatedAt:    d.createdAt.String,
+	}
+}
+
+func customerColumns(alias string) string {
+	return fmt.Sprintf("%[1]s.id, %[1]s.full_name, %[1]s.phone, %[1]s.email, %[1]s.created_at", alias)
+}
+
+type nullCustomer struct {
+	id, fullName, phone, email, createdAt sql.NullString
+}
+
+func (c *nullCustomer) dest() []interface{} {
+	return []interface{}{&c.id, &c.fullName, &c.phone, &c.email, &c.createdAt}
+}
+
+func (c nullCustomer) customer() models.Customer {
+	return models.Customer{
+		ID:        c.id.String,
+		FullName:  c.fullName.String,
+		Phone:     c.phone.String,
+		Email:     c.email.String,
+		CreatedAt: c.createdAt.String,
+	}
+}
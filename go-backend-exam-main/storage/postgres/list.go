@@ -0,0 +1,88 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+
+	"city2city/api/models"
+)
+
+// filter collects the WHERE conditions of a list query together with their
+// positional arguments, so the count and the data query share them.
+type filter struct {
+	conds []string
+	args  []interface{}
+}
+
+// add appends cond, in which every ? stands for arg.
+func (f *filter) add(cond string, arg interface{}) {
+	f.args = append(f.args, arg)
+	f.conds = append(f.conds, strings.ReplaceAll(cond, "?", fmt.Sprintf("$%d", len(f.args))))
+}
+
+func (f *filter) where() string {
+	if len(f.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(f.conds, " AND ")
+}
+
+// list returns the WHERE clause, the ORDER BY/LIMIT tail and the arguments
+// of a list data query. In cursor mode only rows after req.After count, in
+// (created_at, id) order, and one extra row is fetched so the caller can
+// tell whether another page follows. f itself is left as it was, for the
+// count query.
+func (f filter) list(req models.GetListRequest, alias string, sortable []string) (string, string, []interface{}) {
+	f.conds = append([]string{}, f.conds...)
+	f.args = append([]interface{}{}, f.args...)
+
+	if req.CursorMode {
+		if req.After != nil {
+			f.args = append(f.args, req.After.CreatedAt, req.After.ID)
+			f.conds = append(f.conds, fmt.Sprintf("(%[1]s.created_at, %[1]s.id) < ($%[2]d, $%[3]d::uuid)", alias, len(f.args)-1, len(f.args)))
+		}
+		f.args = append(f.args, req.Limit+1)
+		return f.where(), fmt.Sprintf(" ORDER BY %[1]s.created_at DESC, %[1]s.id DESC LIMIT $%[2]d", alias, len(f.args)), f.args
+	}
+
+	f.args = append(f.args, req.Limit, (req.Page-1)*req.Limit)
+	return f.where(), orderBy(req.Sort, alias, sortable) + fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(f.args)-1, len(f.args)), f.args
+}
+
+// orderBy renders the ORDER BY clause for the allowed fields of sort, newest
+// first when nothing usable was asked for. id breaks ties so pages are stable.
+func orderBy(sort []models.SortField, alias string, allowed []string) string {
+	var terms []string
+	for _, field := range sort {
+		if !contains(allowed, field.Field) {
+			continue
+		}
+		term := alias + "." + field.Field
+		if field.Desc {
+			term += " DESC"
+		}
+		terms = append(terms, term)
+	}
+
+	if len(terms) == 0 {
+		terms = append(terms, alias+".created_at DESC")
+	}
+
+	return " ORDER BY " + strings.Join(terms, ", ") + ", " + alias + ".id"
+}
+
+// likePattern matches s anywhere in a column, with LIKE wildcards in s
+// taken literally.
+func likePattern(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+	return "%" + s + "%"
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"city2city/api/models"
+	"city2city/storage"
+)
+
+type otpRepo struct {
+	db  querier
+	log *slog.Logger
+}
+
+func NewOTPRepo(db querier, log *slog.Logger) otpRepo {
+	return otpRepo{
+		db:  db,
+		log: log.With(slog.String("entity", "otp")),
+	}
+}
+
+// Save stores otp, replacing any code pending for the same role and phone.
+func (o otpRepo) Save(ctx context.Context, otp models.OTP) error {
+	query := `
+ INSERT INTO otp_codes (role, phone, code_hash, attempts, expires_at)
+  VALUES ($1, $2, $3, $4, $5)
+  ON CONFLICT (role, phone) DO UPDATE
+  SET code_hash = EXCLUDED.code_hash, attempts = EXCLUDED.attempts, expires_at = EXCLUDED.expires_at`
+
+	if _, err := o.db.ExecContext(ctx, query, otp.Role, otp.Phone, otp.CodeHash, otp.Attempts, otp.ExpiresAt); err != nil {
+		return fmt.Errorf("error while saving otp: %w", logged(ctx, o.log, "save", err))
+	}
+
+	return nil
+}
+
+func (o otpRepo) Attempt(ctx context.Context, role, phone string) (models.OTP, error) {
+	query := `
+ UPDATE otp_codes SET attempts = attempts + 1
+  WHERE role = $1 AND phone = $2
+  RETURNING role, phone, code_hash, attempts, expires_at`
+
+	otp := models.OTP{}
+	err := o.db.QueryRowContext(ctx, query, role, phone).Scan(&otp.Role, &otp.Phone, &otp.CodeHash, &otp.Attempts, &otp.ExpiresAt)
+	if err != nil {
+		return models.OTP{}, fmt.Errorf("error while counting otp attempt: %w", logged(ctx, o.log, "attempt", err))
+	}
+
+	return otp, nil
+}
+
+func (o otpRepo) Delete(ctx context.Context, role, phone string) error {
+	result, err := o.db.ExecContext(ctx, `DELETE FROM otp_codes WHERE role = $1 AND phone = $2`, role, phone)
+	if err != nil {
+		return fmt.Errorf("error while deleting otp: %w", logged(ctx, o.log, "delete", err))
+	}
+
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("error while deleting otp: %w", logged(ctx, o.log, "delete", err))
+	} else if n == 0 {
+		return storage.NotFound("otp")
+	}
+	return nil
+}
+
+func (o otpRepo) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	result, err := o.db.ExecContext(ctx, `DELETE FROM otp_codes WHERE expires_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("error while deleting expired otps: %w", logged(ctx, o.log, "delete_expired", err))
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, logged(ctx, o.log, "delete_expired", err)
+	}
+
+	return n, nil
+}
@@ -1,54 +1,172 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"log/slog"
+	"time"
 
 	"city2city/config"
+	"city2city/migrations"
 	"city2city/storage"
 )
 
 type Store struct {
 	db *sql.DB
+	// tx is the transaction the repos of a store handed out by WithTx run
+	// on
+	tx  *sql.Tx
+	log *slog.Logger
+	// migrator reads the schema version for the readiness probe; the
+	// migrations it knows are loaded once, on connecting
+	migrator *migrations.Migrator
 }
 
-func New(cfg config.Config) (storage.IStorage, error) {
-	url := fmt.Sprintf(`host = %s port = %s user = %s password = %s database = %s sslmode=disable`,
-		cfg.PostgresHost, cfg.PostgresPort, cfg.PostgresUser, cfg.PostgresPassword, cfg.PostgresDB)
+// maxConnectBackoff caps the wait between two attempts to reach the
+// database.
+const maxConnectBackoff = 30 * time.Second
 
-	db, err := sql.Open("postgres", url)
+// New connects to the database, retrying as configured while it cannot be
+// reached, so that a wrong password or host fails the start rather than
+// the first request.
+func New(ctx context.Context, cfg config.Config, log *slog.Logger) (storage.IStorage, error) {
+	db, err := Connect(cfg)
+	if err != nil {
+		return Store{}, err
+	}
+
+	if err = ping(ctx, db, cfg, log); err != nil {
+		db.Close()
+		return Store{}, err
+	}
+
+	migrator, err := migrations.New(db)
 	if err != nil {
+		db.Close()
 		return Store{}, err
 	}
 
 	return Store{
-		db: db,
+		db:       db,
+		log:      log,
+		migrator: migrator,
 	}, nil
 }
 
+// ping tries the database up to cfg.DBConnectAttempts times, doubling the
+// wait between attempts from cfg.DBConnectBackoff.
+func ping(ctx context.Context, db *sql.DB, cfg config.Config, log *slog.Logger) error {
+	backoff := cfg.DBConnectBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+		if attempt >= cfg.DBConnectAttempts {
+			return fmt.Errorf("database unreachable after %d attempts: %w", attempt, err)
+		}
+
+		log.Warn("database unreachable, retrying",
+			slog.Int("attempt", attempt),
+			slog.Duration("backoff", backoff),
+			slog.Any("error", err),
+		)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, maxConnectBackoff)
+	}
+}
+
+// Connect opens the postgres database described by cfg, with the pool
+// sized as configured.
+func Connect(cfg config.Config) (*sql.DB, error) {
+	url := fmt.Sprintf(`host = %s port = %s user = %s password = %s database = %s sslmode=disable`,
+		cfg.PostgresHost, cfg.PostgresPort, cfg.PostgresUser, cfg.PostgresPassword, cfg.PostgresDB)
+
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	db.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	db.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.DBConnMaxIdleTime)
+
+	return db, nil
+}
+
 func (s Store) CloseDB() {
 	s.db.Close()
 }
 
+func (s Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// SchemaVersion returns the migration version the database is at and the
+// latest one the code knows.
+func (s Store) SchemaVersion(ctx context.Context) (int64, int64, error) {
+	current, err := s.migrator.Version(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return current, s.migrator.Latest(), nil
+}
+
+// querier is what the repos run on: the transaction, if any, or the
+// database.
+func (s Store) querier() querier {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.db
+}
+
 func (s Store) City() storage.ICityRepo {
-	return NewCityRepo(s.db)
+	return NewCityRepo(s.querier(), s.log)
 }
 
 func (s Store) Customer() storage.ICustomerRepo {
-	return NewCustomerRepo(s.db)
+	return NewCustomerRepo(s.querier(), s.log)
 }
 
 func (s Store) Driver() storage.IDriverRepo {
-	return NewDriverRepo(s.db)
+	return NewDriverRepo(s.querier(), s.log)
 }
 
 func (s Store) Car() storage.ICarRepo {
-	return NewCarRepo(s.db)
+	return NewCarRepo(s.querier(), s.log)
 }
 
 func (s Store) Trip() storage.ITripRepo {
-	return NewTripRepo(s.db)
+	return NewTripRepo(s.querier(), s.log)
 }
 func (s Store) TripCustomer() storage.ITripCustomerRepo {
-	return NewTripCustomerRepo(s.db)
+	return NewTripCustomerRepo(s.querier(), s.log)
+}
+
+func (s Store) Admin() storage.IAdminRepo {
+	return NewAdminRepo(s.querier(), s.log)
+}
+
+func (s Store) OTP() storage.IOTPRepo {
+	return NewOTPRepo(s.querier(), s.log)
+}
+
+func (s Store) Stats() storage.IStatsRepo {
+	return NewStatsRepo(s.querier(), s.log)
+}
+
+// DBStats reports the connection pool, for metrics.
+func (s Store) DBStats() sql.DBStats {
+	return s.db.Stats()
 }
@@ -0,0 +1,54 @@
+package postgres
+
+import (
+	"context"
+	"log/slog"
+
+	"city2city/api/models"
+)
+
+type statsRepo struct {
+	db  querier
+	log *slog.Logger
+}
+
+func NewStatsRepo(db querier, log *slog.Logger) statsRepo {
+	return statsRepo{
+		db:  db,
+		log: log.With(slog.String("entity", "stats")),
+	}
+}
+
+func (s statsRepo) Get(ctx context.Context) (models.Stats, error) {
+	stats := models.Stats{OnlineCars: []models.CityCount{}}
+
+	if err := s.db.QueryRowContext(ctx, `
+ SELECT (SELECT count(1) FROM trips), (SELECT count(1) FROM trip_customers WHERE cancelled_at IS NULL)`).Scan(&stats.Trips, &stats.Bookings); err != nil {
+		return models.Stats{}, logged(ctx, s.log, "get", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+ SELECT ci.id, ci.name, count(1)
+  FROM cars c
+  JOIN cities ci ON ci.id = c.from_city_id
+  WHERE c.status
+  GROUP BY ci.id, ci.name
+  ORDER BY ci.name`)
+	if err != nil {
+		return models.Stats{}, logged(ctx, s.log, "get", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var city models.CityCount
+		if err = rows.Scan(&city.CityID, &city.City, &city.Count); err != nil {
+			return models.Stats{}, logged(ctx, s.log, "get", err)
+		}
+		stats.OnlineCars = append(stats.OnlineCars, city)
+	}
+	if err = rows.Err(); err != nil {
+		return models.Stats{}, logged(ctx, s.log, "get", err)
+	}
+
+	return stats, nil
+}
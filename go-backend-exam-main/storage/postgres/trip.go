@@ -1,9 +1,12 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"log/slog"
+	"time"
 
 	"city2city/api/models"
 	"city2city/storage"
@@ -11,147 +14,358 @@ import (
 )
 
 type tripRepo struct {
-	db *sql.DB
+	db  querier
+	log *slog.Logger
 }
 
-func NewTripRepo(db *sql.DB) storage.ITripRepo {
+func NewTripRepo(db querier, log *slog.Logger) storage.ITripRepo {
 	return &tripRepo{
-		db: db,
+		db:  db,
+		log: log.With(slog.String("entity", "trip")),
 	}
 }
 
-func (c *tripRepo) Create(trip models.CreateTrip) (string, error) {
+func (c *tripRepo) Create(ctx context.Context, trip models.CreateTrip) (string, error) {
 	// Generate a new UUID
 	tripID := uuid.New().String()
 
-	// Prepare the SQL query with a placeholder for the UUID
-	query := `INSERT INTO trips (id, trip_number_id, from_city_id, to_city_id, driver_id, price) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+	// trip_number_id is left to its column default, which draws from
+	// trip_number_seq and so stays unique under concurrent inserts
+	query := `INSERT INTO trips (id, from_city_id, to_city_id, driver_id, price, scheduled_departure, scheduled_arrival)
+	VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
 
-	// Execute the query, passing the generated UUID as a parameter
-	rows, err := c.db.Query(
+	err := c.db.QueryRowContext(ctx,
 		query,
 		tripID,
-		trip.TripNumberID,
 		trip.FromCityID,
 		trip.ToCityID,
 		trip.DriverID,
 		trip.Price,
-	)
+		timestampArg(trip.ScheduledDeparture),
+		timestampArg(trip.ScheduledArrival),
+	).Scan(&tripID)
 	if err != nil {
-		return "", err
-	}
-	defer rows.Close()
-
-	// No need to scan for the ID as it's already generated and returned
-	if !rows.Next() {
-		if err := rows.Err(); err != nil {
-			return "", err
-		}
-		return "", errors.New("failed to create city")
+		return "", fmt.Errorf("failed to create trip: %w", logged(ctx, c.log, "create", err))
 	}
 
 	return tripID, nil
 }
 
-func (c *tripRepo) Get(id string) (models.Trip, error) {
-	stmt, err := c.db.Prepare("SELECT id, trip_number_id, from_city_id, to_city_id, driver_id, price, created_at FROM trips WHERE id = $1")
-	if err != nil {
-		return models.Trip{}, fmt.Errorf("failed to get Trip: %w", err)
-	}
-	defer stmt.Close()
-
-	var trip models.Trip
-	err = stmt.QueryRow(id).Scan(&trip.ID, &trip.TripNumberID, &trip.FromCityID, &trip.ToCityID, &trip.DriverID, &trip.Price, &trip.CreatedAt)
+func (c *tripRepo) Get(ctx context.Context, id string, expand models.Expand) (models.Trip, error) {
+	row := newTripRow(expand)
+	err := c.db.QueryRowContext(ctx, row.query()+" WHERE t.id = $1", id).Scan(row.dest()...)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return models.Trip{}, fmt.Errorf("failed to get Trip: %w", err)
+			return models.Trip{}, fmt.Errorf("failed to get Trip: %w", logged(ctx, c.log, "get", err))
 		} else {
-			return models.Trip{}, err
+			return models.Trip{}, logged(ctx, c.log, "get", err)
 		}
 	}
 
-	return trip, nil
+	return row.trip(), nil
 }
 
-func (c *tripRepo) GetList(req models.GetListRequest) (models.TripsResponse, error) {
-	query := "SELECT id, trip_number_id, from_city_id, to_city_id, driver_id, price, created_at FROM trips"
+func (c *tripRepo) GetByNumber(ctx context.Context, number string, expand models.Expand) (models.Trip, error) {
+	row := newTripRow(expand)
+	err := c.db.QueryRowContext(ctx, row.query()+" WHERE t.trip_number_id = $1", number).Scan(row.dest()...)
+	if err != nil {
+		return models.Trip{}, fmt.Errorf("failed to get Trip by number: %w", logged(ctx, c.log, "get_by_number", err))
+	}
+
+	return row.trip(), nil
+}
 
-	if req.Page > 0 && req.Limit > 0 {
-		offset := (req.Page - 1) * req.Limit
-		query += fmt.Sprintf(" ORDER BY created_at DESC OFFSET %d LIMIT %d", offset, req.Limit)
+func (c *tripRepo) GetList(ctx context.Context, req models.GetTripListRequest) (models.TripsResponse, error) {
+	f := filter{}
+	if req.FromCityID != "" {
+		f.add("t.from_city_id = ?", req.FromCityID)
+	}
+	if req.ToCityID != "" {
+		f.add("t.to_city_id = ?", req.ToCityID)
+	}
+	if req.DriverID != "" {
+		f.add("t.driver_id = ?", req.DriverID)
+	}
+	if req.Status != "" {
+		f.add("t.status = ?", req.Status)
+	}
+	if req.MinPrice != nil {
+		f.add("t.price >= ?", *req.MinPrice)
+	}
+	if req.MaxPrice != nil {
+		f.add("t.price <= ?", *req.MaxPrice)
 	}
+	if !req.CreatedFrom.IsZero() {
+		f.add("t.created_at >= ?", req.CreatedFrom)
+	}
+	if !req.CreatedTo.IsZero() {
+		f.add("t.created_at < ?", req.CreatedTo)
+	}
+	if !req.DepartureFrom.IsZero() {
+		f.add("t.scheduled_departure >= ?", req.DepartureFrom.UTC())
+	}
+	if !req.DepartureTo.IsZero() {
+		f.add("t.scheduled_departure <= ?", req.DepartureTo.UTC())
+	}
+
+	row := newTripRow(req.Expand)
+	where, tail, args := f.list(req.GetListRequest, "t", models.TripSortFields)
+	query := row.query() + where + tail
 
-	rows, err := c.db.Query(query)
+	rows, err := c.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return models.TripsResponse{}, fmt.Errorf("failed to getList Trips: %w", err)
+		return models.TripsResponse{}, fmt.Errorf("failed to getList Trips: %w", logged(ctx, c.log, "get_list", err))
 	}
 	defer rows.Close()
 
 	var trips []models.Trip
 	for rows.Next() {
-		var trip models.Trip
-		err = rows.Scan(&trip.ID, &trip.TripNumberID, &trip.FromCityID, &trip.ToCityID, &trip.DriverID, &trip.Price, &trip.CreatedAt)
+		err = rows.Scan(row.dest()...)
 		if err != nil {
-			return models.TripsResponse{}, err
+			return models.TripsResponse{}, logged(ctx, c.log, "get_list", err)
 		}
-		trips = append(trips, trip)
+		trips = append(trips, row.trip())
 	}
 
-	countQuery := "SELECT COUNT(*) FROM trips"
-	row := c.db.QueryRow(countQuery)
-	var count int
-	err = row.Scan(&count)
-	if err != nil {
-		return models.TripsResponse{}, err
+	if err = rows.Err(); err != nil {
+		return models.TripsResponse{}, fmt.Errorf("failed to iterate Trips: %w", logged(ctx, c.log, "get_list", err))
+	}
+
+	resp := models.TripsResponse{Trips: trips}
+	if req.CursorMode {
+		resp.Trips, resp.NextCursor = models.NextCursor(trips, req.Limit, func(t models.Trip) (string, string) { return t.CreatedAt, t.ID })
 	}
 
-	return models.TripsResponse{Trips: trips, Count: count}, nil
+	if req.NeedsCount() {
+		countQuery := "SELECT COUNT(*) FROM trips t" + f.where()
+		err = c.db.QueryRowContext(ctx, countQuery, f.args...).Scan(&resp.Count)
+		if err != nil {
+			return models.TripsResponse{}, logged(ctx, c.log, "get_list", err)
+		}
+	}
+
+	return resp, nil
 }
 
-func (c *tripRepo) Update(trip models.Trip) (string, error) {
-	stmt, err := c.db.Prepare("UPDATE trips SET trip_number_id = $1, from_city_id = $2, to_city_id = $3, driver_id = $4, price = $5 WHERE id = $6")
+// Update changes a trip as models.TripEditable allows for its status.
+func (c *tripRepo) Update(ctx context.Context, trip models.Trip) (string, error) {
+	// trip_number_id is assigned once on insert and never rewritten; the
+	// status and actual times only change through Transition. The status is
+	// checked by the UPDATE itself, so a concurrent transition cannot slip
+	// in between.
+	stmt, err := c.db.PrepareContext(ctx, `UPDATE trips SET from_city_id = $1, to_city_id = $2, driver_id = $3, price = $4,
+	scheduled_departure = $5, scheduled_arrival = $6
+	WHERE id = $7 AND (status = $8 OR status = $9
+		AND scheduled_departure IS NOT DISTINCT FROM $5::timestamp AND scheduled_arrival IS NOT DISTINCT FROM $6::timestamp)`)
 	if err != nil {
-		return "", err
+		return "", logged(ctx, c.log, "update", err)
 	}
 	defer stmt.Close()
 
-	result, err := stmt.Exec(trip.TripNumberID, trip.FromCityID, trip.ToCityID, trip.DriverID, trip.Price, trip.ID)
+	result, err := stmt.ExecContext(ctx, trip.FromCityID, trip.ToCityID, trip.DriverID, trip.Price,
+		timestampArg(trip.ScheduledDeparture), timestampArg(trip.ScheduledArrival), trip.ID,
+		models.TripScheduled, models.TripBoarding)
 	if err != nil {
-		return "", err
+		return "", logged(ctx, c.log, "update", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return "", err
+		return "", logged(ctx, c.log, "update", err)
 	}
 
 	if rowsAffected == 0 {
-		return "", errors.New("failed to update Trip")
+		// tell a missing trip from one its status keeps from changing
+		var status string
+		err = c.db.QueryRowContext(ctx, `SELECT status FROM trips WHERE id = $1`, trip.ID).Scan(&status)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", storage.NotFound("trip")
+		} else if err != nil {
+			return "", fmt.Errorf("failed to update trip: %w", logged(ctx, c.log, "update", err))
+		}
+		if fields, _ := models.TripEditable(status); fields {
+			return "", storage.ErrTripBoarding
+		}
+		return "", storage.ErrTripFinal
 	}
 
 	return trip.ID, nil
 }
 
-func (c *tripRepo) Delete(id string) error {
-	stmt, err := c.db.Prepare("DELETE FROM trips WHERE id = $1")
+func (c *tripRepo) Delete(ctx context.Context, id string) error {
+	stmt, err := c.db.PrepareContext(ctx, "DELETE FROM trips WHERE id = $1")
 	if err != nil {
-		return err
+		return logged(ctx, c.log, "delete", err)
 	}
 	defer stmt.Close()
 
-	result, err := stmt.Exec(id)
+	result, err := stmt.ExecContext(ctx, id)
 	if err != nil {
-		return err
+		return logged(ctx, c.log, "delete", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return err
+		return logged(ctx, c.log, "delete", err)
 	}
 
 	if rowsAffected == 0 {
-		return errors.New("failed to delete Trip")
+		return storage.NotFound("trip")
+	}
+
+	return nil
+}
+
+// Transition locks the trip, so that concurrent transitions apply one after
+// another and each checks the status the previous one left.
+func (c *tripRepo) Transition(ctx context.Context, req models.TripTransition) error {
+	at := req.At.UTC()
+
+	err := atomically(ctx, c.db, func(tx querier) error {
+		var status string
+		err := tx.QueryRowContext(ctx, `SELECT status FROM trips WHERE id = $1 FOR UPDATE`, req.TripID).Scan(&status)
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.NotFound("trip")
+		} else if err != nil {
+			return err
+		}
+
+		if !models.CanTransitionTrip(status, req.Status) {
+			return storage.IllegalTransition(status, req.Status)
+		}
+
+		query := `
+        UPDATE trips
+        SET status = $1,
+            departed_at = CASE WHEN $1 = 'in_progress' THEN $2 ELSE departed_at END,
+            arrived_at = CASE WHEN $1 = 'completed' THEN $2 ELSE arrived_at END
+        WHERE id = $3
+    `
+		if _, err := tx.ExecContext(ctx, query, req.Status, at, req.TripID); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+        INSERT INTO trip_events (id, trip_id, from_status, to_status, actor_id, actor_role, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+    `, uuid.New().String(), req.TripID, status, req.Status, req.ActorID, req.ActorRole, at)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to transition trip: %w", logged(ctx, c.log, "transition", err))
 	}
 
 	return nil
 }
+
+func (c *tripRepo) GetEvents(ctx context.Context, tripID string) ([]models.TripEvent, error) {
+	rows, err := c.db.QueryContext(ctx, `
+        SELECT id, trip_id, from_status, to_status, actor_id, actor_role, created_at
+        FROM trip_events
+        WHERE trip_id = $1
+        ORDER BY created_at, id
+    `, tripID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trip events: %w", logged(ctx, c.log, "get_events", err))
+	}
+	defer rows.Close()
+
+	events := []models.TripEvent{}
+	for rows.Next() {
+		var e models.TripEvent
+		if err := rows.Scan(&e.ID, &e.TripID, &e.FromStatus, &e.ToStatus, &e.ActorID, &e.ActorRole, &e.CreatedAt); err != nil {
+			return nil, logged(ctx, c.log, "get_events", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logged(ctx, c.log, "get_events", err)
+	}
+
+	return events, nil
+}
+
+// timestampArg is the argument for a timestamp column from an RFC 3339
+// time: NULL when it is empty and otherwise the time in UTC, since the
+// column keeps no time zone.
+func timestampArg(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		// left for postgres to reject
+		return value
+	}
+	return t.UTC()
+}
+
+// tripRow builds the trip SELECT for the requested expansions and scans its
+// result, joining cities and drivers instead of querying them per row.
+type tripRow struct {
+	expand                                                  models.Expand
+	t                                                       models.Trip
+	fromCityID, toCityID, driverID                          sql.NullString
+	scheduledDeparture, scheduledArrival, departed, arrived sql.NullString
+	fromCity, toCity                                        nullCity
+	driver                                                  nullDriver
+}
+
+func newTripRow(expand models.Expand) *tripRow {
+	return &tripRow{expand: expand}
+}
+
+func (r *tripRow) query() string {
+	query := `SELECT t.id, t.trip_number_id, t.from_city_id, t.to_city_id, t.driver_id, t.price, t.status,
+	t.scheduled_departure, t.scheduled_arrival, t.departed_at, t.arrived_at, t.created_at`
+	joins := ""
+
+	if r.expand.Has(models.ExpandFromCity) {
+		query += ", " + cityColumns("fc")
+		joins += " LEFT JOIN cities fc ON fc.id = t.from_city_id"
+	}
+	if r.expand.Has(models.ExpandToCity) {
+		query += ", " + cityColumns("tc")
+		joins += " LEFT JOIN cities tc ON tc.id = t.to_city_id"
+	}
+	if r.expand.Has(models.ExpandDriver) {
+		query += ", " + driverColumns("d")
+		joins += " LEFT JOIN drivers d ON d.id = t.driver_id"
+	}
+
+	return query + " FROM trips t" + joins
+}
+
+func (r *tripRow) dest() []interface{} {
+	dest := []interface{}{&r.t.ID, &r.t.TripNumberID, &r.fromCityID, &r.toCityID, &r.driverID, &r.t.Price, &r.t.Status,
+		&r.scheduledDeparture, &r.scheduledArrival, &r.departed, &r.arrived, &r.t.CreatedAt}
+
+	if r.expand.Has(models.ExpandFromCity) {
+		dest = append(dest, r.fromCity.dest()...)
+	}
+	if r.expand.Has(models.ExpandToCity) {
+		dest = append(dest, r.toCity.dest()...)
+	}
+	if r.expand.Has(models.ExpandDriver) {
+		dest = append(dest, r.driver.dest()...)
+	}
+
+	return dest
+}
+
+func (r *tripRow) trip() models.Trip {
+	trip := r.t
+	trip.FromCityID = r.fromCityID.String
+	trip.ToCityID = r.toCityID.String
+	trip.DriverID = r.driverID.String
+	trip.ScheduledDeparture = r.scheduledDeparture.String
+	trip.ScheduledArrival = r.scheduledArrival.String
+	trip.DepartedAt = r.departed.String
+	trip.ArrivedAt = r.arrived.String
+	trip.FromCityData = r.fromCity.city()
+	trip.ToCityData = r.toCity.city()
+	trip.DriverData = r.driver.driver()
+
+	return trip
+}
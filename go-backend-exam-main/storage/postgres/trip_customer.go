@@ -1,133 +1,325 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"log/slog"
 
 	"city2city/api/models"
 	"city2city/storage"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type tripCustomerRepo struct {
-	db *sql.DB
+	db  querier
+	log *slog.Logger
 }
 
-func NewTripCustomerRepo(db *sql.DB) storage.ITripCustomerRepo {
+func NewTripCustomerRepo(db querier, log *slog.Logger) storage.ITripCustomerRepo {
 	return &tripCustomerRepo{
-		db: db,
+		db:  db,
+		log: log.With(slog.String("entity", "trip_customer")),
 	}
 }
 
-func (c *tripCustomerRepo) Create(req models.CreateTripCustomer) (string, error) {
-	// Generate a new UUID
+// Create books a customer on a trip. The trip row is locked for the duration
+// of the transaction, so concurrent bookings for the same trip are counted
+// one after another and can never exceed the car's seats.
+func (c *tripCustomerRepo) Create(ctx context.Context, req models.CreateTripCustomer) (string, error) {
 	uid := uuid.New().String()
 
-	// Prepare the SQL query with a placeholder for the UUID
-	query := `INSERT INTO trip_customers (id,trip_id, customer_id) VALUES ($1, $2, $3) RETURNING id`
+	err := atomically(ctx, c.db, func(tx querier) error {
+		if err := reserveSeat(ctx, tx, req.TripID, req.CustomerID, ""); err != nil {
+			return err
+		}
 
-	// Execute the query, passing the generated UUID as a parameter
-	rows, err := c.db.Query(
-		query,
-		uid,
-		req.TripID,
-		req.CustomerID,
-	)
+		_, err := tx.ExecContext(ctx, `INSERT INTO trip_customers (id, trip_id, customer_id) VALUES ($1, $2, $3)`,
+			uid, req.TripID, req.CustomerID)
+		return bookingError(err)
+	})
 	if err != nil {
-		return "", err
-	}
-	defer rows.Close()
-
-	// No need to scan for the ID as it's already generated and returned
-	if !rows.Next() {
-		if err := rows.Err(); err != nil {
-			return "", err
-		}
-		return "", errors.New("failed to create city")
+		return "", fmt.Errorf("failed to book trip: %w", logged(ctx, c.log, "create", err))
 	}
 
 	return uid, nil
 }
 
-func (c *tripCustomerRepo) Get(id string) (models.TripCustomer, error) {
-	query := `
-        SELECT id, trip_id, customer_id, created_at
-        FROM trip_customers
-        WHERE id = $1
-    `
-	row := c.db.QueryRow(query, id)
-	var tripCustomer models.TripCustomer
-	if err := row.Scan(&tripCustomer.ID, &tripCustomer.TripID, &tripCustomer.CustomerID, &tripCustomer.CustomerData, &tripCustomer.CreatedAt); err != nil {
-		return models.TripCustomer{}, fmt.Errorf("failed to get trip customer: %w", err)
+func (c *tripCustomerRepo) Get(ctx context.Context, id string, expand models.Expand) (models.TripCustomer, error) {
+	row := newTripCustomerRow(expand)
+	if err := c.db.QueryRowContext(ctx, row.query()+" WHERE tc.id = $1", id).Scan(row.dest()...); err != nil {
+		return models.TripCustomer{}, fmt.Errorf("failed to get trip customer: %w", logged(ctx, c.log, "get", err))
 	}
-	return tripCustomer, nil
+	return row.tripCustomer(), nil
 }
 
-func (c *tripCustomerRepo) GetList(req models.GetListRequest) (models.TripCustomersResponse, error) {
-	query := `
-        SELECT id, trip_id, customer_id, created_at
-        FROM trip_customers
-        ORDER BY created_at DESC
-        LIMIT $1 OFFSET $2
-    `
-	rows, err := c.db.Query(query, req.Limit, (req.Page-1)*req.Limit)
+func (c *tripCustomerRepo) GetList(ctx context.Context, req models.GetTripCustomerListRequest) (models.TripCustomersResponse, error) {
+	f := filter{}
+	if req.TripID != "" {
+		f.add("tc.trip_id = ?", req.TripID)
+	}
+	if req.CustomerID != "" {
+		f.add("tc.customer_id = ?", req.CustomerID)
+	}
+	if req.Cancelled != nil {
+		f.add("(tc.cancelled_at IS NOT NULL) = ?", *req.Cancelled)
+	}
+
+	row := newTripCustomerRow(req.Expand)
+	where, tail, args := f.list(req.GetListRequest, "tc", models.TripCustomerSortFields)
+	query := row.query() + where + tail
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return models.TripCustomersResponse{}, fmt.Errorf("failed to get trip customers list: %w", err)
+		return models.TripCustomersResponse{}, fmt.Errorf("failed to get trip customers list: %w", logged(ctx, c.log, "get_list", err))
 	}
 	defer rows.Close()
 
 	var tripCustomers []models.TripCustomer
 	for rows.Next() {
-		var tripCustomer models.TripCustomer
-		if err := rows.Scan(&tripCustomer.ID, &tripCustomer.TripID, &tripCustomer.CustomerID, &tripCustomer.CustomerData, &tripCustomer.CreatedAt); err != nil {
-			return models.TripCustomersResponse{}, fmt.Errorf("failed to scan trip customer: %w", err)
+		if err := rows.Scan(row.dest()...); err != nil {
+			return models.TripCustomersResponse{}, fmt.Errorf("failed to scan trip customer: %w", logged(ctx, c.log, "get_list", err))
 		}
-		tripCustomers = append(tripCustomers, tripCustomer)
+		tripCustomers = append(tripCustomers, row.tripCustomer())
 	}
 
 	if err := rows.Err(); err != nil {
-		return models.TripCustomersResponse{}, fmt.Errorf("failed to iterate trip customers: %w", err)
+		return models.TripCustomersResponse{}, fmt.Errorf("failed to iterate trip customers: %w", logged(ctx, c.log, "get_list", err))
 	}
 
-	countQuery := `
-        SELECT COUNT(*) FROM trip_customers
-    `
-	row := c.db.QueryRow(countQuery)
-	var count int
-	if err := row.Scan(&count); err != nil {
-		return models.TripCustomersResponse{}, fmt.Errorf("failed to count trip customers: %w", err)
+	resp := models.TripCustomersResponse{TripCustomers: tripCustomers}
+	if req.CursorMode {
+		resp.TripCustomers, resp.NextCursor = models.NextCursor(tripCustomers, req.Limit, func(tc models.TripCustomer) (string, string) { return tc.CreatedAt, tc.ID })
 	}
 
-	return models.TripCustomersResponse{
-		TripCustomers: tripCustomers,
-		Count:         count,
-	}, nil
+	if req.NeedsCount() {
+		countQuery := `
+        SELECT COUNT(*) FROM trip_customers tc` + f.where()
+		if err := c.db.QueryRowContext(ctx, countQuery, f.args...).Scan(&resp.Count); err != nil {
+			return models.TripCustomersResponse{}, fmt.Errorf("failed to count trip customers: %w", logged(ctx, c.log, "get_list", err))
+		}
+	}
+
+	return resp, nil
 }
 
-func (c *tripCustomerRepo) Update(req models.TripCustomer) (string, error) {
-	query := `
+func (c *tripCustomerRepo) Update(ctx context.Context, req models.TripCustomer) (string, error) {
+	var id string
+	err := atomically(ctx, c.db, func(tx querier) error {
+		var cancelled bool
+		err := tx.QueryRowContext(ctx, `SELECT cancelled_at IS NOT NULL FROM trip_customers WHERE id = $1 FOR UPDATE`, req.ID).Scan(&cancelled)
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.NotFound("trip customer")
+		} else if err != nil {
+			return err
+		}
+		if cancelled {
+			return storage.ErrCancelled
+		}
+
+		// moving a booking to another trip has to fit on that trip as well
+		if err := reserveSeat(ctx, tx, req.TripID, req.CustomerID, req.ID); err != nil {
+			return err
+		}
+
+		query := `
         UPDATE trip_customers
         SET trip_id = $1, customer_id = $2
         WHERE id = $3
         RETURNING id
     `
-	row := c.db.QueryRow(query, req.TripID, req.CustomerID, req.ID)
-	var id string
-	if err := row.Scan(&id); err != nil {
-		return "", fmt.Errorf("failed to update trip customer: %w", err)
+		return bookingError(tx.QueryRowContext(ctx, query, req.TripID, req.CustomerID, req.ID).Scan(&id))
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to update trip customer: %w", logged(ctx, c.log, "update", err))
 	}
+
 	return id, nil
 }
 
-func (c *tripCustomerRepo) Delete(id string) error {
+// Cancel locks the booking and its trip, so that the cancellation cannot
+// race the trip's departure or another cancellation.
+func (c *tripCustomerRepo) Cancel(ctx context.Context, req models.CancelTripCustomer) error {
+	err := atomically(ctx, c.db, func(tx querier) error {
+		var (
+			tripID    sql.NullString
+			cancelled bool
+		)
+		err := tx.QueryRowContext(ctx, `SELECT trip_id, cancelled_at IS NOT NULL FROM trip_customers WHERE id = $1 FOR UPDATE`,
+			req.ID).Scan(&tripID, &cancelled)
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.NotFound("trip customer")
+		} else if err != nil {
+			return err
+		}
+		if cancelled {
+			return storage.ErrCancelled
+		}
+
+		if tripID.Valid {
+			var status string
+			if err := tx.QueryRowContext(ctx, `SELECT status FROM trips WHERE id = $1 FOR UPDATE`, tripID.String).Scan(&status); err != nil {
+				return err
+			}
+			if !models.TripOpenForBooking(status) {
+				return storage.ErrTripDeparted
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `
+        UPDATE trip_customers
+        SET cancelled_at = $1, cancelled_by = $2, cancelled_by_role = $3, cancel_reason = $4, refund = $5, penalty = $6
+        WHERE id = $7
+    `, req.At.UTC(), req.ActorID, req.ActorRole, req.Reason, req.Refund, req.Penalty, req.ID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to cancel trip customer: %w", logged(ctx, c.log, "cancel", err))
+	}
+
+	return nil
+}
+
+func (c *tripCustomerRepo) Delete(ctx context.Context, id string) error {
 	query := `
         DELETE FROM trip_customers
         WHERE id = $1
     `
-	_, err := c.db.Exec(query, id)
+	result, err := c.db.ExecContext(ctx, query, id)
 	if err != nil {
-		return fmt.Errorf("failed to delete trip customer: %w", err)
+		return fmt.Errorf("failed to delete trip customer: %w", logged(ctx, c.log, "delete", err))
+	}
+
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to delete trip customer: %w", logged(ctx, c.log, "delete", err))
+	} else if n == 0 {
+		return storage.NotFound("trip customer")
 	}
 	return nil
 }
+
+// reserveSeat locks the trip and checks that it is still open for booking,
+// that customerID is not booked on it yet and that a seat is free.
+// Cancelled bookings hold no seat, and bookingID, the booking being moved
+// if any, is left out of the checks.
+func reserveSeat(ctx context.Context, tx querier, tripID, customerID, bookingID string) error {
+	var (
+		status string
+		seats  sql.NullInt64
+	)
+	err := tx.QueryRowContext(ctx, `
+        SELECT t.status, (SELECT seats FROM cars WHERE driver_id = t.driver_id ORDER BY created_at DESC LIMIT 1)
+        FROM trips t
+        WHERE t.id = $1
+        FOR UPDATE
+    `, tripID).Scan(&status, &seats)
+	if err != nil {
+		return fmt.Errorf("failed to lock trip: %w", dbError(err))
+	}
+
+	if !models.TripOpenForBooking(status) {
+		return storage.ErrTripClosed
+	}
+
+	// a driver without a registered car is assumed to drive the default one
+	if !seats.Valid {
+		seats.Int64 = models.DefaultCarSeats
+	}
+
+	var booked, taken int64
+	err = tx.QueryRowContext(ctx, `
+        SELECT COUNT(*) FILTER (WHERE customer_id = $2), COUNT(*)
+        FROM trip_customers
+        WHERE trip_id = $1 AND id::text <> $3 AND cancelled_at IS NULL
+    `, tripID, customerID, bookingID).Scan(&booked, &taken)
+	if err != nil {
+		return fmt.Errorf("failed to count trip bookings: %w", dbError(err))
+	}
+
+	if booked > 0 {
+		return storage.ErrAlreadyBooked
+	}
+
+	if taken >= seats.Int64 {
+		return storage.ErrTripFull
+	}
+
+	return nil
+}
+
+// bookingError turns a violation of the unique index on the (trip_id,
+// customer_id) of active bookings into storage.ErrAlreadyBooked.
+func bookingError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return storage.ErrAlreadyBooked
+	}
+
+	return dbError(err)
+}
+
+// tripCustomerRow builds the trip_customers SELECT, joining the customer when
+// it is expanded.
+type tripCustomerRow struct {
+	expand                                    models.Expand
+	tc                                        models.TripCustomer
+	tripID, customerID                        sql.NullString
+	cancelledAt, cancelledBy, cancelledByRole sql.NullString
+	cancelReason                              sql.NullString
+	refund, penalty                           sql.NullInt64
+	customer                                  nullCustomer
+}
+
+func newTripCustomerRow(expand models.Expand) *tripCustomerRow {
+	return &tripCustomerRow{expand: expand}
+}
+
+func (r *tripCustomerRow) query() string {
+	query := `SELECT tc.id, tc.trip_id, tc.customer_id, tc.cancelled_at, tc.cancelled_by, tc.cancelled_by_role,
+	tc.cancel_reason, tc.refund, tc.penalty, tc.created_at`
+	joins := ""
+
+	if r.expand.Has(models.ExpandCustomer) {
+		query += ", " + customerColumns("cu")
+		joins += " LEFT JOIN customers cu ON cu.id = tc.customer_id"
+	}
+
+	return query + " FROM trip_customers tc" + joins
+}
+
+func (r *tripCustomerRow) dest() []interface{} {
+	dest := []interface{}{&r.tc.ID, &r.tripID, &r.customerID, &r.cancelledAt, &r.cancelledBy, &r.cancelledByRole,
+		&r.cancelReason, &r.refund, &r.penalty, &r.tc.CreatedAt}
+
+	if r.expand.Has(models.ExpandCustomer) {
+		dest = append(dest, r.customer.dest()...)
+	}
+
+	return dest
+}
+
+func (r *tripCustomerRow) tripCustomer() models.TripCustomer {
+	tripCustomer := r.tc
+	tripCustomer.TripID = r.tripID.String
+	tripCustomer.CustomerID = r.customerID.String
+	tripCustomer.CustomerData = r.customer.customer()
+
+	if r.cancelledAt.Valid {
+		tripCustomer.Cancellation = &models.Cancellation{
+			CancelledAt: r.cancelledAt.String,
+			ActorID:     r.cancelledBy.String,
+			ActorRole:   r.cancelledByRole.String,
+			Reason:      r.cancelReason.String,
+			Refund:      int(r.refund.Int64),
+			Penalty:     int(r.penalty.Int64),
+		}
+	}
+
+	return tripCustomer
+}
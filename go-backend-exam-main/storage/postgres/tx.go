@@ -0,0 +1,117 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"city2city/storage"
+
+	"github.com/lib/pq"
+)
+
+// querier runs statements on the database or, in a store handed out by
+// WithTx, on its transaction. Repos hold one so they work either way.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+const (
+	// maxTxAttempts is how many times WithTx runs a transaction that
+	// failed to serialize with a concurrent one.
+	maxTxAttempts = 3
+	// txRetryBackoff is the wait before the first retry, doubled before
+	// each next one.
+	txRetryBackoff = 10 * time.Millisecond
+)
+
+// WithTx runs fn in a serializable transaction. When the transaction fails
+// to serialize with a concurrent one, or deadlocks, it is run again from
+// the start, up to maxTxAttempts times.
+func (s Store) WithTx(ctx context.Context, fn func(tx storage.IStorage) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	backoff := txRetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := s.runTx(ctx, fn)
+		if err == nil || !retryable(err) || attempt >= maxTxAttempts {
+			return err
+		}
+
+		s.log.LogAttrs(ctx, slog.LevelWarn, "transaction conflicted, retrying",
+			slog.Int("attempt", attempt),
+			slog.Any("error", err),
+		)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+	}
+}
+
+func (s Store) runTx(ctx context.Context, fn func(tx storage.IStorage) error) error {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", logged(ctx, s.log, "begin", err))
+	}
+	// rolls back on an error or a panic; after a commit it does nothing
+	defer tx.Rollback()
+
+	if err = fn(Store{db: s.db, tx: tx, log: s.log, migrator: s.migrator}); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", logged(ctx, s.log, "commit", err))
+	}
+
+	return nil
+}
+
+// atomically runs fn in a transaction of its own on q, or in the one q
+// already is. Repos use it for the statements that must apply together
+// even when called outside WithTx.
+func atomically(ctx context.Context, q querier, fn func(tx querier) error) error {
+	if tx, ok := q.(*sql.Tx); ok {
+		return fn(tx)
+	}
+
+	tx, err := q.(*sql.DB).BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// retryable tells whether err is a serialization failure or a deadlock,
+// which running the transaction again may not meet.
+func retryable(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
@@ -1,65 +1,128 @@
 package storage
 
 import (
+	"context"
+	"time"
+
 	"city2city/api/models"
 )
 
 type IStorage interface {
 	CloseDB()
+	// Ping tells whether the backing database can be reached.
+	Ping(context.Context) error
+	// WithTx runs fn with a store whose repos share one transaction,
+	// committed if fn returns nil and rolled back if it returns an error or
+	// panics. fn may run more than once, when the transaction conflicts
+	// with a concurrent one, so it must not have effects outside the store,
+	// and must use tx rather than the store WithTx was called on. Nested
+	// calls join the outer transaction.
+	WithTx(ctx context.Context, fn func(tx IStorage) error) error
 	City() ICityRepo
 	Customer() ICustomerRepo
 	Driver() IDriverRepo
 	Car() ICarRepo
 	Trip() ITripRepo
 	TripCustomer() ITripCustomerRepo
+	Admin() IAdminRepo
+	OTP() IOTPRepo
+	Stats() IStatsRepo
 }
 
 type ICityRepo interface {
-	Create(models.CreateCity) (string, error)
-	Get(id string) (models.City, error)
-	GetList(models.GetListRequest) (models.CitiesResponse, error)
-	Update(models.City) (string, error)
-	Delete(id string) error
+	Create(context.Context, models.CreateCity) (string, error)
+	Get(ctx context.Context, id string) (models.City, error)
+	GetList(context.Context, models.GetCityListRequest) (models.CitiesResponse, error)
+	Update(context.Context, models.City) (string, error)
+	Delete(ctx context.Context, id string) error
 }
 
 type ICustomerRepo interface {
-	Create(customer models.CreateCustomer) (string, error)
-	Get(id string) (models.Customer, error)
-	GetList(models.GetListRequest) (models.CustomersResponse, error)
-	Update(models.Customer) (string, error)
-	Delete(id string) error
+	Create(ctx context.Context, customer models.CreateCustomer) (string, error)
+	Get(ctx context.Context, id string) (models.Customer, error)
+	GetByPhone(ctx context.Context, phone string) (models.Customer, error)
+	GetList(context.Context, models.GetCustomerListRequest) (models.CustomersResponse, error)
+	Update(context.Context, models.Customer) (string, error)
+	Delete(ctx context.Context, id string) error
 }
 
 type IDriverRepo interface {
-	Create(driver models.CreateDriver) (string, error)
-	Get(id string) (models.Driver, error)
-	GetList(models.GetListRequest) (models.DriversResponse, error)
-	Update(models.Driver) (string, error)
-	Delete(id string) error
+	Create(ctx context.Context, driver models.CreateDriver) (string, error)
+	Get(ctx context.Context, id string, expand models.Expand) (models.Driver, error)
+	GetByPhone(ctx context.Context, phone string) (models.Driver, error)
+	GetFull(context.Context, models.GetDriverFullRequest) (models.DriverFull, error)
+	GetList(context.Context, models.GetDriverListRequest) (models.DriversResponse, error)
+	Update(context.Context, models.Driver) (string, error)
+	Delete(ctx context.Context, id string) error
 }
 
 type ICarRepo interface {
-	Create(models.CreateCar) (string, error)
-	Get(id string) (models.Car, error)
-	GetList(models.GetListRequest) (models.CarsResponse, error)
-	Update(models.Car) (string, error)
-	Delete(id string) error
-	UpdateCarStatus(updateCarStatus models.UpdateCarStatus) error
-	UpdateCarRoute(updateCarRoute models.UpdateCarRoute) error
+	Create(context.Context, models.CreateCar) (string, error)
+	Get(ctx context.Context, id string, expand models.Expand) (models.Car, error)
+	GetList(context.Context, models.GetCarListRequest) (models.CarsResponse, error)
+	Update(context.Context, models.Car) (string, error)
+	Delete(ctx context.Context, id string) error
+	UpdateCarStatus(ctx context.Context, updateCarStatus models.UpdateCarStatus) error
+	UpdateCarRoute(ctx context.Context, updateCarRoute models.UpdateCarRoute) error
 }
 
 type ITripRepo interface {
-	Create(models.CreateTrip) (string, error)
-	Get(id string) (models.Trip, error)
-	GetList(models.GetListRequest) (models.TripsResponse, error)
-	Update(models.Trip) (string, error)
-	Delete(id string) error
+	Create(context.Context, models.CreateTrip) (string, error)
+	Get(ctx context.Context, id string, expand models.Expand) (models.Trip, error)
+	GetByNumber(ctx context.Context, number string, expand models.Expand) (models.Trip, error)
+	GetList(context.Context, models.GetTripListRequest) (models.TripsResponse, error)
+	Update(context.Context, models.Trip) (string, error)
+	Delete(ctx context.Context, id string) error
+	// Transition moves a trip to another status, if models.CanTransitionTrip
+	// allows it from the current one, sets the actual departure or arrival
+	// time when the trip starts or completes, and records a TripEvent.
+	Transition(context.Context, models.TripTransition) error
+	// GetEvents returns the status changes of a trip, oldest first.
+	GetEvents(ctx context.Context, tripID string) ([]models.TripEvent, error)
 }
 
 type ITripCustomerRepo interface {
-	Create(models.CreateTripCustomer) (string, error)
-	Get(id string) (models.TripCustomer, error)
-	GetList(models.GetListRequest) (models.TripCustomersResponse, error)
-	Update(models.TripCustomer) (string, error)
-	Delete(id string) error
+	Create(context.Context, models.CreateTripCustomer) (string, error)
+	Get(ctx context.Context, id string, expand models.Expand) (models.TripCustomer, error)
+	GetList(context.Context, models.GetTripCustomerListRequest) (models.TripCustomersResponse, error)
+	Update(context.Context, models.TripCustomer) (string, error)
+	// Delete erases a booking and its cancellation, if any. The policy
+	// leaves it to admins; bookings are otherwise cancelled.
+	Delete(ctx context.Context, id string) error
+	// Cancel records the cancellation of an active booking, freeing its
+	// seat, as long as the trip has not departed.
+	Cancel(context.Context, models.CancelTripCustomer) error
+}
+
+type IAdminRepo interface {
+	Create(context.Context, models.CreateAdmin) (string, error)
+	Get(ctx context.Context, id string) (models.Admin, error)
+	GetByLogin(ctx context.Context, login string) (models.Admin, error)
+}
+
+// IOTPRepo keeps at most one pending code per role and phone.
+type IOTPRepo interface {
+	Save(context.Context, models.OTP) error
+	// Attempt counts a verification attempt against the pending code and
+	// returns the code with the attempt included. The count is raised
+	// atomically, so parallel guesses are all counted.
+	Attempt(ctx context.Context, role, phone string) (models.OTP, error)
+	// Delete removes the pending code, failing with ErrNotFound when there
+	// is none, so that of two requests using a code only one succeeds.
+	Delete(ctx context.Context, role, phone string) error
+	// DeleteExpired removes the codes that expired before the given time
+	// and returns how many there were.
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
+}
+
+// ISchemaVersioner is implemented by stores whose schema is migrated.
+// SchemaVersion returns the version the database is at and the latest one
+// the code knows.
+type ISchemaVersioner interface {
+	SchemaVersion(context.Context) (current, latest int64, err error)
+}
+
+// IStatsRepo reads the business figures exported as metrics.
+type IStatsRepo interface {
+	Get(context.Context) (models.Stats, error)
 }
@@ -0,0 +1,172 @@
+package validation
+
+import (
+	"time"
+
+	"city2city/api/models"
+	"city2city/auth"
+)
+
+// City names are limited like the cities.name check constraint.
+const (
+	cityNameMin = 4
+	cityNameMax = 30
+)
+
+func CreateCity(city models.CreateCity) error {
+	v := &Validator{}
+	Field(v, "name", city.Name, Required, Length(cityNameMin, cityNameMax))
+	return v.Err()
+}
+
+func UpdateCity(city models.City) error {
+	v := &Validator{}
+	Field(v, "id", city.ID, Required, UUID)
+	Field(v, "name", city.Name, Required, Length(cityNameMin, cityNameMax))
+	return v.Err()
+}
+
+func CreateCustomer(customer models.CreateCustomer) error {
+	v := &Validator{}
+	customerFields(v, customer.FullName, customer.Phone, customer.Email)
+	return v.Err()
+}
+
+func UpdateCustomer(customer models.Customer) error {
+	v := &Validator{}
+	Field(v, "id", customer.ID, Required, UUID)
+	customerFields(v, customer.FullName, customer.Phone, customer.Email)
+	return v.Err()
+}
+
+func customerFields(v *Validator, fullName, phone, email string) {
+	Field(v, "full_name", fullName, Required)
+	Field(v, "phone", phone, Required, Phone)
+	Field(v, "email", email, Required, Email)
+}
+
+func CreateDriver(driver models.CreateDriver) error {
+	v := &Validator{}
+	driverFields(v, driver.FullName, driver.Phone, driver.FromCityID, driver.ToCityID)
+	return v.Err()
+}
+
+func UpdateDriver(driver models.Driver) error {
+	v := &Validator{}
+	Field(v, "id", driver.ID, Required, UUID)
+	driverFields(v, driver.FullName, driver.Phone, driver.FromCityID, driver.ToCityID)
+	return v.Err()
+}
+
+func driverFields(v *Validator, fullName, phone, fromCityID, toCityID string) {
+	Field(v, "full_name", fullName, Required)
+	Field(v, "phone", phone, Required, Phone)
+	route(v, fromCityID, toCityID)
+}
+
+// A car without seats gets models.DefaultCarSeats.
+func CreateCar(car models.CreateCar) error {
+	v := &Validator{}
+	carFields(v, car.Model, car.Brand, car.Number, car.Seats)
+	Field(v, "driver_id", car.DriverID, Optional(UUID))
+	return v.Err()
+}
+
+// Seats left at zero are not changed.
+func UpdateCar(car models.Car) error {
+	v := &Validator{}
+	Field(v, "id", car.ID, Required, UUID)
+	carFields(v, car.Model, car.Brand, car.Number, car.Seats)
+	return v.Err()
+}
+
+func carFields(v *Validator, model, brand, number string, seats int) {
+	Field(v, "model", model, Required)
+	Field(v, "brand", brand, Required)
+	Field(v, "number", number, Required, CarNumber)
+	Field(v, "seats", seats, Min(0))
+}
+
+func UpdateCarStatus(status models.UpdateCarStatus) error {
+	v := &Validator{}
+	Field(v, "id", status.ID, Required, UUID)
+	return v.Err()
+}
+
+func UpdateCarRoute(carRoute models.UpdateCarRoute) error {
+	v := &Validator{}
+	Field(v, "car_id", carRoute.CarID, Required, UUID)
+	route(v, carRoute.FromCityID, carRoute.ToCityID)
+	Field(v, "departure_time", carRoute.DepartureTime, RequiredTime)
+	return v.Err()
+}
+
+func CreateTrip(trip models.CreateTrip) error {
+	v := &Validator{}
+	tripFields(v, trip.FromCityID, trip.ToCityID, trip.DriverID, trip.Price)
+	schedule(v, trip.ScheduledDeparture, trip.ScheduledArrival)
+	return v.Err()
+}
+
+func UpdateTrip(trip models.Trip) error {
+	v := &Validator{}
+	Field(v, "id", trip.ID, Required, UUID)
+	tripFields(v, trip.FromCityID, trip.ToCityID, trip.DriverID, trip.Price)
+	schedule(v, trip.ScheduledDeparture, trip.ScheduledArrival)
+	return v.Err()
+}
+
+func tripFields(v *Validator, fromCityID, toCityID, driverID string, price int) {
+	route(v, fromCityID, toCityID)
+	Field(v, "driver_id", driverID, Required, UUID)
+	Field(v, "price", price, Min(0))
+}
+
+// schedule checks the optional scheduled departure and arrival of a trip:
+// RFC 3339 times, the arrival after the departure.
+func schedule(v *Validator, departure, arrival string) {
+	Field(v, "scheduled_departure", departure, Optional(Timestamp))
+	Field(v, "scheduled_arrival", arrival, Optional(Timestamp))
+
+	departs, err1 := time.Parse(time.RFC3339, departure)
+	arrives, err2 := time.Parse(time.RFC3339, arrival)
+	v.Check(err1 != nil || err2 != nil || arrives.After(departs), "scheduled_arrival", "must be after scheduled_departure")
+}
+
+func CreateTripCustomer(booking models.CreateTripCustomer) error {
+	v := &Validator{}
+	Field(v, "trip_id", booking.TripID, Required, UUID)
+	Field(v, "customer_id", booking.CustomerID, Required, UUID)
+	return v.Err()
+}
+
+func UpdateTripCustomer(booking models.TripCustomer) error {
+	v := &Validator{}
+	Field(v, "id", booking.ID, Required, UUID)
+	Field(v, "trip_id", booking.TripID, Required, UUID)
+	Field(v, "customer_id", booking.CustomerID, Required, UUID)
+	return v.Err()
+}
+
+func CancelTripCustomer(cancel models.CancelTripCustomerRequest) error {
+	v := &Validator{}
+	Field(v, "reason", cancel.Reason, Length(0, 500))
+	return v.Err()
+}
+
+const minPasswordLength = 8
+
+func CreateAdmin(admin models.CreateAdmin) error {
+	v := &Validator{}
+	Field(v, "login", admin.Login, Required, Length(3, 50))
+	Field(v, "password", admin.Password, Required, Length(minPasswordLength, 128))
+	Field(v, "role", admin.Role, Required, OneOf(auth.RoleAdmin, auth.RoleDispatcher))
+	return v.Err()
+}
+
+// route checks a from/to city pair: both required and different.
+func route(v *Validator, fromCityID, toCityID string) {
+	Field(v, "from_city_id", fromCityID, Required, UUID)
+	Field(v, "to_city_id", toCityID, Required, UUID)
+	v.Check(fromCityID == "" || fromCityID != toCityID, "to_city_id", "must differ from from_city_id")
+}
@@ -0,0 +1,49 @@
+package validation
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"city2city/api/models"
+)
+
+func TestEveryFieldIsReported(t *testing.T) {
+	err := CreateDriver(models.CreateDriver{
+		Phone:      "90 123 45 67",
+		FromCityID: "tashkent",
+		ToCityID:   "tashkent",
+	})
+
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("CreateDriver() = %v, want Errors", err)
+	}
+
+	var fields []string
+	for _, fieldErr := range errs {
+		fields = append(fields, fieldErr.Field)
+	}
+
+	// to_city_id fails both as a UUID and as the same city as from_city_id
+	want := []string{"full_name", "phone", "from_city_id", "to_city_id", "to_city_id"}
+	if !slices.Equal(fields, want) {
+		t.Errorf("got errors for %v, want %v: %v", fields, want, err)
+	}
+}
+
+func TestFirstBrokenRuleOnly(t *testing.T) {
+	err := CreateCustomer(models.CreateCustomer{FullName: "Bob Smith", Email: "bob@example.com"})
+
+	var errs Errors
+	if !errors.As(err, &errs) || len(errs) != 1 {
+		t.Fatalf("CreateCustomer() = %v, want one error", err)
+	}
+	if errs[0].Field != "phone" || errs[0].Message != "is required" {
+		t.Errorf("got %+v, want phone is required", errs[0])
+	}
+
+	if err := CreateCustomer(models.CreateCustomer{FullName: "Bob Smith", Phone: "+998901112233", Email: "bob@example.com"}); err != nil {
+		t.Errorf("CreateCustomer() = %v, want nil", err)
+	}
+}
@@ -0,0 +1,128 @@
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"city2city/api/models"
+	"github.com/google/uuid"
+)
+
+var (
+	uzPhone = regexp.MustCompile(`^\+998\d{9}$`)
+
+	// plates of private cars, 01 A 123 BC, and of companies, 01 123 ABC
+	privatePlate = regexp.MustCompile(`^(\d{2})[A-Z]\d{3}[A-Z]{2}$`)
+	companyPlate = regexp.MustCompile(`^(\d{2})\d{3}[A-Z]{3}$`)
+
+	// plateRegions are the region codes that open an Uzbek plate
+	plateRegions = map[string]bool{
+		"01": true, "10": true, "20": true, "25": true, "30": true, "40": true, "50": true,
+		"60": true, "70": true, "75": true, "80": true, "85": true, "90": true, "95": true,
+	}
+)
+
+func Required(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return "is required"
+	}
+	return ""
+}
+
+// Optional applies rule only to a non-empty value.
+func Optional(rule Rule[string]) Rule[string] {
+	return func(value string) string {
+		if value == "" {
+			return ""
+		}
+		return rule(value)
+	}
+}
+
+func UUID(value string) string {
+	if _, err := uuid.Parse(value); err != nil {
+		return "must be a UUID"
+	}
+	return ""
+}
+
+// Phone accepts Uzbek numbers in E.164 form, +998 followed by nine digits.
+func Phone(value string) string {
+	if !uzPhone.MatchString(value) {
+		return "must be an Uzbek phone number like +998901234567"
+	}
+	return ""
+}
+
+// Email accepts a bare RFC 5322 address, without a display name.
+func Email(value string) string {
+	addr, err := mail.ParseAddress(value)
+	if err != nil || addr.Address != value {
+		return "must be an email address like name@example.com"
+	}
+	return ""
+}
+
+// CarNumber accepts Uzbek licence plates of private cars (01 A 123 BC) and
+// companies (01 123 ABC), with or without spaces.
+func CarNumber(value string) string {
+	plate := models.CarNumber(value)
+
+	match := privatePlate.FindStringSubmatch(plate)
+	if match == nil {
+		match = companyPlate.FindStringSubmatch(plate)
+	}
+	if match == nil || !plateRegions[match[1]] {
+		return "must be an Uzbek licence plate like 01 A 123 BC or 01 123 ABC"
+	}
+	return ""
+}
+
+// Length bounds the number of characters, as char_length does in postgres.
+func Length(min, max int) Rule[string] {
+	return func(value string) string {
+		if n := utf8.RuneCountInString(value); n < min || n > max {
+			return fmt.Sprintf("must be %d to %d characters long", min, max)
+		}
+		return ""
+	}
+}
+
+func Min(min int) Rule[int] {
+	return func(value int) string {
+		if value < min {
+			return fmt.Sprintf("must be at least %d", min)
+		}
+		return ""
+	}
+}
+
+func OneOf(values ...string) Rule[string] {
+	return func(value string) string {
+		for _, v := range values {
+			if value == v {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(values, ", ")
+	}
+}
+
+// Timestamp accepts an RFC 3339 time such as 2024-05-01T08:30:00+05:00.
+func Timestamp(value string) string {
+	if _, err := time.Parse(time.RFC3339, value); err != nil {
+		return "must be an RFC 3339 time like 2024-05-01T08:30:00+05:00"
+	}
+	return ""
+}
+
+func RequiredTime(value time.Time) string {
+	if value.IsZero() {
+		return "is required"
+	}
+	return ""
+}
@@ -0,0 +1,91 @@
+package validation
+
+import (
+	"testing"
+
+	"city2city/api/models"
+)
+
+func TestPhone(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"+998901234567", true},
+		{"+998331234567", true},
+		{"998901234567", false},
+		{"+99890123456", false},
+		{"+9989012345678", false},
+		{"+998 90 123 45 67", false},
+		{"+998-90-123-45-67", false},
+		{"+7901234567", false},
+		{"+99890123456a", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := Phone(tt.value); (got == "") != tt.valid {
+				t.Errorf("Phone(%q) = %q, want valid %v", tt.value, got, tt.valid)
+			}
+		})
+	}
+}
+
+func TestEmail(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"bob@example.com", true},
+		{"bob.smith+trips@mail.example.uz", true},
+		{"bob", false},
+		{"bob@", false},
+		{"@example.com", false},
+		{"bob@@example.com", false},
+		{"Bob <bob@example.com>", false},
+		{" bob@example.com", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := Email(tt.value); (got == "") != tt.valid {
+				t.Errorf("Email(%q) = %q, want valid %v", tt.value, got, tt.valid)
+			}
+		})
+	}
+}
+
+func TestCarNumber(t *testing.T) {
+	tests := []struct {
+		value string
+		plate string
+		valid bool
+	}{
+		{"01A123BC", "01A123BC", true},
+		{"01 a 123 bc", "01A123BC", true},
+		{" 40 B 777 AA ", "40B777AA", true},
+		{"01123ABC", "01123ABC", true},
+		{"95 123 abc", "95123ABC", true},
+		{"02A123BC", "02A123BC", false},
+		{"99 123 ABC", "99123ABC", false},
+		{"01A12BC", "01A12BC", false},
+		{"01AB123C", "01AB123C", false},
+		{"01 123 AB", "01123AB", false},
+		{"1A123BC", "1A123BC", false},
+		{"01-A-123-BC", "01-A-123-BC", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := models.CarNumber(tt.value); got != tt.plate {
+				t.Errorf("models.CarNumber(%q) = %q, want %q", tt.value, got, tt.plate)
+			}
+			if got := CarNumber(tt.value); (got == "") != tt.valid {
+				t.Errorf("CarNumber(%q) = %q, want valid %v", tt.value, got, tt.valid)
+			}
+		})
+	}
+}
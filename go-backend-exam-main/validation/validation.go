@@ -0,0 +1,56 @@
+// Package validation checks request bodies before they reach storage. Each
+// model has a function listing the rules of its fields; it reports every
+// broken rule at once rather than stopping at the first.
+package validation
+
+import (
+	"strings"
+
+	"city2city/api/models"
+)
+
+// Errors is every field error found in one request body.
+type Errors []models.FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, fieldErr := range e {
+		messages = append(messages, fieldErr.Field+": "+fieldErr.Message)
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+// A Rule returns what is wrong with value, or "" when nothing is.
+type Rule[T any] func(value T) string
+
+// Validator collects field errors. Only the first broken rule of each field
+// is reported.
+type Validator struct {
+	errs Errors
+}
+
+// Field applies rules to value in order until one of them fails.
+func Field[T any](v *Validator, name string, value T, rules ...Rule[T]) {
+	for _, rule := range rules {
+		if message := rule(value); message != "" {
+			v.errs = append(v.errs, models.FieldError{Field: name, Message: message})
+			return
+		}
+	}
+}
+
+// Check records message against field when ok is false, for rules that
+// involve more than one field.
+func (v *Validator) Check(ok bool, field, message string) {
+	if !ok {
+		v.errs = append(v.errs, models.FieldError{Field: field, Message: message})
+	}
+}
+
+// Err returns the collected errors as Errors, or nil when there are none.
+func (v *Validator) Err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}